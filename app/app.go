@@ -130,7 +130,20 @@ func run(args options) {
 
 	if config.Cfg.PVEURL != "" && config.Cfg.PVETokenID != "" && config.Cfg.PVEToken != "" {
 		pveToken := config.Cfg.PVETokenID + "=" + config.Cfg.PVEToken
-		mcpSrv, err := mcp.New(config.Cfg.PVEURL, pveToken, AuditLogger)
+		mcpOpts := mcp.Options{
+			AllowTokenCreate:   config.Cfg.AllowTokenCreate,
+			AllowedPools:       config.Cfg.AllowedPools,
+			AgentExecAllowlist: config.Cfg.AgentExecAllowlist,
+			AllowLXCExec:       config.Cfg.AllowLXCExec,
+			AllowElevated:      config.Cfg.AllowElevated,
+		}
+		if config.Cfg.UploadDir != "" {
+			mcpOpts.UploadDir = resolveFilePath(config.Cfg.UploadDir)
+		}
+		if config.Cfg.StateDir != "" {
+			mcpOpts.StateDir = resolveFilePath(config.Cfg.StateDir)
+		}
+		mcpSrv, err := mcp.New(config.Cfg.PVEURL, pveToken, AuditLogger, mcpOpts)
 		if err != nil {
 			log.Warnf("Failed to initialize MCP server: %v", err)
 		} else {
@@ -39,6 +39,14 @@ type Configuration struct {
 
 	MCPStdio  bool   `yaml:"mcp_stdio"`
 	MCPAPIKey string `yaml:"mcp_api_key"`
+
+	AllowTokenCreate   bool     `yaml:"allow_api_token_create"`
+	AllowedPools       []string `yaml:"allowed_pools"`
+	AgentExecAllowlist []string `yaml:"guest_agent_exec_allowlist"`
+	AllowLXCExec       bool     `yaml:"allow_lxc_exec"`
+	AllowElevated      bool     `yaml:"allow_elevated_tools"`
+	UploadDir          string   `yaml:"upload_dir"`
+	StateDir           string   `yaml:"state_dir"`
 }
 
 func ResolveConfigPath(configFilename, workDir string) string {
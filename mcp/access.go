@@ -0,0 +1,213 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// accessToolRe matches the user, group, role, ACL and API token tools. They
+// manage permissions cluster-wide and are refused on a pool-scoped server.
+var accessToolRe = regexp.MustCompile(`^(list|get|create|update|delete)_(users?|groups?|roles?|acl|api_tokens?|` +
+	`permissions)$`)
+
+// scopedListToolRe matches the tools listing guests, pools or backups, whose
+// results are filtered to the allowed pools.
+var scopedListToolRe = regexp.MustCompile(`^list_(vms|containers|cluster_resources|pools|backups|pbs_groups|` +
+	`pbs_snapshots)$`)
+
+// volumeOwnerRe extracts the owning VMID from volume IDs such as
+// "local-lvm:vm-100-disk-0", "local:100/base-100-disk-0.qcow2",
+// "local:backup/vzdump-qemu-100-....vma.zst" or "pbs:backup/vm/100/...".
+var volumeOwnerRe = regexp.MustCompile(`[:/](?:vm|base|subvol)-(\d+)-|vzdump-(?:qemu|lxc|openvz)-(\d+)-|` +
+	`backup/(?:vm|ct)/(\d+)/|:(\d+)/`)
+
+// volumeOwner returns the VMID owning volume, or "" for volumes that belong
+// to no guest (ISO images, templates, ...).
+func volumeOwner(volume string) string {
+	m := volumeOwnerRe.FindStringSubmatch(volume)
+	for i := 1; i < len(m); i++ {
+		if m[i] != "" {
+			return m[i]
+		}
+	}
+	return ""
+}
+
+// guestPools maps every guest VMID in the cluster to its pool ("" if none).
+func guestPools(ctx context.Context, c *ProxmoxClient) (map[string]string, error) {
+	var resources []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+		return nil, err
+	}
+
+	pools := make(map[string]string, len(resources))
+	for _, r := range resources {
+		pools[strconv.Itoa(r.VMID)] = r.Pool
+	}
+	return pools, nil
+}
+
+// scopedGuestIDs collects the guest IDs a tool call refers to through its
+// vmid, vms and exclude arguments (comma-separated lists) and the owners of
+// its volume and archive arguments.
+func scopedGuestIDs(req mcp.CallToolRequest) []string {
+	var ids []string
+	for _, key := range []string{"vmid", "vms", "exclude"} {
+		for _, v := range strings.Split(req.GetString(key, ""), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				ids = append(ids, v)
+			}
+		}
+	}
+	ids = append(ids, volumeOwners(req)...)
+	return ids
+}
+
+// volumeOwners returns the owners of the volume and archive arguments of a
+// tool call.
+func volumeOwners(req mcp.CallToolRequest) []string {
+	var owners []string
+	for _, key := range []string{"volume", "archive"} {
+		if v := volumeOwner(req.GetString(key, "")); v != "" {
+			owners = append(owners, v)
+		}
+	}
+	return owners
+}
+
+// filterScopedList removes the guests, pools and backups outside the allowed
+// pools from the JSON list returned by a scopedListToolRe tool. Backups are
+// matched by their vmid, backup groups ("vm/100") by their ID. Entries that
+// are neither (nodes, storages) are kept.
+func filterScopedList(ctx context.Context, c *ProxmoxClient, allowed []string, res *mcp.CallToolResult,
+) (*mcp.CallToolResult, error) {
+	if res.IsError || len(res.Content) != 1 {
+		return res, nil
+	}
+	text, ok := res.Content[0].(mcp.TextContent)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result content %T", res.Content[0])
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal([]byte(text.Text), &entries); err != nil {
+		return nil, fmt.Errorf("parsing result: %w", err)
+	}
+	pools, err := guestPools(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]map[string]any, 0, len(entries))
+	for _, e := range entries {
+		id := configString(e, "vmid")
+		if _, groupID, ok := strings.Cut(configString(e, "group"), "/"); ok && id == "" {
+			id = groupID
+		}
+		switch {
+		case id != "":
+			if pool, ok := pools[id]; !ok || !slices.Contains(allowed, pool) {
+				continue
+			}
+		case e["poolid"] != nil:
+			if !slices.Contains(allowed, configString(e, "poolid")) {
+				continue
+			}
+		}
+		filtered = append(filtered, e)
+	}
+	out, err := json.MarshalIndent(filtered, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(out)), nil
+}
+
+// newPoolScopeMiddleware restricts tool calls to guests and pools in the
+// allowed list. Calls naming a pool outside the list, or an existing guest
+// that is not a member of an allowed pool, are refused before reaching
+// Proxmox. Guests that do not exist yet (e.g. a new VMID) are let through.
+// Volumes that belong to no guest cannot be changed or deleted, backup
+// archives can only be restored from guests in scope, backup jobs cannot
+// select all guests, the access management tools are refused, and guest and
+// pool lists only show what is in scope.
+func newPoolScopeMiddleware(c *ProxmoxClient, allowed []string) server.ToolHandlerMiddleware { //nolint:gocognit
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name := req.Params.Name
+			if accessToolRe.MatchString(name) {
+				return mcp.NewToolResultError(
+					fmt.Sprintf("access denied: %s is not available when tool calls are limited to pools", name),
+				), nil
+			}
+			if volume := req.GetString("volume", ""); volume != "" && volumeOwner(volume) == "" &&
+				(name == "update_volume" || name == "delete_volume") {
+				return mcp.NewToolResultError(
+					fmt.Sprintf("access denied: volume %s does not belong to a guest in an allowed pool", volume),
+				), nil
+			}
+
+			if (name == "create_backup_job" || name == "update_backup_job") && req.GetString("all", "") == "1" {
+				return mcp.NewToolResultError(
+					"access denied: all=1 selects guests outside the allowed pools; use pool or vmid",
+				), nil
+			}
+			if archive := req.GetString("archive", ""); archive != "" && volumeOwner(archive) == "" {
+				return mcp.NewToolResultError(
+					fmt.Sprintf("access denied: archive %s does not belong to a guest in an allowed pool", archive),
+				), nil
+			}
+
+			for _, key := range []string{"poolid", "pool"} {
+				if pool := req.GetString(key, ""); pool != "" && !slices.Contains(allowed, pool) {
+					return mcp.NewToolResultError(
+						fmt.Sprintf("access denied: pool %q is outside the allowed pools", pool),
+					), nil
+				}
+			}
+
+			if scopedListToolRe.MatchString(name) {
+				res, err := next(ctx, req)
+				if err != nil || res == nil {
+					return res, err
+				}
+				if res, err = filterScopedList(ctx, c, allowed, res); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("access check failed: %v", err)), nil
+				}
+				return res, nil
+			}
+
+			ids := scopedGuestIDs(req)
+			if len(ids) == 0 {
+				return next(ctx, req)
+			}
+
+			pools, err := guestPools(ctx, c)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("access check failed: %v", err)), nil
+			}
+			// The guest owning a volume or backup must exist, so orphaned
+			// volumes and backups of deleted guests stay out of reach.
+			owners := volumeOwners(req)
+			for _, id := range ids {
+				pool, exists := pools[id]
+				if (exists || slices.Contains(owners, id)) && !slices.Contains(allowed, pool) {
+					return mcp.NewToolResultError(
+						fmt.Sprintf("access denied: guest %s is not a member of an allowed pool", id),
+					), nil
+				}
+			}
+			return next(ctx, req)
+		}
+	}
+}
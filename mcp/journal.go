@@ -0,0 +1,247 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	journalFile         = "journal.db"
+	journalBucketPrefix = "guest-"
+	// maxJournalEntries bounds the history kept per guest; the oldest
+	// entries are dropped first.
+	maxJournalEntries = 200
+)
+
+// fieldChange is a config field changed by a call. An empty Before means the
+// field was added, an empty After that it was removed.
+type fieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// configChange is a journal entry: the guest config before and after a
+// mutating call. Secrets are not recorded.
+type configChange struct {
+	ID       string            `json:"id"`
+	Time     time.Time         `json:"time"`
+	Tool     string            `json:"tool"`
+	Node     string            `json:"node"`
+	Type     string            `json:"type"`
+	VMID     string            `json:"vmid"`
+	Digest   string            `json:"digest"`
+	Changes  []fieldChange     `json:"changes"`
+	RevertOf string            `json:"revert_of,omitempty"`
+	Reverted string            `json:"reverted_by,omitempty"`
+	Before   map[string]string `json:"before,omitempty"`
+	After    map[string]string `json:"after,omitempty"`
+}
+
+// configJournal keeps the config history of guests in a bbolt database in
+// the state directory, one bucket per guest with the entries in the order
+// they were recorded. The database is opened on first use. The journal is
+// disabled when no state directory is configured.
+type configJournal struct {
+	dir  string
+	once sync.Once
+	db   *bolt.DB
+	err  error
+}
+
+func newConfigJournal(dir string) *configJournal {
+	return &configJournal{dir: dir}
+}
+
+func (j *configJournal) enabled() bool {
+	return j != nil && j.dir != ""
+}
+
+func (j *configJournal) open() (*bolt.DB, error) {
+	if !j.enabled() {
+		return nil, errStateDirNotConfigured
+	}
+	j.once.Do(func() {
+		if j.err = os.MkdirAll(j.dir, 0o700); j.err != nil {
+			return
+		}
+		j.db, j.err = bolt.Open(filepath.Join(j.dir, journalFile), 0o600, &bolt.Options{Timeout: time.Second})
+	})
+	return j.db, j.err
+}
+
+func journalBucket(vmid string) []byte {
+	return []byte(journalBucketPrefix + vmid)
+}
+
+// entries returns the history of a guest, oldest first.
+func (j *configJournal) entries(vmid string) ([]configChange, error) {
+	db, err := j.open()
+	if err != nil {
+		return nil, err
+	}
+	var entries []configChange
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(journalBucket(vmid))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var e configChange
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			entries = append(entries, e)
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// add appends e to the history of its guest. A revert also marks the entry it
+// reverted.
+func (j *configJournal) add(e configChange) error {
+	db, err := j.open()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(journalBucket(e.VMID))
+		if err != nil {
+			return err
+		}
+		if e.RevertOf != "" {
+			if err := markReverted(b, e.RevertOf, e.ID); err != nil {
+				return err
+			}
+		}
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+			return err
+		}
+
+		n := 0
+		_ = b.ForEach(func(_, _ []byte) error { n++; return nil })
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && n > maxJournalEntries; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// markReverted records in the entry with ID id that revertID reverted it.
+func markReverted(b *bolt.Bucket, id, revertID string) error {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		var e configChange
+		if err := json.Unmarshal(v, &e); err != nil {
+			return err
+		}
+		if e.ID != id {
+			continue
+		}
+		e.Reverted = revertID
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Put(k, data)
+	}
+	return nil
+}
+
+func guestConfig(ctx context.Context, c *ProxmoxClient, node, guestType, vmid string) (map[string]any, error) {
+	var conf map[string]any
+	err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/%s/%s/config", node, guestType, vmid), &conf)
+	return conf, err
+}
+
+// diffConfigs lists the fields that differ between two flattened configs.
+func diffConfigs(before, after map[string]string) []fieldChange {
+	var changes []fieldChange
+	for _, f := range sortedKeys(before) {
+		if after[f] != before[f] {
+			changes = append(changes, fieldChange{Field: f, Before: before[f], After: after[f]})
+		}
+	}
+	for _, f := range sortedKeys(after) {
+		if _, ok := before[f]; !ok {
+			changes = append(changes, fieldChange{Field: f, After: after[f]})
+		}
+	}
+	return changes
+}
+
+// record runs change, a call modifying the config of the guest described by
+// meta, and journals the config before and after it. When the call returns a
+// task, the task is waited for before the new config is read. Journal errors
+// are logged and do not fail the call, which already happened.
+func (j *configJournal) record(ctx context.Context, c *ProxmoxClient, meta configChange,
+	change func() (string, error),
+) (string, error) {
+	if !j.enabled() {
+		return change()
+	}
+	before, err := guestConfig(ctx, c, meta.Node, meta.Type, meta.VMID)
+	if err != nil {
+		return "", err
+	}
+	result, err := change()
+	if err != nil {
+		return result, err
+	}
+
+	if upid, err := parseUPID(result); err == nil {
+		waitCtx, cancel := context.WithTimeout(ctx, defaultPowerWait)
+		_, err := waitForTask(waitCtx, c, upid, nil)
+		cancel()
+		if err != nil {
+			log.Warnf("Config journal: waiting for %s: %v", upid, err)
+		}
+	}
+	after, err := guestConfig(ctx, c, meta.Node, meta.Type, meta.VMID)
+	if err != nil {
+		log.Warnf("Config journal: reading config of guest %s: %v", meta.VMID, err)
+		return result, nil
+	}
+
+	meta.Before = flattenConfig(before)
+	meta.After = flattenConfig(after)
+	meta.Changes = diffConfigs(meta.Before, meta.After)
+	if len(meta.Changes) == 0 {
+		return result, nil
+	}
+	meta.Time = time.Now().UTC()
+	meta.Digest = configString(after, "digest")
+	if meta.ID, err = newStateID(); err == nil {
+		err = j.add(meta)
+	}
+	if err != nil {
+		log.Warnf("Config journal: recording change of guest %s: %v", meta.VMID, err)
+	}
+	return result, nil
+}
@@ -14,20 +14,77 @@ type Server struct {
 	mcpServer *server.MCPServer
 }
 
-func New(pveURL, pveToken string, auditLogger *log.Logger) (*Server, error) {
+// Options enables optional tools that are off by default.
+type Options struct {
+	// AllowTokenCreate registers create_api_token.
+	AllowTokenCreate bool
+	// AllowedPools, when not empty, limits tool calls to guests and pools in this list.
+	AllowedPools []string
+	// AgentExecAllowlist lists the VMIDs agent_exec and agent_file_write may
+	// target. The tools are not registered when it is empty.
+	AgentExecAllowlist []string
+	// AllowLXCExec registers lxc_exec.
+	AllowLXCExec bool
+	// AllowElevated registers the tools marked [elevated], such as console access.
+	AllowElevated bool
+	// UploadDir is the local directory upload_to_storage may read files from.
+	// Uploading local files is disabled when it is empty.
+	UploadDir string
+	// StateDir is where long-running operations such as drain_node keep
+	// their records, and where the config history of guests is kept. The
+	// tools that need it fail when it is empty.
+	StateDir string
+
+	// journal records config changes of guests in StateDir.
+	journal *configJournal
+}
+
+func New(pveURL, pveToken string, auditLogger *log.Logger, opts Options) (*Server, error) {
 	client := NewProxmoxClient(pveURL, pveToken, auditLogger)
 
-	s := server.NewMCPServer("proxmox", "1.0.0",
+	serverOpts := []server.ServerOption{
 		server.WithToolCapabilities(true),
-	)
+	}
+	if len(opts.AllowedPools) > 0 {
+		serverOpts = append(serverOpts,
+			server.WithToolHandlerMiddleware(newPoolScopeMiddleware(client, opts.AllowedPools)),
+		)
+	}
+
+	s := server.NewMCPServer("proxmox", "1.0.0", serverOpts...)
+	opts.journal = newConfigJournal(opts.StateDir)
 
 	RegisterClusterTools(s, client)
-	RegisterGuestTools(s, client)
+	RegisterNodeTools(s, client, opts)
+	RegisterMetricsTools(s, client)
+	RegisterGuestTools(s, client, opts)
+	RegisterHistoryTools(s, client, opts)
+	RegisterPowerTools(s, client)
+	RegisterBulkTools(s, client, opts)
+	RegisterDrainTools(s, client, opts)
+	RegisterRollingTools(s, client, opts)
+	RegisterDriftTools(s, client, opts)
 	RegisterCreateTools(s, client)
+	RegisterPlanTools(s, client, opts)
+	RegisterCloudInitTools(s, client, opts)
+	RegisterAgentTools(s, client, opts)
+	RegisterLXCTools(s, client, opts)
+	RegisterConsoleTools(s, client, opts)
 	RegisterSnapshotTools(s, client)
 	RegisterBackupTools(s, client)
+	RegisterBackupJobTools(s, client)
+	RegisterPBSTools(s, client)
 	RegisterStorageTools(s, client)
+	RegisterStorageConfigTools(s, client)
+	RegisterUploadTools(s, client, opts)
+	RegisterDiskTools(s, client)
+	RegisterHardwareTools(s, client, opts)
+	RegisterCephTools(s, client)
 	RegisterTaskTools(s, client)
+	RegisterNotificationTools(s, client)
+	RegisterCertificateTools(s, client)
+	RegisterAccessTools(s, client, opts)
+	RegisterPoolTools(s, client)
 
 	return &Server{mcpServer: s}, nil
 }
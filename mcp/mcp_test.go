@@ -4,13 +4,28 @@
 package mcp_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	log "github.com/sirupsen/logrus"
 
 	mcplib "github.com/anthoniech/proxmox-mcp-go/mcp"
 )
@@ -25,27 +40,96 @@ var expectedTools = []string{
 	// cluster
 	"get_version", "get_cluster_status", "list_nodes", "get_node_status",
 	"get_node_network",
+	// node
+	"list_node_services", "node_service_action", "apt_update", "list_apt_updates",
+	"get_apt_changelog", "list_package_versions", "get_subscription",
+	// metrics
+	"get_node_metrics", "get_guest_metrics", "get_storage_metrics",
 	// guest
 	"list_vms", "list_containers", "list_cluster_resources",
 	"get_guest_config", "start_guest", "stop_guest", "get_next_id",
 	"update_guest_config", "migrate_guest", "resize_guest_disk",
+	// history
+	"get_config_history", "revert_config_change",
+	// power
+	"shutdown_guest", "reboot_guest", "reset_guest", "suspend_guest", "hibernate_guest", "resume_guest",
+	"send_guest_key",
+	// bulk
+	"start_all_guests", "stop_all_guests", "suspend_all_guests", "migrate_all_guests", "bulk_guest_action",
+	// drain
+	"drain_node", "undrain_node",
+	// drift
+	"create_drift_baseline", "list_drift_baselines", "delete_drift_baseline", "detect_drift",
+	"schedule_drift_check",
 	// create
 	"create_vm", "create_container", "clone_guest",
 	"delete_guest", "convert_to_template",
+	// plan
+	"plan_guests", "apply_guest_plan",
+	// cloud-init
+	"set_cloudinit_config", "get_cloudinit_dump", "get_cloudinit_pending", "regenerate_cloudinit",
+	// guest agent
+	"agent_ping", "agent_get_osinfo", "agent_get_network", "agent_file_read",
+	"agent_fsfreeze", "agent_set_user_password",
+	// console
+	"get_terminal_console",
 	// snapshot
 	"list_snapshots", "create_snapshot", "rollback_snapshot", "delete_snapshot",
 	// backup
 	"backup_guest", "list_backups", "restore_backup",
+	// backup job
+	"list_backup_jobs", "get_backup_job", "create_backup_job",
+	"update_backup_job", "delete_backup_job", "list_not_backed_up",
+	// backup server
+	"list_pbs_namespaces", "list_pbs_groups", "list_pbs_snapshots",
+	"browse_backup_files", "download_backup_file",
 	// storage
 	"list_storage", "list_templates", "list_isos", "download_template",
+	"get_volume", "update_volume", "delete_volume",
+	// upload
+	"download_url_to_storage", "upload_to_storage",
+	// storage config
+	"list_storage_config", "get_storage_config", "create_storage", "update_storage",
+	"delete_storage", "scan_storage",
+	// disk
+	"list_disks", "get_disk_smart", "list_zfs_pools", "get_zfs_pool", "list_lvm_volume_groups",
+	"list_lvmthin_pools", "list_disk_directories", "get_disk_health",
+	"initialize_disk_gpt", "create_disk_storage", "wipe_disk",
+	// hardware
+	"list_pci_devices", "list_usb_devices", "list_hardware_mappings", "create_hardware_mapping",
+	"update_hardware_mapping", "delete_hardware_mapping", "attach_mapped_device",
+	// ceph
+	"get_ceph_status", "get_ceph_health", "list_ceph_pools", "get_ceph_pool",
+	"create_ceph_pool", "update_ceph_pool", "delete_ceph_pool", "list_ceph_osds",
+	"ceph_osd_action", "list_ceph_monitors", "list_ceph_managers", "list_cephfs",
+	"list_ceph_crush_rules",
 	// task
 	"list_tasks", "get_task_status", "get_task_log",
+	// notification
+	"list_notification_targets", "list_notification_endpoints", "get_notification_endpoint",
+	"create_notification_endpoint", "update_notification_endpoint", "delete_notification_endpoint",
+	"list_notification_matchers", "get_notification_matcher", "create_notification_matcher",
+	"update_notification_matcher", "delete_notification_matcher", "send_test_notification",
+	// certificate
+	"list_node_certificates", "upload_node_certificate", "get_certificate_expiry_report",
+	"list_acme_directories", "get_acme_directory_meta", "list_acme_accounts", "get_acme_account",
+	"register_acme_account", "update_acme_account", "delete_acme_account",
+	"list_acme_plugins", "get_acme_plugin", "create_acme_plugin", "update_acme_plugin", "delete_acme_plugin",
+	"set_node_acme_domains", "order_node_certificate",
+	// access
+	"list_users", "get_user", "create_user", "update_user", "delete_user",
+	"list_groups", "create_group", "delete_group",
+	"list_roles", "create_role", "update_role", "delete_role",
+	"list_acl", "update_acl", "get_permissions",
+	"list_api_tokens", "delete_api_token",
+	// pool
+	"list_pools", "create_pool", "delete_pool", "add_pool_members", "remove_pool_members",
 }
 
 func newTestServer(t *testing.T) *mcplib.Server {
 	t.Helper()
 
-	s, err := mcplib.New(fakeURL, fakeToken, nil)
+	s, err := mcplib.New(fakeURL, fakeToken, nil, mcplib.Options{})
 	if err != nil {
 		t.Fatalf("New() returned error: %v", err)
 	}
@@ -57,6 +141,36 @@ func newTestServer(t *testing.T) *mcplib.Server {
 	return s
 }
 
+// startFakePVE starts an HTTP server answering Proxmox API paths from the
+// given map of "METHOD /path" to response data and returns its URL.
+func startFakePVE(t *testing.T, routes map[string]string) string {
+	t.Helper()
+
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api2/json")
+		data, ok := routes[key]
+		if !ok {
+			http.Error(w, "no route for "+key, http.StatusNotImplemented)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":` + data + `}`))
+	}))
+	t.Cleanup(pve.Close)
+
+	return pve.URL
+}
+
+// newFakePVEServer returns an MCP server pointed at a fake Proxmox API.
+func newFakePVEServer(t *testing.T, routes map[string]string) *mcplib.Server {
+	t.Helper()
+
+	s, err := mcplib.New(startFakePVE(t, routes), fakeToken, nil, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	return s
+}
+
 func TestNew(t *testing.T) {
 	s := newTestServer(t)
 
@@ -218,3 +332,1832 @@ func TestCallTool(t *testing.T) {
 		t.Errorf("unexpected response type: %T", resp)
 	}
 }
+
+// callTool invokes a registered tool handler directly and returns its result.
+func callTool(t *testing.T, s *mcplib.Server, name string, args map[string]any) *mcp.CallToolResult {
+	t.Helper()
+
+	tool := s.MCPServer().GetTool(name)
+	if tool == nil {
+		t.Fatalf("tool %q not registered", name)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = name
+	req.Params.Arguments = args
+
+	res, err := tool.Handler(context.Background(), req)
+	if err != nil {
+		t.Fatalf("tool %q returned error: %v", name, err)
+	}
+	return res
+}
+
+// resultText returns the concatenated text content of a tool result.
+func resultText(res *mcp.CallToolResult) string {
+	var sb strings.Builder
+	for _, c := range res.Content {
+		if tc, ok := c.(mcp.TextContent); ok {
+			sb.WriteString(tc.Text)
+		}
+	}
+	return sb.String()
+}
+
+func TestCreateBackupJobSelection(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{
+			name: "missing schedule",
+			args: map[string]any{"vmid": "100"},
+			want: "schedule is required",
+		},
+		{
+			name: "no selection",
+			args: map[string]any{"schedule": "daily"},
+			want: "one of vmid, pool or all must be set",
+		},
+		{
+			name: "conflicting selection",
+			args: map[string]any{"schedule": "daily", "vmid": "100", "pool": "prod"},
+			want: "only one of vmid, pool or all may be set, got vmid, pool",
+		},
+		{
+			name: "exclude without all",
+			args: map[string]any{"schedule": "daily", "vmid": "100", "exclude": "101"},
+			want: "exclude is only valid together with all=1 or pool",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := callTool(t, s, "create_backup_job", tt.args)
+			if !res.IsError {
+				t.Fatal("expected error result")
+			}
+			if got := resultText(res); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBackupJobExcludeUsesExistingSelection(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"GET /cluster/backup/job-all": `{"id":"job-all","all":1,"schedule":"daily"}`,
+		"PUT /cluster/backup/job-all": `null`,
+		"GET /cluster/backup/job-vm":  `{"id":"job-vm","vmid":"100","schedule":"daily"}`,
+	})
+
+	res := callTool(t, s, "update_backup_job", map[string]any{"id": "job-all", "exclude": "101"})
+	if res.IsError {
+		t.Errorf("unexpected error for a job with all=1: %s", resultText(res))
+	}
+	res = callTool(t, s, "update_backup_job", map[string]any{"id": "job-vm", "exclude": "101"})
+	if !res.IsError || !strings.Contains(resultText(res), "exclude is only valid") {
+		t.Errorf("expected exclude to be refused for a job with vmid, got %q", resultText(res))
+	}
+}
+
+func TestGetCephHealthFindings(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"GET /nodes/pve1/ceph/status": `{"health":{"status":"HEALTH_ERR","checks":{
+			"OSD_DOWN":{"severity":"HEALTH_WARN","summary":{"message":"1 osds down","count":1},
+				"detail":[{"message":"osd.3 (root=default,host=pve2) is down"}]},
+			"PG_DAMAGED":{"severity":"HEALTH_ERR","summary":{"message":"Possible data damage: 1 pg inconsistent"}}
+		}}}`,
+	})
+
+	res := callTool(t, s, "get_ceph_health", map[string]any{"node": "pve1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var report struct {
+		Status   string `json:"status"`
+		Summary  string `json:"summary"`
+		Findings []struct {
+			Check   string   `json:"check"`
+			Details []string `json:"details"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &report); err != nil {
+		t.Fatalf("invalid report JSON: %v", err)
+	}
+
+	if report.Status != "HEALTH_ERR" {
+		t.Errorf("expected status HEALTH_ERR, got %q", report.Status)
+	}
+	if len(report.Findings) != 2 {
+		t.Fatalf("expected 2 findings, got %d", len(report.Findings))
+	}
+	if report.Findings[0].Check != "PG_DAMAGED" {
+		t.Errorf("expected most severe finding first, got %q", report.Findings[0].Check)
+	}
+	if len(report.Findings[1].Details) != 1 {
+		t.Errorf("expected OSD_DOWN details to be kept, got %v", report.Findings[1].Details)
+	}
+	if !strings.Contains(report.Summary, "Possible data damage") {
+		t.Errorf("summary does not mention most severe check: %q", report.Summary)
+	}
+}
+
+func TestCreateAPITokenDisabledByDefault(t *testing.T) {
+	s := newTestServer(t)
+
+	if s.MCPServer().GetTool("create_api_token") != nil {
+		t.Fatal("create_api_token must not be registered unless enabled")
+	}
+
+	enabled, err := mcplib.New(fakeURL, fakeToken, nil, mcplib.Options{AllowTokenCreate: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if enabled.MCPServer().GetTool("create_api_token") == nil {
+		t.Fatal("create_api_token must be registered when enabled")
+	}
+}
+
+func TestCreateAPITokenSecretNotAudited(t *testing.T) {
+	const secret = "5f0c2a5e-0000-4000-8000-c0ffee000001"
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /access/users/alice@pve/token/ci": `{"full-tokenid":"alice@pve!ci","value":"` + secret + `"}`,
+	})
+
+	var audit bytes.Buffer
+	auditLogger := log.New()
+	auditLogger.SetOutput(&audit)
+	auditLogger.SetFormatter(&log.JSONFormatter{})
+
+	s, err := mcplib.New(pveURL, fakeToken, auditLogger, mcplib.Options{AllowTokenCreate: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "create_api_token", map[string]any{"userid": "alice@pve", "tokenid": "ci"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	if !strings.Contains(resultText(res), secret) {
+		t.Error("expected the token secret in the tool response")
+	}
+	if audit.Len() == 0 {
+		t.Fatal("expected an audit entry for the API call")
+	}
+	if strings.Contains(audit.String(), secret) {
+		t.Error("token secret leaked into the audit log")
+	}
+}
+
+func TestListClusterResourcesPoolFilter(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"GET /cluster/resources": `[
+			{"vmid":100,"name":"web","pool":"team-a"},
+			{"vmid":101,"name":"db","pool":"team-b"},
+			{"vmid":102,"name":"scratch"}
+		]`,
+	})
+
+	res := callTool(t, s, "list_cluster_resources", map[string]any{"pool": "team-a"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var guests []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &guests); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(guests) != 1 || guests[0].Name != "web" {
+		t.Errorf("expected only guest web, got %+v", guests)
+	}
+}
+
+func TestPoolScope(t *testing.T) {
+	pveURL := startFakePVE(t, map[string]string{
+		"GET /cluster/resources":          `[{"vmid":100,"pool":"team-a"},{"vmid":101,"pool":"team-b"}]`,
+		"GET /nodes/pve1/qemu/100/config": `{"name":"web"}`,
+		"GET /nodes/pve1/qemu":            `[{"vmid":100,"name":"web"},{"vmid":101,"name":"db"}]`,
+		"GET /pools":                      `[{"poolid":"team-a"},{"poolid":"team-b"}]`,
+		"GET /pools/team-a":               `{"members":[{"vmid":100}]}`,
+		"GET /pools/team-b":               `{"members":[{"vmid":101}]}`,
+		"GET /access/users":               `[{"userid":"root@pam"}]`,
+		"POST /storage":                   `{"storage":"tank","type":"zfspool"}`,
+		"GET /nodes/pve1/storage/pbs/content": `[{"volid":"pbs:backup/vm/100/2025-01-01T00:00:00Z","vmid":100},` +
+			`{"volid":"pbs:backup/vm/101/2025-01-01T00:00:00Z","vmid":101}]`,
+	})
+
+	s, err := mcplib.New(pveURL, fakeToken, nil, mcplib.Options{AllowedPools: []string{"team-a"}})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	session := server.NewInProcessSession(server.GenerateInProcessSessionID(), nil)
+	ctx = s.MCPServer().WithContext(ctx, session)
+
+	call := func(name string, args map[string]any) (string, bool) {
+		msg, err := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "tools/call",
+			"params":  map[string]any{"name": name, "arguments": args},
+		})
+		if err != nil {
+			t.Fatalf("failed to marshal request: %v", err)
+		}
+		resp, ok := s.MCPServer().HandleMessage(ctx, msg).(mcp.JSONRPCResponse)
+		if !ok {
+			t.Fatalf("unexpected response type for %s", name)
+		}
+		res, ok := resp.Result.(mcp.CallToolResult)
+		if !ok {
+			t.Fatalf("unexpected result type %T for %s", resp.Result, name)
+		}
+		return resultText(&res), res.IsError
+	}
+
+	if text, isErr := call("get_guest_config", map[string]any{"node": "pve1", "vmid": "100"}); isErr {
+		t.Errorf("guest in allowed pool was refused: %s", text)
+	}
+	if text, isErr := call("get_guest_config", map[string]any{"node": "pve1", "vmid": "101"}); !isErr ||
+		!strings.Contains(text, "access denied") {
+		t.Errorf("guest outside allowed pools was not refused: %s", text)
+	}
+	if text, isErr := call("add_pool_members", map[string]any{"poolid": "team-a", "vms": "100,101"}); !isErr ||
+		!strings.Contains(text, "guest 101") {
+		t.Errorf("moving an out-of-scope guest into the pool was not refused: %s", text)
+	}
+	if text, isErr := call("delete_pool", map[string]any{"poolid": "team-b"}); !isErr ||
+		!strings.Contains(text, "access denied") {
+		t.Errorf("pool outside allowed pools was not refused: %s", text)
+	}
+
+	for name, args := range map[string]map[string]any{
+		"list_vms":               {"node": "pve1"},
+		"list_cluster_resources": nil,
+		"list_pools":             nil,
+		"list_backups":           {"node": "pve1", "storage": "pbs"},
+		"list_pbs_groups":        {"node": "pve1", "storage": "pbs"},
+		"list_pbs_snapshots":     {"node": "pve1", "storage": "pbs"},
+	} {
+		text, isErr := call(name, args)
+		if isErr || !strings.Contains(text, "100") || strings.Contains(text, "101") ||
+			strings.Contains(text, "team-b") {
+			t.Errorf("%s was not filtered to the allowed pools: %s", name, text)
+		}
+	}
+	for _, volume := range []string{"local-lvm:vm-101-disk-0", "local:backup/vzdump-qemu-102-2025_01_01.vma.zst",
+		"local:iso/debian.iso"} {
+		if text, isErr := call("delete_volume", map[string]any{"node": "pve1", "volume": volume}); !isErr ||
+			!strings.Contains(text, "access denied") {
+			t.Errorf("deleting %s was not refused: %s", volume, text)
+		}
+	}
+	if text, isErr := call("create_storage", map[string]any{"storage": "tank", "type": "zfspool",
+		"storage_pool": "rpool/data"}); isErr {
+		t.Errorf("a ZFS storage pool was checked as a resource pool: %s", text)
+	}
+	for name, args := range map[string]map[string]any{
+		"create_backup_job": {"schedule": "daily", "vmid": "100,101"},
+		"update_backup_job": {"id": "backup-1", "vmid": "100, 101"},
+		"restore_backup": {
+			"node": "pve1", "vmid": "100", "archive": "local:backup/vzdump-qemu-101-2025_01_01-00_00_00.vma.zst",
+		},
+	} {
+		if text, isErr := call(name, args); !isErr || !strings.Contains(text, "guest 101") {
+			t.Errorf("%s with an out-of-scope guest was not refused: %s", name, text)
+		}
+	}
+	if text, isErr := call("create_backup_job", map[string]any{"schedule": "daily", "all": "1"}); !isErr ||
+		!strings.Contains(text, "all=1") {
+		t.Errorf("a backup job of all guests was not refused: %s", text)
+	}
+	for _, name := range []string{"list_users", "update_acl", "create_api_token", "get_permissions"} {
+		if s.MCPServer().GetTool(name) == nil {
+			continue
+		}
+		if text, isErr := call(name, nil); !isErr || !strings.Contains(text, "access denied") {
+			t.Errorf("%s was not refused: %s", name, text)
+		}
+	}
+}
+
+func TestSetCloudInitConfigEncodesSSHKeys(t *testing.T) {
+	var form url.Values
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		_, _ = w.Write([]byte(`{"data":null}`))
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	keys := "ssh-ed25519 AAAAC3Nz+a/b= alice@laptop\nssh-rsa AAAAB3Nz bob@desk\n"
+	res := callTool(t, s, "set_cloudinit_config", map[string]any{
+		"node":      "pve1",
+		"vmid":      "100",
+		"ciuser":    "admin",
+		"sshkeys":   keys,
+		"ipconfig2": "ip=dhcp",
+		"bogus":     "ignored",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	want := "ssh-ed25519%20AAAAC3Nz%2Ba%2Fb%3D%20alice%40laptop%0Assh-rsa%20AAAAB3Nz%20bob%40desk"
+	if got := form.Get("sshkeys"); got != want {
+		t.Errorf("sshkeys: expected %q, got %q", want, got)
+	}
+	if got := form.Get("ipconfig2"); got != "ip=dhcp" {
+		t.Errorf("ipconfig2: expected ip=dhcp, got %q", got)
+	}
+	if form.Has("bogus") {
+		t.Error("unknown argument must not be forwarded")
+	}
+}
+
+func TestAgentExecAllowlist(t *testing.T) {
+	s := newTestServer(t)
+	for _, name := range []string{"agent_exec", "agent_file_write"} {
+		if s.MCPServer().GetTool(name) != nil {
+			t.Errorf("%s must not be registered without an allowlist", name)
+		}
+	}
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /nodes/pve1/qemu/100/agent/exec":       `{"pid":42}`,
+		"GET /nodes/pve1/qemu/100/agent/exec-status": `{"exited":1,"exitcode":0,"out-data":"active\n"}`,
+	})
+	s, err := mcplib.New(pveURL, fakeToken, nil, mcplib.Options{AgentExecAllowlist: []string{"100"}})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "agent_exec", map[string]any{
+		"node": "pve1", "vmid": "100", "command": "/bin/systemctl", "args": []any{"is-active", "nginx"},
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var st struct {
+		ExitCode int    `json:"exitcode"`
+		OutData  string `json:"out-data"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &st); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if st.ExitCode != 0 || st.OutData != "active\n" {
+		t.Errorf("unexpected exec status: %+v", st)
+	}
+
+	res = callTool(t, s, "agent_exec", map[string]any{"node": "pve1", "vmid": "101", "command": "/bin/true"})
+	if !res.IsError || !strings.Contains(resultText(res), "allowlist") {
+		t.Errorf("expected guest outside the allowlist to be refused, got %q", resultText(res))
+	}
+}
+
+func TestConsoleToolsElevated(t *testing.T) {
+	consoleTools := []string{"get_vnc_console", "get_spice_console"}
+
+	s := newTestServer(t)
+	for _, name := range consoleTools {
+		if s.MCPServer().GetTool(name) != nil {
+			t.Errorf("%s must not be registered unless elevated tools are allowed", name)
+		}
+	}
+	// get_terminal_console issues no ticket, so it is not an elevated tool.
+	if tool := s.MCPServer().GetTool("get_terminal_console"); tool == nil ||
+		strings.HasPrefix(tool.Tool.Description, "[elevated]") {
+		t.Error("get_terminal_console must be registered without the [elevated] tag")
+	}
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /nodes/pve1/qemu/100/spiceproxy": `{"type":"spice","host":"pvespiceproxy:abc","password":"pw",` +
+			`"proxy":"http://10.0.0.1:3128","tls-port":61000,"delete-this-file":1}`,
+		"POST /nodes/pve1/qemu/100/vncproxy": `{"port":5900,"ticket":"PVEVNC:T1","user":"root@pam","upid":"UPID:x"}`,
+	})
+	s, err := mcplib.New(pveURL, fakeToken, nil, mcplib.Options{AllowElevated: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	for _, name := range consoleTools {
+		tool := s.MCPServer().GetTool(name)
+		if tool == nil {
+			t.Fatalf("%s must be registered when elevated tools are allowed", name)
+		}
+		if !strings.HasPrefix(tool.Tool.Description, "[elevated]") {
+			t.Errorf("%s description must be marked [elevated]", name)
+		}
+	}
+
+	res := callTool(t, s, "get_spice_console", map[string]any{"node": "pve1", "vmid": "100"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var vv string
+	for _, c := range res.Content {
+		if r, ok := c.(mcp.EmbeddedResource); ok {
+			if tr, ok := r.Resource.(mcp.TextResourceContents); ok {
+				vv = tr.Text
+			}
+		}
+	}
+	if !strings.HasPrefix(vv, "[virt-viewer]\n") || !strings.Contains(vv, "\ntls-port=61000\n") {
+		t.Errorf("unexpected .vv file:\n%s", vv)
+	}
+
+	res = callTool(t, s, "get_vnc_console", map[string]any{"node": "pve1", "vmid": "100"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var console struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &console); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	u, err := url.Parse(console.URL)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", console.URL, err)
+	}
+	wantPath := "api2/json/nodes/pve1/qemu/100/vncwebsocket?port=5900&vncticket=PVEVNC%3AT1"
+	if u.Path != "/novnc/vnc.html" || u.Query().Get("path") != wantPath {
+		t.Errorf("unexpected noVNC URL %q", console.URL)
+	}
+
+	// The web UI starts its own termproxy, so no ticket is requested.
+	res = callTool(t, s, "get_terminal_console", map[string]any{"node": "pve1", "vmid": "100", "type": "lxc"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	console.URL = ""
+	if err := json.Unmarshal([]byte(resultText(res)), &console); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if strings.Contains(resultText(res), "ticket") ||
+		!strings.HasSuffix(console.URL, "/?console=lxc&node=pve1&vmid=100&xtermjs=1") {
+		t.Errorf("unexpected terminal console response: %s", resultText(res))
+	}
+}
+
+func TestGetGuestMetricsSummary(t *testing.T) {
+	var rows []string
+	for i := 1; i <= 20; i++ {
+		rows = append(rows, fmt.Sprintf(`{"time":%d,"cpu":%g,"netin":%d}`, 1700000000+i*60, float64(i)/100, i*1000))
+	}
+	// RRD gaps come back as rows without values.
+	rows = append(rows, `{"time":1700001260}`)
+
+	s := newFakePVEServer(t, map[string]string{
+		"GET /nodes/pve1/qemu/100/rrddata": "[" + strings.Join(rows, ",") + "]",
+	})
+
+	res := callTool(t, s, "get_guest_metrics", map[string]any{"node": "pve1", "vmid": "100", "timeframe": "day"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var summary struct {
+		Timeframe string `json:"timeframe"`
+		Samples   int    `json:"samples"`
+		Start     int64  `json:"start"`
+		End       int64  `json:"end"`
+		Metrics   map[string]struct {
+			Min, Avg, P50, P95, Max, Last float64
+		} `json:"metrics"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &summary); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	if summary.Timeframe != "day" || summary.Samples != 21 {
+		t.Errorf("unexpected header: %+v", summary)
+	}
+	if summary.Start != 1700000060 || summary.End != 1700001260 {
+		t.Errorf("unexpected range %d-%d", summary.Start, summary.End)
+	}
+	cpu := summary.Metrics["cpu"]
+	if cpu.Min != 0.01 || cpu.P50 != 0.1 || cpu.P95 != 0.19 || cpu.Max != 0.2 || cpu.Last != 0.2 {
+		t.Errorf("unexpected cpu stats: %+v", cpu)
+	}
+	if got := summary.Metrics["netin"].Avg; got != 10500 {
+		t.Errorf("expected netin avg 10500, got %v", got)
+	}
+
+	res = callTool(t, s, "get_guest_metrics", map[string]any{"node": "pve1", "vmid": "100", "cf": "MIN"})
+	if !res.IsError {
+		t.Error("expected unsupported cf to be rejected")
+	}
+}
+
+func TestUpgradeNodeElevated(t *testing.T) {
+	s := newTestServer(t)
+	if s.MCPServer().GetTool("upgrade_node") != nil {
+		t.Fatal("upgrade_node must not be registered unless elevated tools are allowed")
+	}
+
+	s, err := mcplib.New(fakeURL, fakeToken, nil, mcplib.Options{AllowElevated: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	tool := s.MCPServer().GetTool("upgrade_node")
+	if tool == nil {
+		t.Fatal("upgrade_node must be registered when elevated tools are allowed")
+	}
+	if !strings.HasPrefix(tool.Tool.Description, "[elevated]") {
+		t.Error("upgrade_node description must be marked [elevated]")
+	}
+}
+
+func TestNodeServiceAction(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"POST /nodes/pve1/services/pveproxy/restart": `"UPID:pve1:restart"`,
+	})
+
+	res := callTool(t, s, "node_service_action", map[string]any{
+		"node": "pve1", "service": "pveproxy", "action": "restart",
+	})
+	if res.IsError || !strings.Contains(resultText(res), "UPID:pve1:restart") {
+		t.Errorf("unexpected result: %s", resultText(res))
+	}
+
+	res = callTool(t, s, "node_service_action", map[string]any{
+		"node": "pve1", "service": "pveproxy", "action": "disable",
+	})
+	if !res.IsError {
+		t.Error("expected unsupported action to be rejected")
+	}
+}
+
+func TestGetDiskHealthFindings(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"GET /nodes/pve1/disks/list": `[
+			{"devpath":"/dev/sda","type":"hdd","health":"PASSED","wearout":"N/A"},
+			{"devpath":"/dev/sdb","type":"ssd","health":"PASSED","wearout":5},
+			{"devpath":"/dev/nvme0n1","type":"nvme","health":"FAILED","model":"X","serial":"S1"}
+		]`,
+		"GET /nodes/pve1/disks/smart": `{"health":"PASSED","type":"ata","attributes":[
+			{"id":"5","name":"Reallocated_Sector_Ct","value":"5","threshold":"10","fail":"-","raw":"2000"},
+			{"id":"194","name":"Temperature_Celsius","value":"60","threshold":"0","fail":"In_the_past","raw":"40"}
+		]}`,
+		"GET /nodes/pve1/disks/zfs": `[{"name":"rpool","health":"ONLINE"},{"name":"tank","health":"DEGRADED"}]`,
+		"GET /nodes/pve1/disks/lvmthin": `[{"lv":"data","vg":"pve","lv_size":1000,"used":950,` +
+			`"metadata_size":100,"metadata_used":10}]`,
+	})
+
+	res := callTool(t, s, "get_disk_health", map[string]any{"node": "pve1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var report struct {
+		Status   string `json:"status"`
+		Findings []struct {
+			Severity  string `json:"severity"`
+			Component string `json:"component"`
+			Name      string `json:"name"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Status != "CRITICAL" {
+		t.Errorf("expected status CRITICAL, got %q", report.Status)
+	}
+
+	got := map[string]int{}
+	for _, f := range report.Findings {
+		got[f.Severity+" "+f.Component+" "+f.Name]++
+	}
+	want := map[string]int{
+		"critical disk /dev/nvme0n1": 1,
+		"warning disk /dev/sdb":      1,
+		// The fake returns the same SMART data for every disk.
+		"critical smart /dev/sda": 1, "warning smart /dev/sda": 1,
+		"critical smart /dev/sdb": 1, "warning smart /dev/sdb": 1,
+		"critical smart /dev/nvme0n1": 1, "warning smart /dev/nvme0n1": 1,
+		"warning zfs tank":         1,
+		"warning lvmthin pve/data": 1,
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("expected %d finding(s) %q, got %d (all: %v)", n, k, got[k], got)
+		}
+	}
+	if len(report.Findings) != 10 {
+		t.Errorf("expected 10 findings, got %d", len(report.Findings))
+	}
+	if report.Findings[0].Severity != "critical" {
+		t.Error("expected critical findings first")
+	}
+}
+
+func TestDiskToolAnnotations(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, name := range []string{"initialize_disk_gpt", "create_disk_storage", "wipe_disk"} {
+		a := s.MCPServer().GetTool(name).Tool.Annotations
+		if a.DestructiveHint == nil || !*a.DestructiveHint {
+			t.Errorf("%s must be annotated as destructive", name)
+		}
+	}
+	for _, name := range []string{"list_disks", "get_disk_smart", "get_disk_health"} {
+		a := s.MCPServer().GetTool(name).Tool.Annotations
+		if a.ReadOnlyHint == nil || !*a.ReadOnlyHint || a.DestructiveHint == nil || *a.DestructiveHint {
+			t.Errorf("%s must be annotated as read-only", name)
+		}
+	}
+}
+
+func TestCreateStorageValidation(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"POST /storage":    `{"storage":"nas","type":"nfs"}`,
+		"GET /storage/nas": `{"storage":"nas","type":"nfs","server":"10.0.0.5","export":"/srv"}`,
+		"PUT /storage/nas": `null`,
+	})
+
+	tests := []struct {
+		name    string
+		tool    string
+		args    map[string]any
+		wantErr string
+	}{
+		{"nfs ok", "create_storage", map[string]any{
+			"storage": "nas", "type": "nfs", "server": "10.0.0.5", "export": "/srv", "content": "backup",
+		}, ""},
+		{"missing required", "create_storage", map[string]any{
+			"storage": "nas", "type": "cifs", "server": "10.0.0.5",
+		}, "requires share"},
+		{"foreign parameter", "create_storage", map[string]any{
+			"storage": "local2", "type": "dir", "path": "/data", "export": "/srv",
+		}, "export is not a valid parameter for dir"},
+		{"unsupported type", "create_storage", map[string]any{
+			"storage": "x", "type": "glusterfs",
+		}, "unsupported storage type"},
+		{"zfspool ok", "create_storage", map[string]any{
+			"storage": "nas", "type": "zfspool", "storage_pool": "rpool/data",
+		}, ""},
+		{"zfspool missing pool", "create_storage", map[string]any{
+			"storage": "nas", "type": "zfspool",
+		}, "requires storage_pool"},
+		{"update ok", "update_storage", map[string]any{"storage": "nas", "options": "vers=4.2"}, ""},
+		{"update fixed", "update_storage", map[string]any{"storage": "nas", "export": "/other"}, "cannot be changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := callTool(t, s, tt.tool, tt.args)
+			if tt.wantErr == "" {
+				if res.IsError {
+					t.Fatalf("unexpected error: %s", resultText(res))
+				}
+				return
+			}
+			if !res.IsError || !strings.Contains(resultText(res), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %q", tt.wantErr, resultText(res))
+			}
+		})
+	}
+}
+
+func TestStorageSecretsRedactedInAudit(t *testing.T) {
+	const secret = "hunter2-very-secret"
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /storage":             `{"storage":"pbs1","type":"pbs"}`,
+		"GET /nodes/pve1/scan/cifs": `[{"share":"backup"}]`,
+	})
+
+	var audit bytes.Buffer
+	auditLogger := log.New()
+	auditLogger.SetOutput(&audit)
+	auditLogger.SetFormatter(&log.JSONFormatter{})
+
+	s, err := mcplib.New(pveURL, fakeToken, auditLogger, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "create_storage", map[string]any{
+		"storage": "pbs1", "type": "pbs", "server": "pbs.example.com", "datastore": "main",
+		"username": "backup@pbs", "password": secret, "encryption_key": secret,
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	res = callTool(t, s, "scan_storage", map[string]any{
+		"node": "pve1", "type": "cifs", "server": "nas", "username": "u", "password": secret,
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	if strings.Contains(audit.String(), secret) {
+		t.Errorf("secret leaked into the audit log:\n%s", audit.String())
+	}
+	if !strings.Contains(audit.String(), "datastore=main") || !strings.Contains(audit.String(), "REDACTED") {
+		t.Errorf("expected redacted request parameters in the audit log:\n%s", audit.String())
+	}
+}
+
+func TestAuditLogOmitsUnlistedParamValues(t *testing.T) {
+	const content = "root:x:0:0:private-file-content"
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /nodes/pve1/qemu/100/agent/file-write": `null`,
+		"POST /nodes/pve1/qemu/100/agent/exec":       `{"pid":42}`,
+		"GET /nodes/pve1/qemu/100/agent/exec-status": `{"exited":1,"exitcode":0}`,
+	})
+
+	var audit bytes.Buffer
+	auditLogger := log.New()
+	auditLogger.SetOutput(&audit)
+	auditLogger.SetFormatter(&log.JSONFormatter{})
+
+	s, err := mcplib.New(pveURL, fakeToken, auditLogger, mcplib.Options{AgentExecAllowlist: []string{"100"}})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "agent_file_write", map[string]any{
+		"node": "pve1", "vmid": "100", "file": "/etc/passwd", "content": content,
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	res = callTool(t, s, "agent_exec", map[string]any{
+		"node": "pve1", "vmid": "100", "command": "/bin/sh", "input_data": content,
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	if strings.Contains(audit.String(), "private-file-content") {
+		t.Errorf("request data leaked into the audit log:\n%s", audit.String())
+	}
+	if !strings.Contains(audit.String(), "content=%5BREDACTED%5D") {
+		t.Errorf("expected the parameter names in the audit log:\n%s", audit.String())
+	}
+}
+
+func TestDeleteVolumeRefusesReferencedVolume(t *testing.T) {
+	s := newFakePVEServer(t, map[string]string{
+		"GET /cluster/resources": `[
+			{"vmid":100,"node":"pve1","type":"qemu"},
+			{"vmid":200,"node":"pve2","type":"lxc"}
+		]`,
+		"GET /nodes/pve1/qemu/100/config": `{"scsi0":"local-lvm:vm-100-disk-0,size=32G",` +
+			`"ide2":"local:iso/debian.iso,media=cdrom","name":"web"}`,
+		"GET /nodes/pve1/qemu/100/pending": `[{"key":"scsi0","value":"local-lvm:vm-100-disk-0,size=32G"},` +
+			`{"key":"scsi1","pending":"local-lvm:vm-100-disk-1,size=8G"}]`,
+		"GET /nodes/pve1/qemu/100/snapshot": `[{"name":"pre-upgrade"},{"name":"current"}]`,
+		"GET /nodes/pve1/qemu/100/snapshot/pre-upgrade/config": `{"scsi0":"local-lvm:vm-100-disk-0,size=32G",` +
+			`"ide2":"local:iso/old-installer.iso,media=cdrom"}`,
+		"GET /nodes/pve2/lxc/200/config":                             `{"rootfs":"local-lvm:vm-200-disk-0,size=8G"}`,
+		"GET /nodes/pve2/lxc/200/pending":                            `[]`,
+		"GET /nodes/pve2/lxc/200/snapshot":                           `[{"name":"current"}]`,
+		"DELETE /nodes/pve1/storage/local/content/local:iso/old.iso": `null`,
+	})
+
+	res := callTool(t, s, "delete_volume", map[string]any{"node": "pve1", "volume": "local:iso/debian.iso"})
+	if !res.IsError || !strings.Contains(resultText(res), "qemu/100 ide2") {
+		t.Errorf("expected deletion to be refused, got %q", resultText(res))
+	}
+
+	res = callTool(t, s, "delete_volume", map[string]any{"node": "pve1", "volume": "local-lvm:vm-200-disk-0"})
+	if !res.IsError || !strings.Contains(resultText(res), "lxc/200 rootfs") {
+		t.Errorf("expected deletion to be refused, got %q", resultText(res))
+	}
+
+	for volume, ref := range map[string]string{
+		"local-lvm:vm-100-disk-1":     "qemu/100 scsi1 (pending)",
+		"local:iso/old-installer.iso": "qemu/100 ide2 (snapshot pre-upgrade)",
+	} {
+		res = callTool(t, s, "delete_volume", map[string]any{"node": "pve1", "volume": volume})
+		if !res.IsError || !strings.Contains(resultText(res), ref) {
+			t.Errorf("expected deletion of %s to be refused with %q, got %q", volume, ref, resultText(res))
+		}
+	}
+
+	res = callTool(t, s, "delete_volume", map[string]any{"node": "pve1", "volume": "local:iso/old.iso"})
+	if res.IsError {
+		t.Errorf("unexpected error: %s", resultText(res))
+	}
+}
+
+func TestPBSFileRestore(t *testing.T) {
+	const volume = "pbs:backup/vm/100/2025-01-02T02:00:00Z"
+	etc := base64.StdEncoding.EncodeToString([]byte("/drive-scsi0.img.fidx/part/1/etc"))
+	nginx := base64.StdEncoding.EncodeToString([]byte("/drive-scsi0.img.fidx/part/1/etc/nginx"))
+	archive := append([]byte("PK\x03\x04"), "zipped nginx"...)
+
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api2/json") {
+		case "GET /nodes/pve1/storage/pbs/content":
+			_, _ = w.Write([]byte(`{"data":[
+				{"volid":"pbs:backup/vm/100/2025-01-01T02:00:00Z","vmid":100,"ctime":1735696800,"size":10,
+				 "verification":{"state":"ok"}},
+				{"volid":"` + volume + `","vmid":100,"ctime":1735783200,"size":20,"protected":1},
+				{"volid":"pbs:backup/ct/200/2025-01-02T03:00:00Z","vmid":200,"ctime":1735786800,"size":5,
+				 "verification":{"state":"failed"}}
+			]}`))
+		case "GET /nodes/pve1/storage/pbs/file-restore/list":
+			if q.Get("volume") != volume || q.Get("filepath") != etc {
+				http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":[{"filepath":"` + nginx + `","text":"nginx","type":"d","leaf":0}]}`))
+		case "GET /nodes/pve1/storage/pbs/file-restore/download":
+			if q.Get("filepath") != nginx {
+				http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write(archive)
+		default:
+			http.Error(w, "no route", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "list_pbs_groups", map[string]any{"node": "pve1", "storage": "pbs"})
+	var groups []struct {
+		Group        string `json:"group"`
+		Snapshots    int    `json:"snapshots"`
+		LastSnapshot string `json:"last_snapshot"`
+		Protected    int    `json:"protected"`
+		VerifyFailed int    `json:"verify_failed"`
+		Unverified   int    `json:"unverified"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &groups); err != nil {
+		t.Fatalf("invalid JSON: %v (%s)", err, resultText(res))
+	}
+	if len(groups) != 2 || groups[0].Group != "ct/200" || groups[1].Group != "vm/100" {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+	vm := groups[1]
+	if vm.Snapshots != 2 || vm.LastSnapshot != volume || vm.Protected != 1 || vm.Unverified != 1 {
+		t.Errorf("unexpected vm/100 group: %+v", vm)
+	}
+	if groups[0].VerifyFailed != 1 {
+		t.Errorf("expected a failed verification in ct/200: %+v", groups[0])
+	}
+
+	res = callTool(t, s, "browse_backup_files", map[string]any{
+		"node": "pve1", "storage": "pbs", "volume": volume, "path": "/drive-scsi0.img.fidx/part/1/etc",
+	})
+	if res.IsError || !strings.Contains(resultText(res), `"path": "/drive-scsi0.img.fidx/part/1/etc/nginx"`) {
+		t.Errorf("unexpected listing: %s", resultText(res))
+	}
+
+	res = callTool(t, s, "download_backup_file", map[string]any{
+		"node": "pve1", "storage": "pbs", "volume": volume, "path": "/drive-scsi0.img.fidx/part/1/etc/nginx",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var blob mcp.BlobResourceContents
+	for _, c := range res.Content {
+		if r, ok := c.(mcp.EmbeddedResource); ok {
+			blob, _ = r.Resource.(mcp.BlobResourceContents)
+		}
+	}
+	if blob.URI != "file:///nginx.zip" || blob.Blob != base64.StdEncoding.EncodeToString(archive) {
+		t.Errorf("unexpected blob %s", blob.URI)
+	}
+}
+
+func TestAttachMappedDeviceChecksMachine(t *testing.T) {
+	routes := map[string]string{
+		"GET /cluster/mapping/pci/gpu0": `{"id":"gpu0","map":["node=pve1,path=0000:01:00,id=10de:2204,iommugroup=12"]}`,
+		"GET /nodes/pve1/hardware/pci": `[
+			{"id":"0000:01:00.0","class":"0x030000","iommugroup":12},
+			{"id":"0000:01:00.1","class":"0x040300","iommugroup":12}
+		]`,
+		"GET /nodes/pve1/qemu/100/config": `{"machine":"pc-i440fx-8.1","bios":"seabios","digest":"abc"}`,
+		"GET /nodes/pve1/qemu/101/config": `{"machine":"q35","bios":"ovmf","hostpci0":"0000:02:00.0","digest":"abc"}`,
+		"PUT /nodes/pve1/qemu/101/config": `null`,
+	}
+	s := newFakePVEServer(t, routes)
+
+	res := callTool(t, s, "attach_mapped_device", map[string]any{
+		"node": "pve1", "vmid": "100", "type": "pci", "mapping": "gpu0",
+	})
+	if !res.IsError || !strings.Contains(resultText(res), "q35") || !strings.Contains(resultText(res), "OVMF") {
+		t.Errorf("expected q35/OVMF refusal, got %q", resultText(res))
+	}
+
+	res = callTool(t, s, "attach_mapped_device", map[string]any{
+		"node": "pve1", "vmid": "101", "type": "pci", "mapping": "gpu0", "x_vga": "1",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	if !strings.Contains(resultText(res), "hostpci1: mapping=gpu0,pcie=1,x-vga=1") {
+		t.Errorf("expected hostpci1 to be used, got %q", resultText(res))
+	}
+}
+
+func TestNotificationEndpointSecretsRedacted(t *testing.T) {
+	const secret = "gotify-app-token"
+
+	pveURL := startFakePVE(t, map[string]string{
+		"POST /cluster/notifications/endpoints/webhook": `null`,
+		"GET /cluster/notifications/endpoints/gotify/push": `{"name":"push","server":"https://gotify.example.com",` +
+			`"token":"` + secret + `"}`,
+		"GET /cluster/notifications/endpoints/webhook": `[{"name":"chat",` +
+			`"url":"https://chat.example.com/{{ secrets.key }}","secret":["name=key,value=` + secret + `"]}]`,
+	})
+
+	var audit bytes.Buffer
+	auditLogger := log.New()
+	auditLogger.SetOutput(&audit)
+	auditLogger.SetFormatter(&log.JSONFormatter{})
+
+	s, err := mcplib.New(pveURL, fakeToken, auditLogger, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "create_notification_endpoint", map[string]any{
+		"type": "webhook", "name": "chat", "url": "https://chat.example.com/{{ secrets.key }}", "method": "post",
+		"secret": []any{"key=" + secret},
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	if strings.Contains(audit.String(), base64.StdEncoding.EncodeToString([]byte(secret))) {
+		t.Errorf("audit log contains the webhook secret: %s", audit.String())
+	}
+
+	res = callTool(t, s, "get_notification_endpoint", map[string]any{"type": "gotify", "name": "push"})
+	if res.IsError || strings.Contains(resultText(res), secret) {
+		t.Errorf("expected the gotify token to be redacted, got %q", resultText(res))
+	}
+
+	res = callTool(t, s, "list_notification_endpoints", map[string]any{"type": "webhook"})
+	if res.IsError || strings.Contains(resultText(res), secret) || !strings.Contains(resultText(res), "name=key") {
+		t.Errorf("expected the webhook secret value to be redacted, got %q", resultText(res))
+	}
+
+	res = callTool(t, s, "create_notification_endpoint", map[string]any{
+		"type": "gotify", "name": "push", "server": "https://gotify.example.com",
+	})
+	if !res.IsError || !strings.Contains(resultText(res), "token") {
+		t.Errorf("expected missing token error, got %q", resultText(res))
+	}
+}
+
+func TestCertificateExpiryReport(t *testing.T) {
+	now := time.Now()
+	cert := func(name string, days int) string {
+		return fmt.Sprintf(`{"filename":%q,"subject":"CN=pve","issuer":"CN=CA","notbefore":%d,"notafter":%d}`,
+			name, now.Add(-24*time.Hour).Unix(), now.Add(time.Duration(days)*24*time.Hour+time.Hour).Unix())
+	}
+	s := newFakePVEServer(t, map[string]string{
+		"GET /nodes": `[{"node":"pve1","status":"online"},{"node":"pve2","status":"online"},` +
+			`{"node":"pve3","status":"offline"}]`,
+		"GET /nodes/pve1/certificates/info": `[` + cert("pve-root-ca.pem", 3000) + `,` +
+			cert("pveproxy-ssl.pem", 10) + `]`,
+		"GET /nodes/pve2/certificates/info": `[` + cert("pveproxy-ssl.pem", -3) + `,` +
+			cert("pve-ssl.pem", -1) + `]`,
+	})
+
+	res := callTool(t, s, "get_certificate_expiry_report", map[string]any{"days": "14"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var report struct {
+		Status       string   `json:"status"`
+		Findings     []string `json:"findings"`
+		Certificates []struct {
+			Node     string `json:"node"`
+			DaysLeft int    `json:"days_left"`
+			Status   string `json:"status"`
+		} `json:"certificates"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Status != "CRITICAL" {
+		t.Errorf("expected status CRITICAL, got %s", report.Status)
+	}
+	if len(report.Findings) != 4 {
+		t.Errorf("expected 4 findings (offline, expiring, 2 expired), got %v", report.Findings)
+	}
+	// pve-ssl.pem expired 23 hours ago.
+	if len(report.Certificates) != 4 || report.Certificates[0].Status != "EXPIRED" ||
+		report.Certificates[1].Status != "EXPIRED" || report.Certificates[1].DaysLeft != -1 ||
+		report.Certificates[2].Status != "EXPIRING" || report.Certificates[2].DaysLeft != 10 ||
+		report.Certificates[3].Status != "OK" {
+		t.Errorf("unexpected certificates: %+v", report.Certificates)
+	}
+}
+
+func TestShutdownGuestReturnsPowerState(t *testing.T) {
+	const upid = "UPID:pve1:0000ABCD:00000001:65000000:qmshutdown:100:root@pam:"
+	s := newFakePVEServer(t, map[string]string{
+		"POST /nodes/pve1/qemu/100/status/shutdown":  `"` + upid + `"`,
+		"GET /nodes/pve1/tasks/" + upid + "/status":  `{"status":"stopped","exitstatus":"OK"}`,
+		"GET /nodes/pve1/qemu/100/status/current":    `{"status":"stopped","qmpstatus":"stopped"}`,
+		"GET /nodes/pve1/qemu/101/status/current":    `{"status":"running","qmpstatus":"running"}`,
+		"PUT /nodes/pve1/qemu/101/sendkey":           `null`,
+		"POST /nodes/pve1/lxc/200/status/reset":      `null`,
+		"POST /nodes/pve1/qemu/100/status/hibernate": `null`,
+	})
+
+	res := callTool(t, s, "shutdown_guest", map[string]any{"node": "pve1", "vmid": "100", "timeout": "30"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var state struct {
+		Status     string `json:"status"`
+		ExitStatus string `json:"exitstatus"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &state); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if state.Status != "stopped" || state.ExitStatus != "OK" {
+		t.Errorf("unexpected power state: %+v", state)
+	}
+
+	res = callTool(t, s, "reset_guest", map[string]any{"node": "pve1", "vmid": "200", "type": "lxc"})
+	if !res.IsError {
+		t.Errorf("expected reset of a container to be refused")
+	}
+
+	res = callTool(t, s, "send_guest_key", map[string]any{"node": "pve1", "vmid": "101", "key": "ctrl-alt-delete"})
+	if res.IsError || !strings.Contains(resultText(res), `"running"`) {
+		t.Errorf("unexpected sendkey result: %q", resultText(res))
+	}
+	res = callTool(t, s, "send_guest_key", map[string]any{"node": "pve1", "vmid": "101", "key": "ctrl alt;rm"})
+	if !res.IsError {
+		t.Errorf("expected invalid key to be refused")
+	}
+	res = callTool(t, s, "send_guest_key", map[string]any{"node": "pve1", "vmid": "200", "type": "lxc", "key": "ret"})
+	if !res.IsError || !strings.Contains(resultText(res), "only supported for VMs") {
+		t.Errorf("expected sendkey to a container to be refused, got %q", resultText(res))
+	}
+
+	res = callTool(t, s, "stop_guest", map[string]any{"node": "pve1", "vmid": "100", "action": "hibernate"})
+	if !res.IsError {
+		t.Errorf("expected stop_guest to refuse unsupported actions")
+	}
+}
+
+func TestBulkGuestAction(t *testing.T) {
+	const (
+		upidOK   = "UPID:pve1:00000001:00000001:65000000:qmstart:100:root@pam:"
+		upidFail = "UPID:pve2:00000002:00000001:65000000:qmstart:102:root@pam:"
+	)
+	s := newFakePVEServer(t, map[string]string{
+		"GET /cluster/resources": `[
+			{"vmid":100,"name":"web-1","node":"pve1","type":"qemu","status":"stopped","tags":"prod;web"},
+			{"vmid":101,"name":"web-2","node":"pve1","type":"qemu","status":"running","tags":"web"},
+			{"vmid":102,"name":"web-3","node":"pve2","type":"lxc","status":"stopped","tags":"web"},
+			{"vmid":103,"name":"db-1","node":"pve2","type":"qemu","status":"stopped","tags":"web"},
+			{"vmid":104,"name":"web-tpl","node":"pve2","type":"qemu","status":"stopped","tags":"web","template":1}
+		]`,
+		"POST /nodes/pve1/qemu/100/status/start":      `"` + upidOK + `"`,
+		"GET /nodes/pve1/tasks/" + upidOK + "/status": `{"status":"stopped","exitstatus":"OK"}`,
+		"POST /nodes/pve2/lxc/102/status/start":       `"` + upidFail + `"`,
+		"GET /nodes/pve2/tasks/" + upidFail + "/status": `{"status":"stopped",` +
+			`"exitstatus":"startup for container '102' failed"}`,
+	})
+
+	res := callTool(t, s, "bulk_guest_action", map[string]any{
+		"action": "start", "tag": "web", "name_pattern": "web-*", "concurrency": "2",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var report struct {
+		Selected int `json:"selected"`
+		OK       int `json:"ok"`
+		Failed   int `json:"failed"`
+		Skipped  int `json:"skipped"`
+		Results  []struct {
+			VMID   int    `json:"vmid"`
+			Result string `json:"result"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if report.Selected != 3 || report.OK != 1 || report.Failed != 1 || report.Skipped != 1 {
+		t.Errorf("unexpected counts: %+v", report)
+	}
+	want := map[int]string{100: "ok", 101: "skipped", 102: "failed"}
+	for _, r := range report.Results {
+		if want[r.VMID] != r.Result {
+			t.Errorf("guest %d: expected %s, got %s", r.VMID, want[r.VMID], r.Result)
+		}
+	}
+
+	res = callTool(t, s, "bulk_guest_action", map[string]any{"action": "start"})
+	if !res.IsError {
+		t.Errorf("expected a call without selector to be refused")
+	}
+}
+
+func TestStartAllGuestsPoolScope(t *testing.T) {
+	const upid = "UPID:pve1:00000001:00000001:65000000:startall::root@pam:"
+	var gotVMs string
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/api2/json") {
+		case "/cluster/resources":
+			_, _ = w.Write([]byte(`{"data":[{"vmid":100,"node":"pve1","pool":"team-a"},` +
+				`{"vmid":101,"node":"pve1","pool":"team-b"},{"vmid":102,"node":"pve2","pool":"team-a"}]}`))
+		case "/nodes/pve1/startall":
+			_ = r.ParseForm()
+			gotVMs = r.PostForm.Get("vms")
+			_, _ = w.Write([]byte(`{"data":"` + upid + `"}`))
+		case "/nodes/pve1/tasks/" + upid + "/status":
+			_, _ = w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.Error(w, "no route", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{AllowedPools: []string{"team-a"}})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "start_all_guests", map[string]any{"node": "pve1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	if gotVMs != "100" {
+		t.Errorf("expected startall to be limited to vms=100, got %q", gotVMs)
+	}
+}
+
+func TestWaitForTaskLogSkipsEmptyLogPlaceholder(t *testing.T) {
+	const upid = "UPID:pve1:00000001:00000001:65000000:startall::root@pam:"
+	var mu sync.Mutex
+	var polls int
+	var starts []string
+	logLines := []string{"Starting VM 100", "Starting VM 101", "TASK OK"}
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch strings.TrimPrefix(r.URL.Path, "/api2/json") {
+		case "/nodes/pve1/startall":
+			_, _ = w.Write([]byte(`{"data":"` + upid + `"}`))
+		case "/nodes/pve1/tasks/" + upid + "/status":
+			polls++
+			status := "running"
+			if polls > 1 {
+				status = "stopped"
+			}
+			_, _ = w.Write([]byte(`{"data":{"status":"` + status + `","exitstatus":"OK"}}`))
+		case "/nodes/pve1/tasks/" + upid + "/log":
+			start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+			starts = append(starts, r.URL.Query().Get("start"))
+			var out []map[string]any
+			if polls > 1 {
+				for i := start; i < len(logLines); i++ {
+					out = append(out, map[string]any{"n": i + 1, "t": logLines[i]})
+				}
+			}
+			if len(out) == 0 {
+				out = []map[string]any{{"n": 1, "t": "no content"}}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": out})
+		default:
+			http.Error(w, "no route", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	res := callTool(t, s, "start_all_guests", map[string]any{"node": "pve1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	if want := strings.Join(logLines, "\n"); !strings.HasSuffix(resultText(res), "\n"+want) {
+		t.Errorf("expected the complete log without placeholder, got %q", resultText(res))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(starts, ",") != "0,0" {
+		t.Errorf("expected the log to be read from line 0 until it had content, got starts %v", starts)
+	}
+}
+
+func TestDrainAndUndrainNode(t *testing.T) {
+	const gib = 1 << 30
+	resources := fmt.Sprintf(`[
+		{"vmid":100,"name":"web","node":"pve1","type":"qemu","status":"running","maxmem":%d},
+		{"vmid":101,"name":"dns","node":"pve1","type":"lxc","status":"running","maxmem":%d},
+		{"vmid":102,"name":"old","node":"pve1","type":"qemu","status":"stopped","maxmem":%d},
+		{"vmid":103,"name":"db","node":"pve2","type":"qemu","status":"running","maxmem":%d}
+	]`, 4*gib, gib, 8*gib, 2*gib)
+	nodes := fmt.Sprintf(`[
+		{"node":"pve1","status":"online","maxmem":%d,"mem":%d},
+		{"node":"pve2","status":"online","maxmem":%d,"mem":%d,"cpu":0.5,"maxcpu":8},
+		{"node":"pve3","status":"online","maxmem":%d,"mem":%d,"cpu":0.1,"maxcpu":8},
+		{"node":"pve4","status":"offline","maxmem":%d,"mem":0}
+	]`, 16*gib, 8*gib, 16*gib, 10*gib, 16*gib, 11*gib, 64*gib)
+
+	migrations := map[string]url.Values{}
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/api2/json")
+		switch {
+		case path == "/cluster/resources":
+			_, _ = w.Write([]byte(`{"data":` + resources + `}`))
+		case path == "/cluster/ha/resources":
+			_, _ = w.Write([]byte(`{"data":[]}`))
+		case path == "/nodes":
+			_, _ = w.Write([]byte(`{"data":` + nodes + `}`))
+		case strings.HasSuffix(path, "/migrate"):
+			_ = r.ParseForm()
+			migrations[path] = r.PostForm
+			node := strings.Split(path, "/")[2]
+			_, _ = fmt.Fprintf(w, `{"data":"UPID:%s:00000001:00000001:65000000:qmigrate:1:root@pam:"}`, node)
+		case strings.HasSuffix(path, "/status") && strings.Contains(path, "/tasks/"):
+			_, _ = w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.Error(w, "no route for "+path, http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	stateDir := t.TempDir()
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{StateDir: stateDir})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	text, isErr, progress := callToolWithProgress(t, s, "drain_node", map[string]any{
+		"node": "pve1", "parallel": "1", "with_local_disks": "1",
+	})
+	if isErr {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	if !slices.Equal(progress, []float64{1, 2, 3}) {
+		t.Errorf("expected progress [1 2 3], got %v", progress)
+	}
+	want := map[string]url.Values{
+		"/nodes/pve1/qemu/100/migrate": {"target": {"pve2"}, "online": {"1"}, "with-local-disks": {"1"}},
+		"/nodes/pve1/lxc/101/migrate":  {"target": {"pve3"}, "restart": {"1"}, "timeout": {"180"}},
+		"/nodes/pve1/qemu/102/migrate": {"target": {"pve2"}, "with-local-disks": {"1"}},
+	}
+	for path, form := range want {
+		if got := migrations[path].Encode(); got != form.Encode() {
+			t.Errorf("%s: expected %q, got %q", path, form.Encode(), got)
+		}
+	}
+	if len(migrations) != len(want) {
+		t.Errorf("expected %d migrations, got %d", len(want), len(migrations))
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "drain-pve1.json")); err != nil {
+		t.Fatalf("expected a drain record: %v", err)
+	}
+
+	res := callTool(t, s, "drain_node", map[string]any{"node": "pve1"})
+	if !res.IsError {
+		t.Errorf("expected a second drain of the same node to be refused")
+	}
+
+	resources = `[
+		{"vmid":100,"name":"web","node":"pve2","type":"qemu","status":"running"},
+		{"vmid":101,"name":"dns","node":"pve3","type":"lxc","status":"running"},
+		{"vmid":103,"name":"db","node":"pve2","type":"qemu","status":"running"}
+	]`
+	clear(migrations)
+	res = callTool(t, s, "undrain_node", map[string]any{"node": "pve1", "parallel": "1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	for _, path := range []string{"/nodes/pve2/qemu/100/migrate", "/nodes/pve3/lxc/101/migrate"} {
+		if migrations[path].Get("target") != "pve1" {
+			t.Errorf("expected %s back to pve1, got %v", path, migrations[path])
+		}
+	}
+	if len(migrations) != 2 {
+		t.Errorf("expected 2 migrations back, got %d", len(migrations))
+	}
+	if migrations["/nodes/pve2/qemu/100/migrate"].Get("with-local-disks") != "1" {
+		t.Errorf("expected the VM to be moved back with its local disks: %v", migrations)
+	}
+	if !strings.Contains(resultText(res), `"record_removed": true`) {
+		t.Errorf("expected the drain record to be removed: %s", resultText(res))
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "drain-pve1.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the drain record to be deleted, got %v", err)
+	}
+}
+
+func TestRollingUpdatePausesAndResumes(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		haMaster = "pve1 (idle, Sat Oct 17 10:00:00 2026)"
+		reboots  []string
+	)
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/api2/json")
+		data := ""
+		switch {
+		case path == "/nodes":
+			data = `[{"node":"pve2","status":"online"},{"node":"pve1","status":"online"}]`
+		case path == "/storage":
+			data = `[{"storage":"local","type":"dir"}]`
+		case path == "/cluster/status":
+			data = `[{"type":"cluster","quorate":1},{"type":"node","name":"pve1","online":1},` +
+				`{"type":"node","name":"pve2","online":1}]`
+		case path == "/cluster/ha/status/current":
+			data = `[{"type":"quorum","status":"OK"},{"type":"master","status":"` + haMaster + `"},` +
+				`{"type":"service","status":"started"}]`
+		case path == "/cluster/resources", path == "/cluster/ha/resources":
+			data = `[]`
+		case r.Method == http.MethodPost && strings.HasSuffix(path, "/status"):
+			reboots = append(reboots, strings.Split(path, "/")[2])
+			data = `null`
+		case strings.HasSuffix(path, "/status"):
+			data = `{"uptime":0}`
+		default:
+			http.Error(w, "no route for "+path, http.StatusNotImplemented)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":` + data + `}`))
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{AllowElevated: true, StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	waitFor := func(id, status string) map[string]any {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for {
+			res := callTool(t, s, "get_rolling_update", map[string]any{"id": id})
+			var u map[string]any
+			if err := json.Unmarshal([]byte(resultText(res)), &u); err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if u["status"] == status {
+				return u
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected status %s, got %v", status, u)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	res := callTool(t, s, "start_rolling_update", map[string]any{"upgrade": "0", "gate_timeout": "1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	id := strings.Fields(resultText(res))[2]
+
+	u := waitFor(id, "paused")
+	if u["step"] != "check" || !strings.Contains(u["error"].(string), "HA manager is not active") {
+		t.Errorf("expected the first health gate to pause the update, got %v", u)
+	}
+	res = callTool(t, s, "start_rolling_update", map[string]any{"upgrade": "0"})
+	if !res.IsError {
+		t.Error("expected a second rolling update to be refused while one is paused")
+	}
+
+	mu.Lock()
+	haMaster = "pve1 (active, Sat Oct 17 10:00:00 2026)"
+	mu.Unlock()
+	res = callTool(t, s, "resume_rolling_update", map[string]any{"id": id})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	waitFor(id, "completed")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(reboots, ",") != "pve1,pve2" {
+		t.Errorf("expected pve1 and pve2 to be rebooted in order, got %v", reboots)
+	}
+}
+
+func TestPlanAndApplyGuests(t *testing.T) {
+	const upid = "UPID:pve1:00000001:00000001:65000000:qmconfig:100:root@pam:"
+	var (
+		mu       sync.Mutex
+		requests = map[string]url.Values{}
+	)
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		path := strings.TrimPrefix(r.URL.Path, "/api2/json")
+		data := ""
+		switch {
+		case path == "/cluster/resources":
+			data = `[{"vmid":100,"name":"web-1","node":"pve1","type":"qemu","status":"running","pool":"prod"}]`
+		case r.Method == http.MethodGet && path == "/nodes/pve1/qemu/100/config":
+			data = `{"name":"web-1","memory":"2048","cores":2,"tags":"web","digest":"abc123",` +
+				`"scsi0":"local-lvm:vm-100-disk-0,size=32G",` +
+				`"net0":"virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1"}`
+		case strings.Contains(path, "/tasks/"):
+			data = `{"status":"stopped","exitstatus":"OK"}`
+		case r.Method == http.MethodPost || r.Method == http.MethodPut:
+			_ = r.ParseForm()
+			requests[r.Method+" "+path] = r.PostForm
+			data = `"` + upid + `"`
+			if strings.HasSuffix(path, "/resize") {
+				data = `null`
+			}
+		default:
+			http.Error(w, "no route for "+path, http.StatusNotImplemented)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":` + data + `}`))
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	spec := `
+guests:
+  - vmid: 100
+    name: web-1
+    memory: 4096
+    disks: {scsi0: {size: 40G}}
+    nics: {net0: {bridge: vmbr1}}
+    tags: [web, prod]
+    pool: staging
+  - vmid: 101
+    name: web-2
+    node: pve1
+    pool: staging
+    memory: 1024
+    disks: {scsi0: {storage: local-lvm, size: 8G, options: "discard=on"}}
+    nics: {net0: {bridge: vmbr0, tag: 10}}
+`
+	res := callTool(t, s, "plan_guests", map[string]any{"spec": spec})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var plan struct {
+		ID    string `json:"id"`
+		Steps []struct {
+			Action string            `json:"action"`
+			VMID   int               `json:"vmid"`
+			Reboot bool              `json:"reboot"`
+			Digest string            `json:"digest"`
+			Params map[string]string `json:"params"`
+		} `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &plan); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	var actions []string
+	for _, st := range plan.Steps {
+		actions = append(actions, fmt.Sprintf("%s %d", st.Action, st.VMID))
+	}
+	if strings.Join(actions, ",") != "update 100,resize 100,pool 100,create 101" {
+		t.Fatalf("unexpected steps: %v", actions)
+	}
+	update := plan.Steps[0]
+	if !update.Reboot || update.Digest != "abc123" {
+		t.Errorf("expected the memory change to need a reboot and carry the digest: %+v", update)
+	}
+	wantUpdate := map[string]string{
+		"memory": "4096",
+		"tags":   "prod;web",
+		"net0":   "virtio=BC:24:11:00:00:01,bridge=vmbr1,firewall=1",
+	}
+	if fmt.Sprint(update.Params) != fmt.Sprint(wantUpdate) {
+		t.Errorf("update params: expected %v, got %v", wantUpdate, update.Params)
+	}
+
+	// A spec matching the live config is not saved, so it gets no plan ID.
+	res = callTool(t, s, "plan_guests", map[string]any{"spec": "guests:\n  - vmid: 100\n    memory: 2048\n"})
+	if res.IsError || !strings.Contains(resultText(res), `"status": "up to date"`) ||
+		strings.Contains(resultText(res), `"id"`) {
+		t.Errorf("expected an up to date plan without ID, got %s", resultText(res))
+	}
+
+	res = callTool(t, s, "apply_guest_plan", map[string]any{"plan_id": plan.ID})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	got := requests["POST /nodes/pve1/qemu/100/config"]
+	if got.Get("digest") != "abc123" || got.Get("memory") != "4096" {
+		t.Errorf("unexpected config update: %v", got)
+	}
+	if got = requests["PUT /nodes/pve1/qemu/100/resize"]; got.Get("size") != "40G" || got.Get("digest") != "" {
+		t.Errorf("unexpected resize: %v", got)
+	}
+	if got = requests["PUT /pools/staging"]; got.Get("vms") != "100" {
+		t.Errorf("unexpected pool move: %v", got)
+	}
+	create := requests["POST /nodes/pve1/qemu"]
+	if create.Get("scsi0") != "local-lvm:8,discard=on" || create.Get("net0") != "virtio,bridge=vmbr0,tag=10" ||
+		create.Get("pool") != "staging" {
+		t.Errorf("unexpected create: %v", create)
+	}
+
+	res = callTool(t, s, "apply_guest_plan", map[string]any{"plan_id": plan.ID})
+	if !res.IsError {
+		t.Error("expected an applied plan to be refused")
+	}
+}
+
+func TestDetectDrift(t *testing.T) {
+	var mu sync.Mutex
+	rule := func(pos int, port string) string {
+		return fmt.Sprintf(`{"pos":%d,"type":"in","action":"ACCEPT","dport":%q}`, pos, port)
+	}
+	routes := map[string]string{
+		"/cluster/resources":                  `[{"vmid":100,"name":"web","node":"pve1","type":"qemu"}]`,
+		"/nodes/pve1/qemu/100/config":         `{"memory":"2048","cores":2,"cipassword":"**********","digest":"a1"}`,
+		"/nodes/pve1/qemu/100/pending":        `[{"key":"memory","value":"2048"},{"key":"cores","value":2}]`,
+		"/cluster/firewall/rules":             "[" + rule(0, "22") + "," + rule(1, "80") + "," + rule(2, "443") + "]",
+		"/nodes/pve1/qemu/100/firewall/rules": `[]`,
+		"/storage":                            `[{"storage":"local","type":"dir","content":"iso,vztmpl"}]`,
+		"/cluster/ha/resources":               `[{"sid":"vm:100","state":"started"}]`,
+	}
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		data, ok := routes[strings.TrimPrefix(r.URL.Path, "/api2/json")]
+		if !ok {
+			http.Error(w, "no route", http.StatusNotImplemented)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":` + data + `}`))
+	}))
+	t.Cleanup(pve.Close)
+
+	var posted []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		posted, _ = io.ReadAll(r.Body)
+	}))
+	t.Cleanup(hook.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "create_drift_baseline", map[string]any{
+		"name": "prod", "vmids": []any{"100"}, "storages": "1", "firewall": "1", "ha": "1",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	mu.Lock()
+	routes["/nodes/pve1/qemu/100/config"] = `{"memory":"4096","cores":2,"cipassword":"changed","digest":"a2"}`
+	routes["/nodes/pve1/qemu/100/pending"] = `[{"key":"memory","value":"4096"},{"key":"cores","value":2,"pending":4}]`
+	routes["/storage"] = `[{"storage":"local","type":"dir","content":"iso"}]`
+	routes["/cluster/ha/resources"] = `[]`
+	// A rule inserted at the top and 443 moved before 22: only 443 moved.
+	routes["/cluster/firewall/rules"] = "[" + rule(0, "8006") + "," + rule(1, "443") + "," + rule(2, "22") + "," +
+		rule(3, "80") + "]"
+	mu.Unlock()
+
+	res = callTool(t, s, "schedule_drift_check", map[string]any{
+		"name": "prod", "interval_minutes": "60", "webhook_url": hook.URL + "/drift?token=secret",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	t.Cleanup(func() {
+		callTool(t, s, "schedule_drift_check", map[string]any{"name": "prod", "interval_minutes": "0"})
+	})
+
+	res = callTool(t, s, "detect_drift", map[string]any{"name": "prod", "notify": "1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var report struct {
+		Findings []struct {
+			Kind     string `json:"kind"`
+			ID       string `json:"id"`
+			Field    string `json:"field"`
+			Change   string `json:"change"`
+			Baseline string `json:"baseline"`
+			Live     string `json:"live"`
+		} `json:"findings"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &report); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	var got []string
+	for _, f := range report.Findings {
+		got = append(got, fmt.Sprintf("%s %s %s %s %s->%s", f.Kind, f.ID, f.Field, f.Change, f.Baseline, f.Live))
+	}
+	want := []string{
+		"guest 100 memory changed 2048->4096",
+		"pending 100 cores pending change 2->4",
+		"storage local content changed iso,vztmpl->iso",
+		"firewall cluster/action=ACCEPT,dport=8006,type=in  added ->",
+		"firewall cluster/action=ACCEPT,dport=443,type=in pos moved 2->1",
+		"ha vm:100  removed ->",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !bytes.Contains(posted, []byte(`"field":"memory"`)) {
+		t.Errorf("expected the findings to be posted to the webhook, got %s", posted)
+	}
+	res = callTool(t, s, "list_drift_baselines", nil)
+	if strings.Contains(resultText(res), "secret") {
+		t.Errorf("webhook token must not be listed: %s", resultText(res))
+	}
+}
+
+func TestConfigHistoryAndRevert(t *testing.T) {
+	var mu sync.Mutex
+	conf := map[string]string{"memory": "2048", "cores": "2", "scsi0": "local:vm-100-disk-0,size=32G"}
+	version := 1
+	var reverts []url.Values
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		digest := fmt.Sprintf("d%d", version)
+		switch r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api2/json") {
+		case "GET /cluster/resources":
+			_, _ = w.Write([]byte(`{"data":[{"vmid":100,"node":"pve1","type":"qemu"}]}`))
+		case "GET /nodes/pve1/qemu/100/config":
+			out := map[string]string{"digest": digest}
+			for k, v := range conf {
+				out[k] = v
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"data": out})
+		case "PUT /nodes/pve1/qemu/100/config":
+			_ = r.ParseForm()
+			if d := r.PostForm.Get("digest"); d != "" {
+				if d != digest {
+					http.Error(w, "config digest mismatch", http.StatusBadRequest)
+					return
+				}
+				reverts = append(reverts, r.PostForm)
+			}
+			for k := range r.PostForm {
+				if k != "digest" && k != "delete" {
+					conf[k] = r.PostForm.Get(k)
+				}
+			}
+			for _, k := range strings.Split(r.PostForm.Get("delete"), ",") {
+				delete(conf, k)
+			}
+			version++
+			_, _ = w.Write([]byte(`{"data":null}`))
+		case "PUT /nodes/pve1/qemu/100/resize":
+			conf["scsi0"] = "local:vm-100-disk-0,size=40G"
+			version++
+			_, _ = w.Write([]byte(`{"data":null}`))
+		default:
+			http.Error(w, "no route", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	guest := map[string]any{"node": "pve1", "vmid": "100"}
+	for _, args := range []map[string]any{
+		{"memory": "4096", "description": "web"},
+		{"cores": "4"},
+	} {
+		for k, v := range guest {
+			args[k] = v
+		}
+		if res := callTool(t, s, "update_guest_config", args); res.IsError {
+			t.Fatalf("unexpected error: %s", resultText(res))
+		}
+	}
+	res := callTool(t, s, "resize_guest_disk", map[string]any{"node": "pve1", "vmid": "100", "disk": "scsi0",
+		"size": "40G"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	type change struct {
+		ID      string `json:"id"`
+		Tool    string `json:"tool"`
+		Changes []struct {
+			Field  string `json:"field"`
+			Before string `json:"before"`
+			After  string `json:"after"`
+		} `json:"changes"`
+		RevertOf string `json:"revert_of"`
+		Reverted string `json:"reverted_by"`
+	}
+	history := func() []change {
+		t.Helper()
+		res := callTool(t, s, "get_config_history", map[string]any{"vmid": "100"})
+		if res.IsError {
+			t.Fatalf("unexpected error: %s", resultText(res))
+		}
+		var changes []change
+		if err := json.Unmarshal([]byte(resultText(res)), &changes); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return changes
+	}
+	changes := history()
+	if len(changes) != 3 || changes[0].Tool != "resize_guest_disk" || changes[2].Tool != "update_guest_config" {
+		t.Fatalf("unexpected history: %+v", changes)
+	}
+	var got []string
+	for _, ch := range changes[2].Changes {
+		got = append(got, ch.Field+" "+ch.Before+"->"+ch.After)
+	}
+	if want := "memory 2048->4096,description ->web"; strings.Join(got, ",") != want {
+		t.Errorf("unexpected changes %q, want %q", strings.Join(got, ","), want)
+	}
+
+	res = callTool(t, s, "revert_config_change", map[string]any{"vmid": "100", "change_id": changes[0].ID})
+	if !res.IsError || !strings.Contains(resultText(res), "cannot be shrunk") {
+		t.Errorf("expected a disk growth to be refused, got %s", resultText(res))
+	}
+
+	mu.Lock()
+	conf["cores"] = "8"
+	version++
+	mu.Unlock()
+	res = callTool(t, s, "revert_config_change", map[string]any{"vmid": "100", "change_id": changes[1].ID})
+	if !res.IsError || !strings.Contains(resultText(res), "cores: expected") {
+		t.Errorf("expected a conflict, got %s", resultText(res))
+	}
+	res = callTool(t, s, "revert_config_change", map[string]any{"vmid": "100", "change_id": changes[2].ID})
+	if !res.IsError || !strings.Contains(resultText(res), "changed since") {
+		t.Errorf("expected a digest mismatch, got %s", resultText(res))
+	}
+
+	res = callTool(t, s, "revert_config_change", map[string]any{"vmid": "100", "change_id": changes[2].ID,
+		"force": "1"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	mu.Lock()
+	if len(reverts) != 1 || reverts[0].Get("memory") != "2048" || reverts[0].Get("delete") != "description" ||
+		reverts[0].Get("digest") == "" {
+		t.Errorf("unexpected revert requests: %v", reverts)
+	}
+	if conf["memory"] != "2048" || conf["description"] != "" || conf["cores"] != "8" {
+		t.Errorf("unexpected config after revert: %v", conf)
+	}
+	mu.Unlock()
+
+	changes = history()
+	if len(changes) != 4 || changes[0].RevertOf != changes[3].ID || changes[3].Reverted != changes[0].ID {
+		t.Errorf("expected the revert to be linked to the change: %+v", changes)
+	}
+	res = callTool(t, s, "revert_config_change", map[string]any{"vmid": "100", "change_id": changes[3].ID})
+	if !res.IsError || !strings.Contains(resultText(res), "already reverted") {
+		t.Errorf("expected a second revert to be refused, got %s", resultText(res))
+	}
+
+	res = callTool(t, s, "set_cloudinit_config", map[string]any{"node": "pve1", "vmid": "100", "ciuser": "admin"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	changes = history()
+	if len(changes) != 5 || changes[0].Tool != "set_cloudinit_config" || len(changes[0].Changes) != 1 ||
+		changes[0].Changes[0].Field != "ciuser" {
+		t.Errorf("expected the cloud-init change to be recorded: %+v", changes)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// progressFunc reports the progress of a long-running tool call.
+type progressFunc func(progress, total float64, message string)
+
+// progressReporter returns a progressFunc sending notifications/progress to
+// the client. It does nothing when the client did not ask for progress by
+// setting a progress token on the request.
+func progressReporter(ctx context.Context, req mcp.CallToolRequest) progressFunc {
+	srv := server.ServerFromContext(ctx)
+	if srv == nil || req.Params.Meta == nil || req.Params.Meta.ProgressToken == nil {
+		return func(float64, float64, string) {}
+	}
+	token := req.Params.Meta.ProgressToken
+
+	return func(progress, total float64, message string) {
+		params := map[string]any{
+			"progressToken": token,
+			"progress":      progress,
+		}
+		if total > 0 {
+			params["total"] = total
+		}
+		if message != "" {
+			params["message"] = message
+		}
+		// Progress is best effort; a client that went away must not fail the call.
+		_ = srv.SendNotificationToClient(ctx, "notifications/progress", params)
+	}
+}
@@ -4,13 +4,18 @@
 package mcp
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
@@ -39,7 +44,123 @@ func NewProxmoxClient(baseURL, token string, logger *log.Logger) *ProxmoxClient
 	}
 }
 
-func (c *ProxmoxClient) logRequest(method, path string, statusCode, respBytes int, duration time.Duration, err error) {
+// sensitiveParamRe matches parameter and field names holding secrets
+// (passwords, API and notification tokens, private keys, console tickets, ...).
+var sensitiveParamRe = regexp.MustCompile(`(?i)(password|secret|token|key|keyring|hmac|ticket)$`)
+
+// auditParamRe matches the request parameters whose values are written to the
+// audit log. Other parameters are logged by name only, since they may carry
+// credentials, file contents or command input.
+var auditParamRe = regexp.MustCompile(`^(action|cores|datastore|disk|format|memory|mode|name|node|` +
+	`pool|poolid|server|share|size|sockets|storage|target|type|userid|username|vmid|vms)$`)
+
+// maxAuditParamLength bounds logged parameter values.
+const maxAuditParamLength = 256
+
+// redactParams returns a copy of params with sensitive values replaced and
+// long values truncated.
+func redactParams(params url.Values) url.Values {
+	redacted := make(url.Values, len(params))
+	for k, values := range params {
+		for _, v := range values {
+			switch {
+			case sensitiveParamRe.MatchString(k):
+				v = "[REDACTED]"
+			case len(v) > maxAuditParamLength:
+				v = v[:maxAuditParamLength] + "..."
+			}
+			redacted.Add(k, v)
+		}
+	}
+	return redacted
+}
+
+// auditParams encodes params for the audit log, keeping only the values of
+// parameters matched by auditParamRe.
+func auditParams(params url.Values) string {
+	logged := make(url.Values, len(params))
+	for k, values := range redactParams(params) {
+		for _, v := range values {
+			if !auditParamRe.MatchString(k) {
+				v = "[REDACTED]"
+			}
+			logged.Add(k, v)
+		}
+	}
+	return logged.Encode()
+}
+
+// redactPath redacts sensitive values in the query string of path.
+func redactPath(path string) string {
+	p, rawQuery, found := strings.Cut(path, "?")
+	if !found {
+		return path
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return p + "?[REDACTED]"
+	}
+	return p + "?" + redactParams(q).Encode()
+}
+
+// redactResponseSecrets replaces the values of sensitive fields, and of the
+// fields named in extra, in an API response returned to the client. Names of
+// "name=...,value=..." entries (e.g. webhook secrets) are kept so they can
+// still be referenced.
+func redactResponseSecrets(result string, extra ...string) string {
+	var v any
+	if err := json.Unmarshal([]byte(result), &v); err != nil {
+		return result
+	}
+	out, err := json.MarshalIndent(redactSecretValues(v, extra), "", "  ")
+	if err != nil {
+		return result
+	}
+	return string(out)
+}
+
+func redactSecretValues(v any, extra []string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if !sensitiveParamRe.MatchString(k) && !slices.Contains(extra, k) {
+				val[k] = redactSecretValues(item, extra)
+				continue
+			}
+			if list, ok := item.([]any); ok {
+				for i, entry := range list {
+					list[i] = redactSecretEntry(entry)
+				}
+				continue
+			}
+			val[k] = "[REDACTED]"
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = redactSecretValues(item, extra)
+		}
+	}
+	return v
+}
+
+func redactSecretEntry(entry any) any {
+	if m, ok := entry.(map[string]any); ok {
+		if _, hasValue := m["value"]; hasValue {
+			m["value"] = "[REDACTED]"
+		}
+		return m
+	}
+	if s, ok := entry.(string); ok {
+		if props := parsePropertyString(s); props["name"] != "" {
+			return "name=" + props["name"] + ",value=[REDACTED]"
+		}
+	}
+	return "[REDACTED]"
+}
+
+func (c *ProxmoxClient) logRequest(method, path string, params url.Values, statusCode, respBytes int,
+	duration time.Duration, err error,
+) {
 	if c.Logger == nil {
 		return
 	}
@@ -48,10 +169,14 @@ func (c *ProxmoxClient) logRequest(method, path string, statusCode, respBytes in
 		"event.category": "api",
 		"event.action":   "proxmox_api_call",
 		"http.method":    method,
-		"url.path":       path,
+		"url.path":       redactPath(path),
 		"duration_ms":    duration.Milliseconds(),
 	}
 
+	if len(params) > 0 {
+		fields["request.params"] = auditParams(params)
+	}
+
 	if statusCode > 0 {
 		fields["http.status"] = statusCode
 	}
@@ -71,26 +196,48 @@ type apiResponse struct {
 	Data json.RawMessage `json:"data"`
 }
 
-func (c *ProxmoxClient) do(ctx context.Context, method, path string, body io.Reader) (string, error) {
+func (c *ProxmoxClient) do(ctx context.Context, method, path string, data url.Values) (string, error) {
+	var (
+		body        io.Reader
+		contentType string
+	)
+	if data != nil {
+		body = strings.NewReader(data.Encode())
+		if method == http.MethodPost || method == http.MethodPut {
+			contentType = "application/x-www-form-urlencoded"
+		}
+	}
+	return c.send(ctx, method, path, data, body, contentType, -1)
+}
+
+// send performs the request and returns the pretty-printed response data.
+// params are only used for the audit log. contentLength is set on the request
+// when it is not negative.
+func (c *ProxmoxClient) send(ctx context.Context, method, path string, params url.Values, body io.Reader,
+	contentType string, contentLength int64,
+) (string, error) {
 	start := time.Now()
 	u := c.BaseURL + "/api2/json" + path
 
 	req, err := http.NewRequestWithContext(ctx, method, u, body)
 	if err != nil {
 		reqErr := fmt.Errorf("creating request: %w", err)
-		c.logRequest(method, path, 0, 0, time.Since(start), reqErr)
+		c.logRequest(method, path, params, 0, 0, time.Since(start), reqErr)
 		return "", reqErr
 	}
+	if contentLength >= 0 {
+		req.ContentLength = contentLength
+	}
 
 	req.Header.Set("Authorization", "PVEAPIToken="+c.Token)
-	if body != nil && (method == http.MethodPost || method == http.MethodPut) {
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
 	}
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
 		reqErr := fmt.Errorf("request failed: %w", err)
-		c.logRequest(method, path, 0, 0, time.Since(start), reqErr)
+		c.logRequest(method, path, params, 0, 0, time.Since(start), reqErr)
 		return "", reqErr
 	}
 	defer resp.Body.Close()
@@ -98,24 +245,24 @@ func (c *ProxmoxClient) do(ctx context.Context, method, path string, body io.Rea
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		readErr := fmt.Errorf("reading response: %w", err)
-		c.logRequest(method, path, resp.StatusCode, 0, time.Since(start), readErr)
+		c.logRequest(method, path, params, resp.StatusCode, 0, time.Since(start), readErr)
 		return "", readErr
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		apiErr := fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
-		c.logRequest(method, path, resp.StatusCode, len(respBody), time.Since(start), apiErr)
+		c.logRequest(method, path, params, resp.StatusCode, len(respBody), time.Since(start), apiErr)
 		return "", apiErr
 	}
 
 	var apiResp apiResponse
 	if err := json.Unmarshal(respBody, &apiResp); err != nil {
 		parseErr := fmt.Errorf("parsing response: %w", err)
-		c.logRequest(method, path, resp.StatusCode, len(respBody), time.Since(start), parseErr)
+		c.logRequest(method, path, params, resp.StatusCode, len(respBody), time.Since(start), parseErr)
 		return "", parseErr
 	}
 
-	c.logRequest(method, path, resp.StatusCode, len(respBody), time.Since(start), nil)
+	c.logRequest(method, path, params, resp.StatusCode, len(respBody), time.Since(start), nil)
 
 	var pretty json.RawMessage
 	if err := json.Unmarshal(apiResp.Data, &pretty); err != nil {
@@ -133,19 +280,11 @@ func (c *ProxmoxClient) Get(ctx context.Context, path string) (string, error) {
 }
 
 func (c *ProxmoxClient) Post(ctx context.Context, path string, data url.Values) (string, error) {
-	var body io.Reader
-	if data != nil {
-		body = strings.NewReader(data.Encode())
-	}
-	return c.do(ctx, http.MethodPost, path, body)
+	return c.do(ctx, http.MethodPost, path, data)
 }
 
 func (c *ProxmoxClient) Put(ctx context.Context, path string, data url.Values) (string, error) {
-	var body io.Reader
-	if data != nil {
-		body = strings.NewReader(data.Encode())
-	}
-	return c.do(ctx, http.MethodPut, path, body)
+	return c.do(ctx, http.MethodPut, path, data)
 }
 
 func (c *ProxmoxClient) Delete(ctx context.Context, path string, params url.Values) (string, error) {
@@ -155,3 +294,106 @@ func (c *ProxmoxClient) Delete(ctx context.Context, path string, params url.Valu
 	}
 	return c.do(ctx, http.MethodDelete, p, nil)
 }
+
+// PostFile uploads size bytes read from r as the multipart file field
+// "filename" along with fields. The request body is streamed with a known
+// Content-Length, which pveproxy requires for uploads.
+func (c *ProxmoxClient) PostFile(ctx context.Context, path string, fields url.Values, filename string,
+	r io.Reader, size int64,
+) (string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range fields[k] {
+			if err := mw.WriteField(k, v); err != nil {
+				return "", fmt.Errorf("building upload request: %w", err)
+			}
+		}
+	}
+	if _, err := mw.CreateFormFile("filename", filename); err != nil {
+		return "", fmt.Errorf("building upload request: %w", err)
+	}
+	head := append([]byte(nil), buf.Bytes()...)
+	if err := mw.Close(); err != nil {
+		return "", fmt.Errorf("building upload request: %w", err)
+	}
+	tail := buf.Bytes()[len(head):]
+
+	body := io.MultiReader(bytes.NewReader(head), io.LimitReader(r, size), bytes.NewReader(tail))
+	length := int64(len(head)) + size + int64(len(tail))
+	return c.send(ctx, http.MethodPost, path, fields, body, mw.FormDataContentType(), length)
+}
+
+// Download performs a GET request for a non-JSON response body, such as a
+// file. Bodies larger than limit bytes are refused.
+func (c *ProxmoxClient) Download(ctx context.Context, path string, limit int64) ([]byte, error) {
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api2/json"+path, nil)
+	if err != nil {
+		reqErr := fmt.Errorf("creating request: %w", err)
+		c.logRequest(http.MethodGet, path, nil, 0, 0, time.Since(start), reqErr)
+		return nil, reqErr
+	}
+	req.Header.Set("Authorization", "PVEAPIToken="+c.Token)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		reqErr := fmt.Errorf("request failed: %w", err)
+		c.logRequest(http.MethodGet, path, nil, 0, 0, time.Since(start), reqErr)
+		return nil, reqErr
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		readErr := fmt.Errorf("reading response: %w", err)
+		c.logRequest(http.MethodGet, path, nil, resp.StatusCode, len(body), time.Since(start), readErr)
+		return nil, readErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
+		c.logRequest(http.MethodGet, path, nil, resp.StatusCode, len(body), time.Since(start), apiErr)
+		return nil, apiErr
+	}
+	if int64(len(body)) > limit {
+		sizeErr := fmt.Errorf("response exceeds %d bytes", limit)
+		c.logRequest(http.MethodGet, path, nil, resp.StatusCode, len(body), time.Since(start), sizeErr)
+		return nil, sizeErr
+	}
+	c.logRequest(http.MethodGet, path, nil, resp.StatusCode, len(body), time.Since(start), nil)
+	return body, nil
+}
+
+// GetJSON performs a GET request and decodes the response data into v.
+func (c *ProxmoxClient) GetJSON(ctx context.Context, path string, v any) error {
+	result, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(result), v); err != nil {
+		return fmt.Errorf("parsing response: %w", err)
+	}
+	return nil
+}
+
+// pveBool decodes Proxmox boolean fields, which are returned as 0/1 or true/false.
+type pveBool bool
+
+func (b *pveBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "1", "true":
+		*b = true
+	case "0", "false", "", "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
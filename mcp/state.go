@@ -0,0 +1,129 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stateNameRe matches the names of state files; they are derived from node
+// names and IDs, so anything else is refused to keep them inside the state
+// directory.
+var stateNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var errStateDirNotConfigured = errors.New("state_dir is not configured")
+
+// newStateID returns an ID for a state record: the UTC creation time followed
+// by a random suffix, so IDs sort by age.
+func newStateID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b), nil
+}
+
+func statePath(dir, name string) (string, error) {
+	if dir == "" {
+		return "", errStateDirNotConfigured
+	}
+	if !stateNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid state name %q", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// writeStateFile stores v as JSON in dir/name.json. The file is replaced
+// atomically so that a crash never leaves a truncated record behind.
+func writeStateFile(dir, name string, v any) error {
+	path, err := statePath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("creating state directory: %w", err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // already renamed on success
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// readStateFile decodes dir/name.json into v. A missing file is reported as
+// an error wrapping os.ErrNotExist.
+func readStateFile(dir, name string, v any) error {
+	path, err := statePath(dir, name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing state file %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+func removeStateFile(dir, name string) error {
+	path, err := statePath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// listStateFiles returns the names of the state files starting with prefix.
+func listStateFiles(dir, prefix string) ([]string, error) {
+	if dir == "" {
+		return nil, errStateDirNotConfigured
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if ok && !e.IsDir() && strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,601 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// aclPrincipal returns the ACL parameter name and value for the single
+// principal set in the request.
+func aclPrincipal(req mcp.CallToolRequest) (string, string, error) {
+	var key, value string
+	for _, k := range []string{"users", "groups", "tokens"} {
+		if v := req.GetString(k, ""); v != "" {
+			if key != "" {
+				return "", "", errors.New("only one of users, groups or tokens may be set")
+			}
+			key, value = k, v
+		}
+	}
+	if key == "" {
+		return "", "", errors.New("one of users, groups or tokens must be set")
+	}
+	return key, value, nil
+}
+
+func RegisterAccessTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit,gocyclo,cyclop
+	s.AddTool(
+		mcp.NewTool("list_users",
+			mcp.WithDescription("List users with their realm, groups, enabled state and expiry"),
+			mcp.WithString("full",
+				mcp.Description("Include group and token information: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			path := "/access/users"
+			if full := req.GetString("full", ""); full != "" {
+				path += "?full=" + url.QueryEscape(full)
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_user",
+			mcp.WithDescription("Get the configuration of a user"),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/access/users/"+url.PathEscape(userid))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_user",
+			mcp.WithDescription("Create a user"),
+			mcp.WithString("userid",
+				mcp.Description("User ID including realm (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+			mcp.WithString("password",
+				mcp.Description("Initial password (pve realm only)"),
+			),
+			mcp.WithString("email",
+				mcp.Description("Email address"),
+			),
+			mcp.WithString("firstname",
+				mcp.Description("First name"),
+			),
+			mcp.WithString("lastname",
+				mcp.Description("Last name"),
+			),
+			mcp.WithString("groups",
+				mcp.Description("Comma-separated list of groups"),
+			),
+			mcp.WithString("expire",
+				mcp.Description("Account expiration as UNIX epoch, 0 for never"),
+			),
+			mcp.WithString("enable",
+				mcp.Description("Enable the account: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("comment",
+				mcp.Description("Comment"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("userid", userid)
+			for _, p := range []string{
+				"password", "email", "firstname", "lastname", "groups", "expire", "enable", "comment",
+			} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			result, err := c.Post(ctx, "/access/users", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_user",
+			mcp.WithDescription("Update a user. Only the provided fields are changed"),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+			mcp.WithString("email",
+				mcp.Description("Email address"),
+			),
+			mcp.WithString("firstname",
+				mcp.Description("First name"),
+			),
+			mcp.WithString("lastname",
+				mcp.Description("Last name"),
+			),
+			mcp.WithString("groups",
+				mcp.Description("Comma-separated list of groups"),
+			),
+			mcp.WithString("append",
+				mcp.Description("Add to the given groups instead of replacing them: 1 or 0"),
+			),
+			mcp.WithString("expire",
+				mcp.Description("Account expiration as UNIX epoch, 0 for never"),
+			),
+			mcp.WithString("enable",
+				mcp.Description("Enable the account: 1 or 0"),
+			),
+			mcp.WithString("comment",
+				mcp.Description("Comment"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			for _, p := range []string{
+				"email", "firstname", "lastname", "groups", "append", "expire", "enable", "comment",
+			} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			if len(data) == 0 {
+				return mcp.NewToolResultError("at least one user field must be provided"), nil
+			}
+
+			result, err := c.Put(ctx, "/access/users/"+url.PathEscape(userid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_user",
+			mcp.WithDescription("Delete a user together with its API tokens"),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/access/users/"+url.PathEscape(userid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_groups",
+			mcp.WithDescription("List user groups"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/access/groups")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_group",
+			mcp.WithDescription("Create a user group"),
+			mcp.WithString("groupid",
+				mcp.Description("Group ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("comment",
+				mcp.Description("Comment"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			groupid, err := req.RequireString("groupid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("groupid", groupid)
+			if v := req.GetString("comment", ""); v != "" {
+				data.Set("comment", v)
+			}
+
+			result, err := c.Post(ctx, "/access/groups", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_group",
+			mcp.WithDescription("Delete a user group"),
+			mcp.WithString("groupid",
+				mcp.Description("Group ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			groupid, err := req.RequireString("groupid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/access/groups/"+url.PathEscape(groupid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_roles",
+			mcp.WithDescription("List roles and the privileges they grant"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/access/roles")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_role",
+			mcp.WithDescription("Create a custom role"),
+			mcp.WithString("roleid",
+				mcp.Description("Role ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("privs",
+				mcp.Description("Comma-separated list of privileges (e.g. VM.Audit,VM.PowerMgmt)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			roleid, err := req.RequireString("roleid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("roleid", roleid)
+			if v := req.GetString("privs", ""); v != "" {
+				data.Set("privs", v)
+			}
+
+			result, err := c.Post(ctx, "/access/roles", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_role",
+			mcp.WithDescription("Change the privileges of a custom role"),
+			mcp.WithString("roleid",
+				mcp.Description("Role ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("privs",
+				mcp.Description("Comma-separated list of privileges"),
+				mcp.Required(),
+			),
+			mcp.WithString("append",
+				mcp.Description("Add to the existing privileges instead of replacing them: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			roleid, err := req.RequireString("roleid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			privs, err := req.RequireString("privs")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("privs", privs)
+			if v := req.GetString("append", ""); v != "" {
+				data.Set("append", v)
+			}
+
+			result, err := c.Put(ctx, "/access/roles/"+url.PathEscape(roleid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_role",
+			mcp.WithDescription("Delete a custom role"),
+			mcp.WithString("roleid",
+				mcp.Description("Role ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			roleid, err := req.RequireString("roleid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/access/roles/"+url.PathEscape(roleid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_acl",
+			mcp.WithDescription("List all access control list entries"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/access/acl")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_acl",
+			mcp.WithDescription("Grant or revoke roles on a path for exactly one of users, groups or tokens"),
+			mcp.WithString("path",
+				mcp.Description("ACL path (e.g. /, /vms/100, /pool/prod, /storage/local)"),
+				mcp.Required(),
+			),
+			mcp.WithString("roles",
+				mcp.Description("Comma-separated list of roles"),
+				mcp.Required(),
+			),
+			mcp.WithString("users",
+				mcp.Description("Comma-separated list of user IDs"),
+			),
+			mcp.WithString("groups",
+				mcp.Description("Comma-separated list of group IDs"),
+			),
+			mcp.WithString("tokens",
+				mcp.Description("Comma-separated list of API token IDs (e.g. alice@pve!ci)"),
+			),
+			mcp.WithString("propagate",
+				mcp.Description("Propagate to child paths: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("delete",
+				mcp.Description("Revoke instead of grant: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			path, err := req.RequireString("path")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			roles, err := req.RequireString("roles")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			principalKey, principal, err := aclPrincipal(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("path", path)
+			data.Set("roles", roles)
+			data.Set(principalKey, principal)
+			for _, p := range []string{"propagate", "delete"} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			result, err := c.Put(ctx, "/access/acl", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_permissions",
+			mcp.WithDescription(
+				"Show the effective privileges a user or API token has, optionally limited to one path "+
+					"(answers \"what can X do on Y\")",
+			),
+			mcp.WithString("userid",
+				mcp.Description("User or API token ID (e.g. alice@pve or alice@pve!ci)"),
+				mcp.Required(),
+			),
+			mcp.WithString("path",
+				mcp.Description("Only check this path (e.g. /vms/100)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			params := url.Values{}
+			params.Set("userid", userid)
+			if v := req.GetString("path", ""); v != "" {
+				params.Set("path", v)
+			}
+
+			result, err := c.Get(ctx, "/access/permissions?"+params.Encode())
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_api_tokens",
+			mcp.WithDescription("List the API tokens of a user (secrets are never returned)"),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/access/users/%s/token", url.PathEscape(userid)))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_api_token",
+			mcp.WithDescription("Revoke an API token of a user"),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+			mcp.WithString("tokenid",
+				mcp.Description("Token ID (the part after '!')"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			tokenid, err := req.RequireString("tokenid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Delete(
+				ctx,
+				fmt.Sprintf("/access/users/%s/token/%s", url.PathEscape(userid), url.PathEscape(tokenid)),
+				nil,
+			)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	if !opts.AllowTokenCreate {
+		return
+	}
+
+	// The audit log never records response bodies, so the secret in the
+	// response never reaches it (see TestCreateAPITokenSecretNotAudited);
+	// it is returned to the caller exactly once.
+	s.AddTool(
+		mcp.NewTool("create_api_token",
+			mcp.WithDescription(
+				"Create an API token for a user. The secret is shown only in this response and cannot be "+
+					"retrieved again",
+			),
+			mcp.WithString("userid",
+				mcp.Description("User ID (e.g. alice@pve)"),
+				mcp.Required(),
+			),
+			mcp.WithString("tokenid",
+				mcp.Description("Token ID (the part after '!')"),
+				mcp.Required(),
+			),
+			mcp.WithString("privsep",
+				mcp.Description("Restrict the token to its own ACLs: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("expire",
+				mcp.Description("Token expiration as UNIX epoch, 0 for never"),
+			),
+			mcp.WithString("comment",
+				mcp.Description("Comment"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			userid, err := req.RequireString("userid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			tokenid, err := req.RequireString("tokenid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			for _, p := range []string{"privsep", "expire", "comment"} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			result, err := c.Post(
+				ctx,
+				fmt.Sprintf("/access/users/%s/token/%s", url.PathEscape(userid), url.PathEscape(tokenid)),
+				data,
+			)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
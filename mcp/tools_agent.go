@@ -0,0 +1,491 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const agentExecPollInterval = time.Second
+
+type agentExecStatus struct {
+	Exited       pveBool `json:"exited"`
+	ExitCode     int     `json:"exitcode"`
+	Signal       int     `json:"signal,omitempty"`
+	OutData      string  `json:"out-data,omitempty"`
+	ErrData      string  `json:"err-data,omitempty"`
+	OutTruncated pveBool `json:"out-truncated,omitempty"`
+	ErrTruncated pveBool `json:"err-truncated,omitempty"`
+}
+
+type agentInterface struct {
+	Name        string `json:"name"`
+	HWAddr      string `json:"hardware-address"`
+	IPAddresses []struct {
+		Address string `json:"ip-address"`
+		Type    string `json:"ip-address-type"`
+		Prefix  int    `json:"prefix"`
+	} `json:"ip-addresses"`
+}
+
+// guestInterface is a compact view of a guest network interface.
+type guestInterface struct {
+	Name   string   `json:"name"`
+	MAC    string   `json:"mac,omitempty"`
+	IPv4   []string `json:"ipv4,omitempty"`
+	IPv6   []string `json:"ipv6,omitempty"`
+	IsLoop bool     `json:"loopback,omitempty"`
+}
+
+func summarizeAgentInterfaces(ifaces []agentInterface) []guestInterface {
+	out := make([]guestInterface, 0, len(ifaces))
+	for _, i := range ifaces {
+		g := guestInterface{Name: i.Name, MAC: i.HWAddr, IsLoop: i.Name == "lo"}
+		for _, a := range i.IPAddresses {
+			cidr := fmt.Sprintf("%s/%d", a.Address, a.Prefix)
+			if a.Type == "ipv6" {
+				g.IPv6 = append(g.IPv6, cidr)
+			} else {
+				g.IPv4 = append(g.IPv4, cidr)
+			}
+		}
+		out = append(out, g)
+	}
+	return out
+}
+
+// agentExecAllowed reports whether exec and file-write may target vmid.
+func agentExecAllowed(allowlist []string, vmid string) error {
+	if !slices.Contains(allowlist, vmid) {
+		return fmt.Errorf("guest %s is not in the guest agent exec allowlist", vmid)
+	}
+	return nil
+}
+
+// waitAgentExec polls exec-status for pid until the process exits or the timeout elapses.
+func waitAgentExec(ctx context.Context, c *ProxmoxClient, node, vmid string, pid int, timeout time.Duration) (
+	agentExecStatus, error,
+) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/agent/exec-status?pid=%d", node, vmid, pid)
+	for {
+		var st agentExecStatus
+		if err := c.GetJSON(ctx, path, &st); err != nil {
+			if ctx.Err() != nil {
+				return st, fmt.Errorf("command (pid %d) did not finish within %s", pid, timeout)
+			}
+			return st, err
+		}
+		if st.Exited {
+			return st, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return st, fmt.Errorf("command (pid %d) did not finish within %s", pid, timeout)
+		case <-time.After(agentExecPollInterval):
+		}
+	}
+}
+
+func RegisterAgentTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("agent_ping",
+			mcp.WithDescription("Check whether the QEMU guest agent of a VM is responding"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/ping", node, vmid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_get_osinfo",
+			mcp.WithDescription("Get operating system information reported by the QEMU guest agent"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/get-osinfo", node, vmid))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_get_network",
+			mcp.WithDescription("List the network interfaces of a VM with their MAC and IP addresses (guest agent)"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var resp struct {
+				Result []agentInterface `json:"result"`
+			}
+			path := fmt.Sprintf("/nodes/%s/qemu/%s/agent/network-get-interfaces", node, vmid)
+			if err := c.GetJSON(ctx, path, &resp); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(summarizeAgentInterfaces(resp.Result), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_file_read",
+			mcp.WithDescription("Read a file inside a VM via the guest agent (content is limited to 16 MiB)"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("file",
+				mcp.Description("Absolute path of the file inside the guest"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			file, err := req.RequireString("file")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Get(
+				ctx,
+				fmt.Sprintf("/nodes/%s/qemu/%s/agent/file-read?file=%s", node, vmid, url.QueryEscape(file)),
+			)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_fsfreeze",
+			mcp.WithDescription("Freeze, thaw, or query the freeze state of all guest filesystems via the guest agent"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("action",
+				mcp.Description("Action: freeze, thaw, or status"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			action, err := req.RequireString("action")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			switch action {
+			case "freeze", "thaw", "status":
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported fsfreeze action %q", action)), nil
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/fsfreeze-%s", node, vmid, action), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_set_user_password",
+			mcp.WithDescription("Set the password of a user inside a VM via the guest agent"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("username",
+				mcp.Description("User name inside the guest"),
+				mcp.Required(),
+			),
+			mcp.WithString("password",
+				mcp.Description("New password"),
+				mcp.Required(),
+			),
+			mcp.WithString("crypted",
+				mcp.Description("The password is already crypt()ed: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			username, err := req.RequireString("username")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			password, err := req.RequireString("password")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("username", username)
+			data.Set("password", password)
+			if v := req.GetString("crypted", ""); v != "" {
+				data.Set("crypted", v)
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/set-user-password", node, vmid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	// Exec and file-write give shell-level access inside the guest, so they
+	// only exist when an allowlist of VMIDs is configured.
+	if len(opts.AgentExecAllowlist) == 0 {
+		return
+	}
+
+	s.AddTool(
+		mcp.NewTool("agent_exec",
+			mcp.WithDescription(
+				"Run a command inside a VM via the guest agent and wait for it to finish. "+
+					"Only VMs in the configured allowlist can be targeted",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("command",
+				mcp.Description("Program to run (e.g. /bin/systemctl)"),
+				mcp.Required(),
+			),
+			mcp.WithArray("args",
+				mcp.Description("Program arguments"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithString("input_data",
+				mcp.Description("Data passed to the program's standard input"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the command to finish (default: 30)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			command, err := req.RequireString("command")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := agentExecAllowed(opts.AgentExecAllowlist, vmid); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := strconv.Atoi(req.GetString("timeout", "30"))
+			if err != nil || timeout <= 0 {
+				return mcp.NewToolResultError("timeout must be a positive number of seconds"), nil
+			}
+
+			data := url.Values{}
+			data.Add("command", command)
+			for _, a := range req.GetStringSlice("args", nil) {
+				data.Add("command", a)
+			}
+			if v := req.GetString("input_data", ""); v != "" {
+				data.Set("input-data", v)
+			}
+
+			var started struct {
+				PID int `json:"pid"`
+			}
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/exec", node, vmid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := json.Unmarshal([]byte(result), &started); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("parsing exec response: %v", err)), nil
+			}
+
+			st, err := waitAgentExec(ctx, c, node, vmid, started.PID, time.Duration(timeout)*time.Second)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(st, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("agent_file_write",
+			mcp.WithDescription(
+				"Write a file inside a VM via the guest agent. Only VMs in the configured allowlist can be targeted",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("file",
+				mcp.Description("Absolute path of the file inside the guest"),
+				mcp.Required(),
+			),
+			mcp.WithString("content",
+				mcp.Description("File content"),
+				mcp.Required(),
+			),
+			mcp.WithString("encode",
+				mcp.Description("Base64-encode the content before sending (set 0 if already encoded): 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			file, err := req.RequireString("file")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			content, err := req.RequireString("content")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := agentExecAllowed(opts.AgentExecAllowlist, vmid); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("file", file)
+			data.Set("content", content)
+			if v := req.GetString("encode", ""); v != "" {
+				data.Set("encode", v)
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/agent/file-write", node, vmid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
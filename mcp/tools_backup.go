@@ -5,8 +5,11 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"slices"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -138,3 +141,262 @@ func RegisterBackupTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funle
 		},
 	)
 }
+
+// backupJobParams copies the optional backup job fields from the request into data.
+func backupJobParams(req mcp.CallToolRequest, data url.Values) {
+	for _, p := range []string{
+		"schedule", "vmid", "pool", "all", "exclude", "storage", "mode", "compress",
+		"mailto", "mailnotification", "enabled", "comment", "node",
+	} {
+		if v := req.GetString(p, ""); v != "" {
+			data.Set(p, v)
+		}
+	}
+	if v := req.GetString("prune_backups", ""); v != "" {
+		data.Set("prune-backups", v)
+	}
+	if v := req.GetString("notification_mode", ""); v != "" {
+		data.Set("notification-mode", v)
+	}
+}
+
+// validateBackupJobSelection ensures at most one guest selection is set, and
+// exactly one when required is true.
+func validateBackupJobSelection(data url.Values, required bool) error {
+	var set []string
+	for _, k := range []string{"vmid", "pool", "all"} {
+		if data.Get(k) != "" {
+			set = append(set, k)
+		}
+	}
+	if len(set) > 1 {
+		return fmt.Errorf("only one of vmid, pool or all may be set, got %s", strings.Join(set, ", "))
+	}
+	if required && len(set) == 0 {
+		return errors.New("one of vmid, pool or all must be set")
+	}
+	if data.Get("exclude") != "" && data.Get("all") != "1" && data.Get("pool") == "" {
+		return errors.New("exclude is only valid together with all=1 or pool")
+	}
+	return nil
+}
+
+// backupJobSelectionAfterUpdate returns data with the guest selection the job
+// keeps when the update sets exclude without a new selection, so that exclude
+// is checked against the existing all=1 or pool.
+func backupJobSelectionAfterUpdate(ctx context.Context, c *ProxmoxClient, id string, data url.Values,
+) (url.Values, error) {
+	if data.Get("exclude") == "" || data.Get("vmid") != "" || data.Get("pool") != "" || data.Get("all") != "" {
+		return data, nil
+	}
+	var job map[string]any
+	if err := c.GetJSON(ctx, "/cluster/backup/"+url.PathEscape(id), &job); err != nil {
+		return nil, err
+	}
+	deleted := strings.Split(data.Get("delete"), ",")
+	check := url.Values{}
+	for k, v := range data {
+		check[k] = v
+	}
+	for _, k := range []string{"vmid", "pool", "all"} {
+		if v := configString(job, k); v != "" && v != "0" && !slices.Contains(deleted, k) {
+			check.Set(k, v)
+		}
+	}
+	return check, nil
+}
+
+func backupJobOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("schedule",
+			mcp.Description("Calendar event schedule (e.g. 'daily', 'sat 02:00', '*-*-* 21:00')"),
+		),
+		mcp.WithString("vmid",
+			mcp.Description("Comma-separated list of VM/container IDs to back up"),
+		),
+		mcp.WithString("pool",
+			mcp.Description("Back up all guests in this pool"),
+		),
+		mcp.WithString("all",
+			mcp.Description("Back up all guests on the selected nodes: 1 or 0"),
+		),
+		mcp.WithString("exclude",
+			mcp.Description("Comma-separated list of VM/container IDs to exclude (with all=1 or pool)"),
+		),
+		mcp.WithString("node",
+			mcp.Description("Only run the job on this node"),
+		),
+		mcp.WithString("storage",
+			mcp.Description("Target storage for the backups"),
+		),
+		mcp.WithString("mode",
+			mcp.Description("Backup mode: snapshot, suspend, or stop"),
+		),
+		mcp.WithString("compress",
+			mcp.Description("Compression: zstd, lzo, gzip, or 0 for none"),
+		),
+		mcp.WithString("prune_backups",
+			mcp.Description("Retention options (e.g. keep-last=3,keep-daily=7,keep-weekly=4)"),
+		),
+		mcp.WithString("notification_mode",
+			mcp.Description("Notification mode: auto, legacy-sendmail, or notification-system"),
+		),
+		mcp.WithString("mailto",
+			mcp.Description("Comma-separated list of email recipients (legacy-sendmail mode)"),
+		),
+		mcp.WithString("mailnotification",
+			mcp.Description("When to send email: always or failure (legacy-sendmail mode)"),
+		),
+		mcp.WithString("enabled",
+			mcp.Description("Enable the job: 1 or 0"),
+		),
+		mcp.WithString("comment",
+			mcp.Description("Job description"),
+		),
+	}
+}
+
+func RegisterBackupJobTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
+	s.AddTool(
+		mcp.NewTool("list_backup_jobs",
+			mcp.WithDescription("List scheduled backup jobs configured for the cluster"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/backup")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_backup_job",
+			mcp.WithDescription("Get the configuration of a scheduled backup job"),
+			mcp.WithString("id",
+				mcp.Description("Backup job ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Get(ctx, "/cluster/backup/"+url.PathEscape(id))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	createOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Create a scheduled backup job. Exactly one of vmid, pool or all selects the guests"),
+		mcp.WithString("id",
+			mcp.Description("Job ID (optional, auto-generated if empty)"),
+		),
+	}, backupJobOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_backup_job", createOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			data := url.Values{}
+			backupJobParams(req, data)
+			if v := req.GetString("id", ""); v != "" {
+				data.Set("id", v)
+			}
+
+			if data.Get("schedule") == "" {
+				return mcp.NewToolResultError("schedule is required"), nil
+			}
+			if err := validateBackupJobSelection(data, true); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Post(ctx, "/cluster/backup", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updateOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Update a scheduled backup job. Only the provided fields are changed"),
+		mcp.WithString("id",
+			mcp.Description("Backup job ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to reset (e.g. exclude,mailto)"),
+		),
+	}, backupJobOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_backup_job", updateOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			backupJobParams(req, data)
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+
+			if len(data) == 0 {
+				return mcp.NewToolResultError("at least one job field must be provided"), nil
+			}
+			check, err := backupJobSelectionAfterUpdate(ctx, c, id, data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := validateBackupJobSelection(check, false); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Put(ctx, "/cluster/backup/"+url.PathEscape(id), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_backup_job",
+			mcp.WithDescription("Delete a scheduled backup job"),
+			mcp.WithString("id",
+				mcp.Description("Backup job ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Delete(ctx, "/cluster/backup/"+url.PathEscape(id), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_not_backed_up",
+			mcp.WithDescription("List guests that are not covered by any scheduled backup job"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/backup-info/not-backed-up")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
@@ -0,0 +1,549 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// pveTagRe matches a valid Proxmox guest tag.
+var pveTagRe = regexp.MustCompile(`(?i)^[a-z0-9_][a-z0-9_\-+.]*$`)
+
+const (
+	defaultBulkConcurrency = 4
+	maxBulkConcurrency     = 16
+	defaultBulkTimeout     = 300
+	defaultNodeBulkTimeout = 1800
+)
+
+// bulkGuestResult is a row of the bulk_guest_action result table.
+type bulkGuestResult struct {
+	VMID   int    `json:"vmid"`
+	Name   string `json:"name"`
+	Node   string `json:"node"`
+	Type   string `json:"type"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type bulkGuestReport struct {
+	Action   string            `json:"action"`
+	Selected int               `json:"selected"`
+	OK       int               `json:"ok"`
+	Failed   int               `json:"failed"`
+	Skipped  int               `json:"skipped"`
+	Results  []bulkGuestResult `json:"results"`
+}
+
+// bulkSelector selects guests by tag, pool, name pattern and type. All set
+// criteria must match.
+type bulkSelector struct {
+	tag         string
+	pool        string
+	namePattern string
+	guestType   string
+	// allowedPools, when not empty, limits the selection to these pools.
+	allowedPools []string
+}
+
+func guestTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool { return r == ';' || r == ',' || r == ' ' })
+}
+
+func hasTag(tags, tag string) bool {
+	return slices.ContainsFunc(guestTags(tags), func(t string) bool { return strings.EqualFold(t, tag) })
+}
+
+func (b bulkSelector) matches(r clusterResource) bool {
+	if r.Template != 0 {
+		return false
+	}
+	if b.guestType != "" && r.Type != b.guestType {
+		return false
+	}
+	if b.pool != "" && r.Pool != b.pool {
+		return false
+	}
+	if len(b.allowedPools) > 0 && !slices.Contains(b.allowedPools, r.Pool) {
+		return false
+	}
+	if b.tag != "" && !hasTag(r.Tags, b.tag) {
+		return false
+	}
+	if b.namePattern != "" {
+		if ok, _ := path.Match(b.namePattern, r.Name); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func selectGuests(ctx context.Context, c *ProxmoxClient, sel bulkSelector) ([]clusterResource, error) {
+	var resources []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+		return nil, err
+	}
+	var selected []clusterResource
+	for _, r := range resources {
+		if sel.matches(r) {
+			selected = append(selected, r)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].VMID < selected[j].VMID })
+	return selected, nil
+}
+
+// updatedTags returns the tag list with add added and remove removed, and
+// whether it changed.
+func updatedTags(current string, add, remove []string) (string, bool) {
+	tags := guestTags(current)
+	changed := false
+	for _, t := range remove {
+		if i := slices.IndexFunc(tags, func(x string) bool { return strings.EqualFold(x, t) }); i >= 0 {
+			tags = slices.Delete(tags, i, i+1)
+			changed = true
+		}
+	}
+	for _, t := range add {
+		if !slices.ContainsFunc(tags, func(x string) bool { return strings.EqualFold(x, t) }) {
+			tags = append(tags, t)
+			changed = true
+		}
+	}
+	return strings.Join(tags, ";"), changed
+}
+
+// bulkOperation applies one bulk action to a guest. It returns the result
+// ("ok" or "skipped") and a detail message.
+type bulkOperation func(ctx context.Context, r clusterResource) (string, string, error)
+
+func guestTaskOperation(c *ProxmoxClient, endpoint string, data func(r clusterResource) url.Values,
+	skip func(r clusterResource) string, timeout time.Duration,
+) bulkOperation {
+	return func(ctx context.Context, r clusterResource) (string, string, error) {
+		if reason := skip(r); reason != "" {
+			return "skipped", reason, nil
+		}
+		result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/%s/%d/%s", r.Node, r.Type, r.VMID, endpoint), data(r))
+		if err != nil {
+			return "", "", err
+		}
+		upid, err := parseUPID(result)
+		if err != nil {
+			return "", "", err
+		}
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		st, err := waitForTask(waitCtx, c, upid, nil)
+		if err != nil {
+			return "", "", err
+		}
+		if !st.OK() {
+			return "", "", fmt.Errorf("task failed: %s", st.ExitStatus)
+		}
+		return "ok", st.ExitStatus, nil
+	}
+}
+
+func bulkOperationFromRequest(c *ProxmoxClient, journal *configJournal, req mcp.CallToolRequest,
+	action string, timeout time.Duration,
+) (bulkOperation, error) {
+	noData := func(clusterResource) url.Values { return nil }
+	switch action {
+	case "start":
+		return guestTaskOperation(c, "status/start", noData, func(r clusterResource) string {
+			if r.Status == "running" {
+				return "already running"
+			}
+			return ""
+		}, timeout), nil
+	case "shutdown", "stop":
+		return guestTaskOperation(c, "status/"+action, func(clusterResource) url.Values {
+			if action == "shutdown" {
+				// Fall back to a hard stop so that the bulk call converges.
+				return url.Values{"timeout": {strconv.Itoa(int(timeout.Seconds()))}, "forceStop": {"1"}}
+			}
+			return nil
+		}, func(r clusterResource) string {
+			if r.Status == "stopped" {
+				return "already stopped"
+			}
+			return ""
+		}, timeout+powerTaskGrace), nil
+	case "snapshot":
+		snapname := req.GetString("snapname", "")
+		if snapname == "" {
+			return nil, errors.New("snapshot requires snapname")
+		}
+		return guestTaskOperation(c, "snapshot", func(r clusterResource) url.Values {
+			data := url.Values{"snapname": {snapname}}
+			if v := req.GetString("description", ""); v != "" {
+				data.Set("description", v)
+			}
+			if v := req.GetString("vmstate", ""); v != "" && r.Type == "qemu" {
+				data.Set("vmstate", v)
+			}
+			return data
+		}, func(clusterResource) string { return "" }, timeout), nil
+	case "tag":
+		add := guestTags(req.GetString("add_tags", ""))
+		remove := guestTags(req.GetString("remove_tags", ""))
+		if len(add) == 0 && len(remove) == 0 {
+			return nil, errors.New("tag requires add_tags or remove_tags")
+		}
+		for _, t := range append(slices.Clone(add), remove...) {
+			if !pveTagRe.MatchString(t) {
+				return nil, fmt.Errorf("invalid tag %q", t)
+			}
+		}
+		return func(ctx context.Context, r clusterResource) (string, string, error) {
+			tags, changed := updatedTags(r.Tags, add, remove)
+			if !changed {
+				return "skipped", "tags unchanged", nil
+			}
+			data := url.Values{"tags": {tags}}
+			if tags == "" {
+				data = url.Values{"delete": {"tags"}}
+			}
+			configPath := fmt.Sprintf("/nodes/%s/%s/%d/config", r.Node, r.Type, r.VMID)
+			meta := configChange{Tool: "bulk_guest_action", Node: r.Node, Type: r.Type, VMID: strconv.Itoa(r.VMID)}
+			if _, err := journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, configPath, data)
+			}); err != nil {
+				return "", "", err
+			}
+			return "ok", "tags: " + tags, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported action %q (supported: start, shutdown, stop, snapshot, tag)", action)
+}
+
+// runBulk applies op to the guests with at most concurrency calls in flight
+// and reports every finished guest as progress.
+func runBulk(ctx context.Context, guests []clusterResource, concurrency int, op bulkOperation,
+	progress progressFunc,
+) []bulkGuestResult {
+	results := make([]bulkGuestResult, len(guests))
+	sem := make(chan struct{}, concurrency)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for i, r := range guests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			row := bulkGuestResult{VMID: r.VMID, Name: r.Name, Node: r.Node, Type: r.Type}
+			result, detail, err := op(ctx, r)
+			if err != nil {
+				row.Result, row.Detail = "failed", err.Error()
+			} else {
+				row.Result, row.Detail = result, detail
+			}
+			results[i] = row
+
+			mu.Lock()
+			done++
+			progress(float64(done), float64(len(guests)), fmt.Sprintf("%d %s: %s", r.VMID, r.Name, row.Result))
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// nodeBulkVMs returns the vms argument of a node-wide bulk call. When the
+// server is limited to pools and no guests were named, it lists the guests on
+// the node in the allowed pools, so that the call cannot reach other guests.
+func nodeBulkVMs(ctx context.Context, c *ProxmoxClient, req mcp.CallToolRequest, node string,
+	allowedPools []string,
+) (string, error) {
+	vms := req.GetString("vms", "")
+	if vms != "" || len(allowedPools) == 0 {
+		return vms, nil
+	}
+	guests, err := selectGuests(ctx, c, bulkSelector{allowedPools: allowedPools})
+	if err != nil {
+		return "", err
+	}
+	var ids []string
+	for _, g := range guests {
+		if g.Node == node {
+			ids = append(ids, strconv.Itoa(g.VMID))
+		}
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no guests in the allowed pools on node %s", node)
+	}
+	return strings.Join(ids, ","), nil
+}
+
+func nodeBulkOptions(description string, extra ...mcp.ToolOption) []mcp.ToolOption {
+	return append([]mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("vms",
+			mcp.Description("Comma-separated list of VMIDs to include (default: all guests on the node)"),
+		),
+		mcp.WithString("wait_timeout",
+			mcp.Description("Seconds to wait for the bulk task (default: 1800)"),
+		),
+	}, extra...)
+}
+
+func RegisterBulkTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	// runNodeBulk starts a node-wide bulk task and waits for it.
+	runNodeBulk := func(ctx context.Context, req mcp.CallToolRequest, endpoint string,
+		data url.Values,
+	) *mcp.CallToolResult {
+		node, err := req.RequireString("node")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error())
+		}
+		waitTimeout, err := positiveSeconds(req, "wait_timeout", defaultNodeBulkTimeout)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error())
+		}
+		vms, err := nodeBulkVMs(ctx, c, req, node, opts.AllowedPools)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error())
+		}
+		if vms != "" {
+			data.Set("vms", vms)
+		}
+
+		result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/%s", node, endpoint), data)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error())
+		}
+		return waitForTaskLog(ctx, c, result, time.Duration(waitTimeout)*time.Second, progressReporter(ctx, req))
+	}
+
+	s.AddTool(
+		mcp.NewTool("start_all_guests",
+			nodeBulkOptions(
+				"Start the guests of a node in their startup order (/startall) and wait for the task. By default "+
+					"only guests with onboot=1 are started",
+				mcp.WithString("force",
+					mcp.Description("Also start guests without onboot=1: 1 or 0 (default: 0)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			data := url.Values{}
+			if v := req.GetString("force", ""); v != "" {
+				data.Set("force", v)
+			}
+			return runNodeBulk(ctx, req, "startall", data), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("stop_all_guests",
+			nodeBulkOptions(
+				"Shut down the guests of a node in reverse startup order (/stopall) and wait for the task",
+				mcp.WithString("timeout",
+					mcp.Description("Seconds each guest gets to shut down cleanly (default: 180)"),
+				),
+				mcp.WithString("force",
+					mcp.Description("Hard-stop guests that did not shut down within the timeout: 1 or 0 (default: 1)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			data := url.Values{}
+			if v := req.GetString("timeout", ""); v != "" {
+				data.Set("timeout", v)
+			}
+			if v := req.GetString("force", ""); v != "" {
+				data.Set("force-stop", v)
+			}
+			return runNodeBulk(ctx, req, "stopall", data), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("suspend_all_guests",
+			nodeBulkOptions(
+				"Hibernate the VMs of a node to disk (/suspendall) and wait for the task. Containers are not "+
+					"affected",
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return runNodeBulk(ctx, req, "suspendall", url.Values{}), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("migrate_all_guests",
+			nodeBulkOptions(
+				"Migrate the guests of a node to another node (/migrateall) and wait for the task. Running VMs "+
+					"are migrated live, running containers are restarted on the target",
+				mcp.WithString("target",
+					mcp.Description("Target node"),
+					mcp.Required(),
+				),
+				mcp.WithString("maxworkers",
+					mcp.Description("Number of parallel migrations (default: the node's max_workers setting)"),
+				),
+				mcp.WithString("with_local_disks",
+					mcp.Description("Also migrate guests with local disks: 1 or 0 (default: 0)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			target, err := req.RequireString("target")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := url.Values{"target": {target}}
+			if v := req.GetString("maxworkers", ""); v != "" {
+				data.Set("maxworkers", v)
+			}
+			if v := req.GetString("with_local_disks", ""); v != "" {
+				data.Set("with-local-disks", v)
+			}
+			return runNodeBulk(ctx, req, "migrateall", data), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("bulk_guest_action",
+			mcp.WithDescription(
+				"Apply start, shutdown, stop, snapshot or tag to all guests in the cluster selected by tag, pool "+
+					"and/or name pattern, with bounded concurrency. Returns a per-guest result table. Use "+
+					"dry_run=1 to only list the selection",
+			),
+			mcp.WithString("action",
+				mcp.Description("Action: start, shutdown (falls back to stop after timeout), stop, snapshot or tag"),
+				mcp.Required(),
+			),
+			mcp.WithString("tag",
+				mcp.Description("Select guests carrying this tag"),
+			),
+			mcp.WithString("pool",
+				mcp.Description("Select guests in this pool"),
+			),
+			mcp.WithString("name_pattern",
+				mcp.Description("Select guests whose name matches this glob pattern (e.g. web-*)"),
+			),
+			mcp.WithString("type",
+				mcp.Description("Only select guests of this type: qemu or lxc"),
+			),
+			mcp.WithString("snapname",
+				mcp.Description("snapshot: snapshot name"),
+			),
+			mcp.WithString("description",
+				mcp.Description("snapshot: snapshot description"),
+			),
+			mcp.WithString("vmstate",
+				mcp.Description("snapshot: include the RAM of running VMs: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("add_tags",
+				mcp.Description("tag: comma-separated tags to add"),
+			),
+			mcp.WithString("remove_tags",
+				mcp.Description("tag: comma-separated tags to remove"),
+			),
+			mcp.WithString("concurrency",
+				mcp.Description("Number of guests processed in parallel (default: 4, max: 16)"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for each guest's task (default: 300)"),
+			),
+			mcp.WithString("dry_run",
+				mcp.Description("Only list the selected guests: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			action, err := req.RequireString("action")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			sel := bulkSelector{
+				tag:          req.GetString("tag", ""),
+				pool:         req.GetString("pool", ""),
+				namePattern:  req.GetString("name_pattern", ""),
+				guestType:    req.GetString("type", ""),
+				allowedPools: opts.AllowedPools,
+			}
+			if sel.tag == "" && sel.pool == "" && sel.namePattern == "" {
+				return mcp.NewToolResultError("select guests with at least one of tag, pool or name_pattern"), nil
+			}
+			if _, err := path.Match(sel.namePattern, ""); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid name_pattern: %v", err)), nil
+			}
+			concurrency, err := strconv.Atoi(req.GetString("concurrency", strconv.Itoa(defaultBulkConcurrency)))
+			if err != nil || concurrency < 1 || concurrency > maxBulkConcurrency {
+				return mcp.NewToolResultError(
+					fmt.Sprintf("concurrency must be between 1 and %d", maxBulkConcurrency)), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultBulkTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			op, err := bulkOperationFromRequest(c, opts.journal, req, action, time.Duration(timeout)*time.Second)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			guests, err := selectGuests(ctx, c, sel)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			report := bulkGuestReport{Action: action, Selected: len(guests)}
+			if req.GetString("dry_run", "0") == "1" {
+				for _, r := range guests {
+					report.Results = append(report.Results, bulkGuestResult{
+						VMID: r.VMID, Name: r.Name, Node: r.Node, Type: r.Type, Result: "selected", Detail: r.Status,
+					})
+				}
+			} else {
+				report.Results = runBulk(ctx, guests, concurrency, op, progressReporter(ctx, req))
+			}
+			for _, r := range report.Results {
+				switch r.Result {
+				case "ok":
+					report.OK++
+				case "failed":
+					report.Failed++
+				case "skipped":
+					report.Skipped++
+				}
+			}
+			if report.Results == nil {
+				report.Results = []bulkGuestResult{}
+			}
+
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+}
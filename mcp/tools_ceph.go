@@ -0,0 +1,543 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type cephHealthCheck struct {
+	Severity string `json:"severity"`
+	Summary  struct {
+		Message string `json:"message"`
+		Count   int    `json:"count"`
+	} `json:"summary"`
+	Detail []struct {
+		Message string `json:"message"`
+	} `json:"detail"`
+	Muted bool `json:"muted"`
+}
+
+type cephStatus struct {
+	Health struct {
+		Status string                     `json:"status"`
+		Checks map[string]cephHealthCheck `json:"checks"`
+	} `json:"health"`
+}
+
+// cephFinding is a single Ceph health check rendered for human consumption.
+type cephFinding struct {
+	Check    string   `json:"check"`
+	Severity string   `json:"severity"`
+	Message  string   `json:"message"`
+	Details  []string `json:"details,omitempty"`
+	Muted    bool     `json:"muted,omitempty"`
+}
+
+// cephHealthReport summarizes the overall Ceph health and its active checks.
+type cephHealthReport struct {
+	Status   string        `json:"status"`
+	Summary  string        `json:"summary"`
+	Findings []cephFinding `json:"findings"`
+}
+
+// buildCephHealthReport turns the raw health checks from ceph status into
+// findings, most severe first.
+func buildCephHealthReport(st cephStatus) cephHealthReport {
+	report := cephHealthReport{
+		Status:   st.Health.Status,
+		Findings: make([]cephFinding, 0, len(st.Health.Checks)),
+	}
+
+	for name, check := range st.Health.Checks {
+		f := cephFinding{
+			Check:    name,
+			Severity: check.Severity,
+			Message:  check.Summary.Message,
+			Muted:    check.Muted,
+		}
+		for _, d := range check.Detail {
+			f.Details = append(f.Details, d.Message)
+		}
+		report.Findings = append(report.Findings, f)
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		a, b := report.Findings[i], report.Findings[j]
+		if a.Severity != b.Severity {
+			// HEALTH_ERR sorts before HEALTH_WARN.
+			return a.Severity < b.Severity
+		}
+		return a.Check < b.Check
+	})
+
+	switch {
+	case st.Health.Status == "HEALTH_OK":
+		report.Summary = "Ceph cluster is healthy"
+	case len(report.Findings) == 0:
+		report.Summary = fmt.Sprintf("Ceph reports %s without any active checks", st.Health.Status)
+	default:
+		report.Summary = fmt.Sprintf(
+			"Ceph reports %s with %d active check(s); most severe: %s",
+			st.Health.Status, len(report.Findings), report.Findings[0].Message,
+		)
+	}
+
+	return report
+}
+
+func RegisterCephTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("get_ceph_status",
+			mcp.WithDescription("Get the full Ceph cluster status (health, monitors, OSD map, PG map, usage)"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/status", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_ceph_health",
+			mcp.WithDescription("Get Ceph health as a list of readable findings, most severe first"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var st cephStatus
+			if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/ceph/status", node), &st); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(buildCephHealthReport(st), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_ceph_pools",
+			mcp.WithDescription("List Ceph pools with size, PG count and PG autoscale mode/target"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/pool", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_ceph_pool",
+			mcp.WithDescription("Get detailed status of a Ceph pool, including PG autoscale status"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Pool name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/pool/%s/status", node, url.PathEscape(name)))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_ceph_pool",
+			mcp.WithDescription("Create a Ceph pool"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Pool name"),
+				mcp.Required(),
+			),
+			mcp.WithString("size",
+				mcp.Description("Number of replicas (default: 3)"),
+			),
+			mcp.WithString("min_size",
+				mcp.Description("Minimum number of replicas for I/O (default: 2)"),
+			),
+			mcp.WithString("pg_num",
+				mcp.Description("Number of placement groups"),
+			),
+			mcp.WithString("pg_autoscale_mode",
+				mcp.Description("PG autoscale mode: on, off, or warn"),
+			),
+			mcp.WithString("target_size",
+				mcp.Description("Estimated target size for the autoscaler (e.g. 500G)"),
+			),
+			mcp.WithString("target_size_ratio",
+				mcp.Description("Estimated target ratio for the autoscaler"),
+			),
+			mcp.WithString("crush_rule",
+				mcp.Description("CRUSH rule name"),
+			),
+			mcp.WithString("application",
+				mcp.Description("Pool application: rbd, cephfs, or rgw (default: rbd)"),
+			),
+			mcp.WithString("add_storages",
+				mcp.Description("Add a Proxmox storage for the pool: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("name", name)
+			for _, p := range []string{
+				"size", "min_size", "pg_num", "pg_autoscale_mode", "target_size",
+				"target_size_ratio", "crush_rule", "application", "add_storages",
+			} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/ceph/pool", node), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_ceph_pool",
+			mcp.WithDescription("Change settings of a Ceph pool"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Pool name"),
+				mcp.Required(),
+			),
+			mcp.WithString("size",
+				mcp.Description("Number of replicas"),
+			),
+			mcp.WithString("min_size",
+				mcp.Description("Minimum number of replicas for I/O"),
+			),
+			mcp.WithString("pg_num",
+				mcp.Description("Number of placement groups"),
+			),
+			mcp.WithString("pg_num_min",
+				mcp.Description("Minimum number of placement groups for the autoscaler"),
+			),
+			mcp.WithString("pg_autoscale_mode",
+				mcp.Description("PG autoscale mode: on, off, or warn"),
+			),
+			mcp.WithString("target_size",
+				mcp.Description("Estimated target size for the autoscaler (e.g. 500G)"),
+			),
+			mcp.WithString("target_size_ratio",
+				mcp.Description("Estimated target ratio for the autoscaler"),
+			),
+			mcp.WithString("crush_rule",
+				mcp.Description("CRUSH rule name"),
+			),
+			mcp.WithString("application",
+				mcp.Description("Pool application: rbd, cephfs, or rgw"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			for _, p := range []string{
+				"size", "min_size", "pg_num", "pg_num_min", "pg_autoscale_mode",
+				"target_size", "target_size_ratio", "crush_rule", "application",
+			} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			if len(data) == 0 {
+				return mcp.NewToolResultError("at least one pool setting must be provided"), nil
+			}
+
+			result, err := c.Put(ctx, fmt.Sprintf("/nodes/%s/ceph/pool/%s", node, url.PathEscape(name)), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_ceph_pool",
+			mcp.WithDescription("Destroy a Ceph pool and all data in it"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Pool name"),
+				mcp.Required(),
+			),
+			mcp.WithString("remove_storages",
+				mcp.Description("Remove all Proxmox storages configured for the pool: 1 or 0"),
+			),
+			mcp.WithString("force",
+				mcp.Description("Destroy the pool even if it is in use: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			params := url.Values{}
+			for _, p := range []string{"remove_storages", "force"} {
+				if v := req.GetString(p, ""); v != "" {
+					params.Set(p, v)
+				}
+			}
+
+			result, err := c.Delete(ctx, fmt.Sprintf("/nodes/%s/ceph/pool/%s", node, url.PathEscape(name)), params)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_ceph_osds",
+			mcp.WithDescription("List Ceph OSDs as a CRUSH tree with up/down and in/out state"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/osd", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("ceph_osd_action",
+			mcp.WithDescription(
+				"Change the state of a Ceph OSD: in/out (data placement), "+
+					"start/stop/restart (up/down daemon), scrub or deep-scrub",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node hosting the OSD"),
+				mcp.Required(),
+			),
+			mcp.WithString("osdid",
+				mcp.Description("OSD ID (e.g. 3)"),
+				mcp.Required(),
+			),
+			mcp.WithString("action",
+				mcp.Description("Action: in, out, start, stop, restart, scrub, or deep-scrub"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			osdid, err := req.RequireString("osdid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			action, err := req.RequireString("action")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var (
+				path string
+				data url.Values
+			)
+			switch action {
+			case "in", "out":
+				path = fmt.Sprintf("/nodes/%s/ceph/osd/%s/%s", node, osdid, action)
+			case "scrub", "deep-scrub":
+				path = fmt.Sprintf("/nodes/%s/ceph/osd/%s/scrub", node, osdid)
+				if action == "deep-scrub" {
+					data = url.Values{"deep": {"1"}}
+				}
+			case "start", "stop", "restart":
+				path = fmt.Sprintf("/nodes/%s/ceph/%s", node, action)
+				data = url.Values{"service": {"osd." + osdid}}
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported OSD action %q", action)), nil
+			}
+
+			result, err := c.Post(ctx, path, data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_ceph_monitors",
+			mcp.WithDescription("List Ceph monitors and their quorum state"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/mon", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_ceph_managers",
+			mcp.WithDescription("List Ceph managers and which one is active"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/mgr", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_cephfs",
+			mcp.WithDescription("List CephFS filesystems with their metadata and data pools"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/fs", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_ceph_crush_rules",
+			mcp.WithDescription("List Ceph CRUSH rules"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/ceph/rules", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
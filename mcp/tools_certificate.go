@@ -0,0 +1,745 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxACMEDomains is the number of acmedomainN entries of a node config.
+const maxACMEDomains = 6
+
+const (
+	defaultCertificateWarnDays = 30
+	defaultACMEOrderTimeout    = 600
+)
+
+// certificateInfo is an entry of /nodes/{node}/certificates/info.
+type certificateInfo struct {
+	Filename    string   `json:"filename"`
+	Subject     string   `json:"subject"`
+	Issuer      string   `json:"issuer"`
+	SAN         []string `json:"san"`
+	Fingerprint string   `json:"fingerprint"`
+	NotBefore   int64    `json:"notbefore"`
+	NotAfter    int64    `json:"notafter"`
+}
+
+// certificateSummary is a certificate with its validity in readable form.
+type certificateSummary struct {
+	Node        string   `json:"node,omitempty"`
+	Filename    string   `json:"filename"`
+	Subject     string   `json:"subject"`
+	Issuer      string   `json:"issuer"`
+	SAN         []string `json:"san,omitempty"`
+	Fingerprint string   `json:"fingerprint"`
+	NotBefore   string   `json:"not_before"`
+	NotAfter    string   `json:"not_after"`
+	DaysLeft    int      `json:"days_left"`
+	Status      string   `json:"status,omitempty"`
+}
+
+func summarizeCertificate(node string, info certificateInfo, now time.Time) certificateSummary {
+	notAfter := time.Unix(info.NotAfter, 0).UTC()
+	// Round down so that a certificate expired less than a day ago has -1
+	// days left rather than 0.
+	daysLeft := int(math.Floor(notAfter.Sub(now).Hours() / 24))
+	return certificateSummary{
+		Node:        node,
+		Filename:    info.Filename,
+		Subject:     info.Subject,
+		Issuer:      info.Issuer,
+		SAN:         info.SAN,
+		Fingerprint: info.Fingerprint,
+		NotBefore:   time.Unix(info.NotBefore, 0).UTC().Format(time.RFC3339),
+		NotAfter:    notAfter.Format(time.RFC3339),
+		DaysLeft:    daysLeft,
+	}
+}
+
+func nodeCertificates(ctx context.Context, c *ProxmoxClient, node string, now time.Time) ([]certificateSummary, error) {
+	var infos []certificateInfo
+	if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/certificates/info", node), &infos); err != nil {
+		return nil, err
+	}
+	certs := make([]certificateSummary, 0, len(infos))
+	for _, info := range infos {
+		certs = append(certs, summarizeCertificate(node, info, now))
+	}
+	return certs, nil
+}
+
+// certificateExpiryReport is returned by get_certificate_expiry_report.
+type certificateExpiryReport struct {
+	Days         int                  `json:"days"`
+	Status       string               `json:"status"`
+	Findings     []string             `json:"findings"`
+	Certificates []certificateSummary `json:"certificates"`
+}
+
+// buildCertificateExpiryReport flags certificates that expired or expire
+// within days. The CA certificate (pve-root-ca.pem) is valid for ten years and
+// checked like any other.
+func buildCertificateExpiryReport(certs []certificateSummary, errs []string, days int) certificateExpiryReport {
+	report := certificateExpiryReport{Days: days, Status: "OK", Findings: errs, Certificates: certs}
+	if len(errs) > 0 {
+		report.Status = "WARNING"
+	}
+	for i := range report.Certificates {
+		cert := &report.Certificates[i]
+		switch {
+		case cert.DaysLeft < 0:
+			cert.Status = "EXPIRED"
+			report.Status = "CRITICAL"
+			report.Findings = append(report.Findings,
+				fmt.Sprintf("%s: %s (%s) expired on %s", cert.Node, cert.Filename, cert.Subject, cert.NotAfter))
+		case cert.DaysLeft < days:
+			cert.Status = "EXPIRING"
+			if report.Status == "OK" {
+				report.Status = "WARNING"
+			}
+			report.Findings = append(report.Findings,
+				fmt.Sprintf("%s: %s (%s) expires in %d days on %s", cert.Node, cert.Filename, cert.Subject,
+					cert.DaysLeft, cert.NotAfter))
+		default:
+			cert.Status = "OK"
+		}
+	}
+	sort.SliceStable(report.Certificates, func(i, j int) bool {
+		return report.Certificates[i].DaysLeft < report.Certificates[j].DaysLeft
+	})
+	if report.Findings == nil {
+		report.Findings = []string{}
+	}
+	return report
+}
+
+// acmeDomainEntry converts a domain argument into an acmedomainN value.
+// Plain domain names use the given plugin (none means standalone HTTP
+// validation); property strings are passed through.
+func acmeDomainEntry(domain, plugin string) string {
+	if strings.Contains(domain, "=") {
+		return domain
+	}
+	entry := "domain=" + domain
+	if plugin != "" {
+		entry += ",plugin=" + plugin
+	}
+	return entry
+}
+
+func acmePluginParams(req mcp.CallToolRequest) url.Values {
+	data := url.Values{}
+	for _, p := range []string{"api", "validation-delay", "nodes", "disable"} {
+		if v := req.GetString(storageArgName(p), ""); v != "" {
+			data.Set(p, v)
+		}
+	}
+	if v := req.GetString("data", ""); v != "" {
+		data.Set("data", base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return data
+}
+
+func acmePluginParamOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("api",
+			mcp.Description("dns: acme.sh DNS API plugin (e.g. cf, route53, hetzner)"),
+		),
+		mcp.WithString("data",
+			mcp.Description("dns: plugin credentials as KEY=value lines, e.g. CF_Token=... (never logged or returned)"),
+		),
+		mcp.WithString("validation_delay",
+			mcp.Description("dns: seconds to wait before requesting validation (default: 30)"),
+		),
+		mcp.WithString("nodes",
+			mcp.Description("Comma-separated list of nodes the plugin is available on (default: all)"),
+		),
+		mcp.WithString("disable",
+			mcp.Description("Disable the plugin: 1 or 0"),
+		),
+	}
+}
+
+func RegisterCertificateTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_node_certificates",
+			mcp.WithDescription("List the certificates of a node with issuer, SANs and expiry date"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			certs, err := nodeCertificates(ctx, c, node, time.Now())
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out, err := json.MarshalIndent(certs, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("upload_node_certificate",
+			mcp.WithDescription(
+				"Upload a custom certificate (PEM chain) and private key for the node's web interface and API. "+
+					"Replaces an ACME certificate",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("certificates",
+				mcp.Description("PEM encoded certificate chain, leaf certificate first"),
+				mcp.Required(),
+			),
+			mcp.WithString("key",
+				mcp.Description("PEM encoded private key (never logged; default: keep the current key)"),
+			),
+			mcp.WithString("force",
+				mcp.Description("Overwrite an existing custom certificate: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("restart",
+				mcp.Description("Restart pveproxy to use the new certificate: 1 or 0 (default: 1)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			certificates, err := req.RequireString("certificates")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !strings.Contains(certificates, "-----BEGIN CERTIFICATE-----") {
+				return mcp.NewToolResultError("certificates must be PEM encoded"), nil
+			}
+
+			data := url.Values{
+				"certificates": {certificates},
+				"restart":      {req.GetString("restart", "1")},
+			}
+			if v := req.GetString("key", ""); v != "" {
+				data.Set("key", v)
+			}
+			if v := req.GetString("force", ""); v != "" {
+				data.Set("force", v)
+			}
+
+			var info certificateInfo
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/certificates/custom", node), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := json.Unmarshal([]byte(result), &info); err != nil {
+				return mcp.NewToolResultText(result), nil
+			}
+			out, err := json.MarshalIndent(summarizeCertificate(node, info, time.Now()), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_certificate_expiry_report",
+			mcp.WithDescription(
+				"Check the certificates of all online nodes and report the ones that expired or expire within "+
+					"the given number of days",
+			),
+			mcp.WithString("days",
+				mcp.Description("Warn about certificates expiring within this many days (default: 30)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			days, err := strconv.Atoi(req.GetString("days", strconv.Itoa(defaultCertificateWarnDays)))
+			if err != nil || days < 0 {
+				return mcp.NewToolResultError("days must be a non-negative number"), nil
+			}
+
+			var nodes []struct {
+				Node   string `json:"node"`
+				Status string `json:"status"`
+			}
+			if err := c.GetJSON(ctx, "/nodes", &nodes); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+
+			now := time.Now()
+			var (
+				certs []certificateSummary
+				errs  []string
+			)
+			for _, n := range nodes {
+				if n.Status != "online" {
+					errs = append(errs, fmt.Sprintf("%s: node is %s, certificates not checked", n.Node, n.Status))
+					continue
+				}
+				nodeCerts, err := nodeCertificates(ctx, c, n.Node, now)
+				if err != nil {
+					errs = append(errs, fmt.Sprintf("%s: %v", n.Node, err))
+					continue
+				}
+				certs = append(certs, nodeCerts...)
+			}
+
+			out, err := json.MarshalIndent(buildCertificateExpiryReport(certs, errs, days), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_acme_directories",
+			mcp.WithDescription("List the well-known ACME directories (e.g. Let's Encrypt production and staging)"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/acme/directories")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_acme_directory_meta",
+			mcp.WithDescription(
+				"Get the metadata of an ACME directory: terms of service URL and whether external account "+
+					"binding is required",
+			),
+			mcp.WithString("directory",
+				mcp.Description("ACME directory URL (default: Let's Encrypt production)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			path := "/cluster/acme/meta"
+			if v := req.GetString("directory", ""); v != "" {
+				path += "?directory=" + url.QueryEscape(v)
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_acme_accounts",
+			mcp.WithDescription("List the registered ACME accounts"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/acme/account")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_acme_account",
+			mcp.WithDescription("Get an ACME account with its contact, directory and status"),
+			mcp.WithString("name",
+				mcp.Description("Account name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/cluster/acme/account/"+url.PathEscape(name))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("register_acme_account",
+			mcp.WithDescription("Register a new ACME account with a CA and wait for the registration"),
+			mcp.WithString("name",
+				mcp.Description("Account name (default: default)"),
+			),
+			mcp.WithString("contact",
+				mcp.Description("Contact e-mail address"),
+				mcp.Required(),
+			),
+			mcp.WithString("directory",
+				mcp.Description("ACME directory URL (default: Let's Encrypt production)"),
+			),
+			mcp.WithString("tos_url",
+				mcp.Description("Terms of service URL, to confirm they are accepted (see get_acme_directory_meta)"),
+			),
+			mcp.WithString("eab_kid",
+				mcp.Description("Key identifier for external account binding"),
+			),
+			mcp.WithString("eab_hmac_key",
+				mcp.Description("HMAC key for external account binding (never logged)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			contact, err := req.RequireString("contact")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := url.Values{"contact": {contact}}
+			for _, p := range []string{"name", "directory", "tos_url", "eab-kid", "eab-hmac-key"} {
+				if v := req.GetString(storageArgName(p), ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+
+			result, err := c.Post(ctx, "/cluster/acme/account", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return waitForTaskLog(ctx, c, result, defaultACMEOrderTimeout*time.Second,
+				progressReporter(ctx, req)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_acme_account",
+			mcp.WithDescription("Update the contact address of an ACME account"),
+			mcp.WithString("name",
+				mcp.Description("Account name"),
+				mcp.Required(),
+			),
+			mcp.WithString("contact",
+				mcp.Description("Contact e-mail address"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			contact, err := req.RequireString("contact")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Put(ctx, "/cluster/acme/account/"+url.PathEscape(name), url.Values{"contact": {contact}})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return waitForTaskLog(ctx, c, result, defaultACMEOrderTimeout*time.Second,
+				progressReporter(ctx, req)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_acme_account",
+			mcp.WithDescription("Deactivate an ACME account at the CA and remove it"),
+			mcp.WithString("name",
+				mcp.Description("Account name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/cluster/acme/account/"+url.PathEscape(name), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return waitForTaskLog(ctx, c, result, defaultACMEOrderTimeout*time.Second,
+				progressReporter(ctx, req)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_acme_plugins",
+			mcp.WithDescription("List the ACME challenge plugins; plugin credentials are redacted"),
+			mcp.WithString("type",
+				mcp.Description("Only list plugins of this type: dns or standalone"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			path := "/cluster/acme/plugins"
+			if v := req.GetString("type", ""); v != "" {
+				path += "?type=" + url.QueryEscape(v)
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result, "data")), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_acme_plugin",
+			mcp.WithDescription("Get an ACME challenge plugin; plugin credentials are redacted"),
+			mcp.WithString("id",
+				mcp.Description("Plugin ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/cluster/acme/plugins/"+url.PathEscape(id))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result, "data")), nil
+		},
+	)
+
+	createPluginOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Add an ACME challenge plugin (dns needs api and data)"),
+		mcp.WithString("id",
+			mcp.Description("Plugin ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("type",
+			mcp.Description("Plugin type: dns or standalone"),
+			mcp.Required(),
+		),
+	}, acmePluginParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_acme_plugin", createPluginOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			pluginType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := acmePluginParams(req)
+			switch pluginType {
+			case "dns":
+				if data.Get("api") == "" {
+					return mcp.NewToolResultError("dns plugins require api"), nil
+				}
+			case "standalone":
+				if data.Get("api") != "" || data.Get("data") != "" {
+					return mcp.NewToolResultError("standalone plugins take no api or data"), nil
+				}
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported plugin type %q (supported: dns, standalone)",
+					pluginType)), nil
+			}
+			data.Set("id", id)
+			data.Set("type", pluginType)
+
+			result, err := c.Post(ctx, "/cluster/acme/plugins", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updatePluginOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Update an ACME challenge plugin; data replaces all current credentials"),
+		mcp.WithString("id",
+			mcp.Description("Plugin ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to remove"),
+		),
+	}, acmePluginParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_acme_plugin", updatePluginOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := acmePluginParams(req)
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("no settings to update"), nil
+			}
+
+			result, err := c.Put(ctx, "/cluster/acme/plugins/"+url.PathEscape(id), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_acme_plugin",
+			mcp.WithDescription("Delete an ACME challenge plugin"),
+			mcp.WithString("id",
+				mcp.Description("Plugin ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/cluster/acme/plugins/"+url.PathEscape(id), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("set_node_acme_domains",
+			mcp.WithDescription(
+				"Set the ACME account and domains a node orders its certificate for. Replaces all configured "+
+					"domains",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithArray("domains",
+				mcp.Description(
+					"Domains (at most 6), either plain names or property strings like "+
+						"domain=pve1.example.com,plugin=cloudflare,alias=_acme.example.net",
+				),
+				mcp.WithStringItems(),
+				mcp.Required(),
+			),
+			mcp.WithString("plugin",
+				mcp.Description("DNS plugin for plain domain names (default: standalone HTTP validation)"),
+			),
+			mcp.WithString("account",
+				mcp.Description("ACME account to use (default: default)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			domains, err := req.RequireStringSlice("domains")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if len(domains) == 0 || len(domains) > maxACMEDomains {
+				return mcp.NewToolResultError(fmt.Sprintf("domains must list 1 to %d domains", maxACMEDomains)), nil
+			}
+
+			var conf map[string]any
+			configPath := fmt.Sprintf("/nodes/%s/config", node)
+			if err := c.GetJSON(ctx, configPath, &conf); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{"acme": {"account=" + req.GetString("account", "default")}}
+			plugin := req.GetString("plugin", "")
+			for i, d := range domains {
+				data.Set(fmt.Sprintf("acmedomain%d", i), acmeDomainEntry(d, plugin))
+			}
+			var remove []string
+			for i := len(domains); i < maxACMEDomains; i++ {
+				if _, ok := conf[fmt.Sprintf("acmedomain%d", i)]; ok {
+					remove = append(remove, fmt.Sprintf("acmedomain%d", i))
+				}
+			}
+			if len(remove) > 0 {
+				data.Set("delete", strings.Join(remove, ","))
+			}
+			if digest, ok := conf["digest"].(string); ok {
+				data.Set("digest", digest)
+			}
+
+			if _, err := c.Put(ctx, configPath, data); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Node %s will order certificates for %s",
+				node, strings.Join(domains, ", "))), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("order_node_certificate",
+			mcp.WithDescription(
+				"Order a new ACME certificate for the configured domains of a node, or renew the current one, "+
+					"and wait for the task. Reports the task log as progress",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("renew",
+				mcp.Description("Renew the current ACME certificate instead of ordering one: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("force",
+				mcp.Description("Order: overwrite a custom certificate; renew: renew even if not due: 1 or 0"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the task (default: 600)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := strconv.Atoi(req.GetString("timeout", strconv.Itoa(defaultACMEOrderTimeout)))
+			if err != nil || timeout <= 0 {
+				return mcp.NewToolResultError("timeout must be a positive number of seconds"), nil
+			}
+
+			data := url.Values{}
+			if v := req.GetString("force", ""); v != "" {
+				data.Set("force", v)
+			}
+			path := fmt.Sprintf("/nodes/%s/certificates/acme/certificate", node)
+
+			var result string
+			if req.GetString("renew", "0") == "1" {
+				result, err = c.Put(ctx, path, data)
+			} else {
+				result, err = c.Post(ctx, path, data)
+			}
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return waitForTaskLog(ctx, c, result, time.Duration(timeout)*time.Second,
+				progressReporter(ctx, req)), nil
+		},
+	)
+}
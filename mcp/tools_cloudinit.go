@@ -0,0 +1,223 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var ipconfigKeyRe = regexp.MustCompile(`^ipconfig([0-9]|[12][0-9]|3[01])$`)
+
+// encodeSSHKeys URL-encodes a set of public keys the way the sshkeys option
+// expects. Proxmox decodes the value once more after form decoding, and does
+// not treat '+' as a space, so spaces must become %20.
+func encodeSSHKeys(keys string) string {
+	var lines []string
+	for _, l := range strings.Split(strings.ReplaceAll(keys, "\r\n", "\n"), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return strings.ReplaceAll(url.QueryEscape(strings.Join(lines, "\n")), "+", "%20")
+}
+
+func RegisterCloudInitTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen
+	s.AddTool(
+		mcp.NewTool("set_cloudinit_config",
+			mcp.WithDescription(
+				"Set cloud-init options of a VM. Changes apply on the next boot or after regenerate_cloudinit",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("ciuser",
+				mcp.Description("Default user name"),
+			),
+			mcp.WithString("cipassword",
+				mcp.Description("Password for the default user"),
+			),
+			mcp.WithString("sshkeys",
+				mcp.Description("Public SSH keys, one per line (plain text, encoding is handled by the tool)"),
+			),
+			mcp.WithString("ipconfig0",
+				mcp.Description(
+					"IP config of net0 (e.g. ip=dhcp or ip=10.0.0.5/24,gw=10.0.0.1). "+
+						"ipconfig1 to ipconfig31 are accepted for further NICs",
+				),
+			),
+			mcp.WithString("ipconfig1",
+				mcp.Description("IP config of net1"),
+			),
+			mcp.WithString("nameserver",
+				mcp.Description("DNS server(s), space separated"),
+			),
+			mcp.WithString("searchdomain",
+				mcp.Description("DNS search domain(s), space separated"),
+			),
+			mcp.WithString("cicustom",
+				mcp.Description("Custom snippet files (e.g. user=local:snippets/user.yaml)"),
+			),
+			mcp.WithString("citype",
+				mcp.Description("Config format: nocloud, configdrive2, or opennebula"),
+			),
+			mcp.WithString("ciupgrade",
+				mcp.Description("Upgrade packages on first boot: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			for _, p := range []string{
+				"ciuser", "cipassword", "nameserver", "searchdomain", "cicustom", "citype", "ciupgrade",
+			} {
+				if v := req.GetString(p, ""); v != "" {
+					data.Set(p, v)
+				}
+			}
+			for key := range req.GetArguments() {
+				if !ipconfigKeyRe.MatchString(key) {
+					continue
+				}
+				if v := req.GetString(key, ""); v != "" {
+					data.Set(key, v)
+				}
+			}
+			if v := req.GetString("sshkeys", ""); v != "" {
+				data.Set("sshkeys", encodeSSHKeys(v))
+			}
+
+			if len(data) == 0 {
+				return mcp.NewToolResultError("at least one cloud-init field must be provided"), nil
+			}
+
+			meta := configChange{Tool: "set_cloudinit_config", Node: node, Type: "qemu", VMID: vmid}
+			result, err := opts.journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/config", node, vmid), data)
+			})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_cloudinit_dump",
+			mcp.WithDescription("Get the rendered cloud-init configuration of a VM"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("type",
+				mcp.Description("Config section: user, network, or meta (default: user)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			section := req.GetString("type", "user")
+			switch section {
+			case "user", "network", "meta":
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported cloud-init section %q", section)), nil
+			}
+
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/cloudinit/dump?type=%s", node, vmid, section))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_cloudinit_pending",
+			mcp.WithDescription("List cloud-init options with values that are not yet in the cloud-init drive"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/cloudinit", node, vmid))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("regenerate_cloudinit",
+			mcp.WithDescription("Regenerate the cloud-init drive of a VM from its current configuration"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			result, err := c.Put(ctx, fmt.Sprintf("/nodes/%s/qemu/%s/cloudinit", node, vmid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
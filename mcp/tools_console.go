@@ -0,0 +1,264 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Proxmox accepts VNC/terminal tickets for about 40 seconds and SPICE
+// passwords for about 30 seconds after they are issued.
+const (
+	vncTicketLifetimeSeconds   = 40
+	spiceTicketLifetimeSeconds = 30
+)
+
+// consoleTarget is the guest or node shell a console ticket is requested for.
+type consoleTarget struct {
+	node      string
+	vmid      string
+	guestType string
+}
+
+func consoleTargetFromRequest(req mcp.CallToolRequest) (consoleTarget, error) {
+	node, err := req.RequireString("node")
+	if err != nil {
+		return consoleTarget{}, err
+	}
+	t := consoleTarget{
+		node:      node,
+		vmid:      req.GetString("vmid", ""),
+		guestType: req.GetString("type", "qemu"),
+	}
+	if t.guestType != "qemu" && t.guestType != "lxc" {
+		return consoleTarget{}, fmt.Errorf("unsupported guest type %q", t.guestType)
+	}
+	return t, nil
+}
+
+// path returns the API path of the console endpoint. guestEndpoint is used
+// for guests, nodeEndpoint for the node shell.
+func (t consoleTarget) path(guestEndpoint, nodeEndpoint string) string {
+	if t.vmid == "" {
+		return fmt.Sprintf("/nodes/%s/%s", t.node, nodeEndpoint)
+	}
+	return fmt.Sprintf("/nodes/%s/%s/%s/%s", t.node, t.guestType, t.vmid, guestEndpoint)
+}
+
+// consoleParam is the console kind the Proxmox web UI uses for the target.
+func (t consoleTarget) consoleParam() string {
+	switch {
+	case t.vmid == "":
+		return "shell"
+	case t.guestType == "lxc":
+		return "lxc"
+	default:
+		return "kvm"
+	}
+}
+
+type consoleTicket struct {
+	Port   json.Number `json:"port"`
+	Ticket string      `json:"ticket"`
+	User   string      `json:"user"`
+	UPID   string      `json:"upid"`
+}
+
+// consoleResponse is returned by the VNC and terminal console tools. The
+// terminal console only has a URL; the web UI requests its own ticket.
+type consoleResponse struct {
+	URL              string `json:"url"`
+	Ticket           string `json:"ticket,omitempty"`
+	Port             string `json:"port,omitempty"`
+	User             string `json:"user,omitempty"`
+	UPID             string `json:"upid,omitempty"`
+	ExpiresInSeconds int    `json:"expires_in_seconds,omitempty"`
+	Note             string `json:"note"`
+}
+
+// noVNCURL builds a noVNC URL that connects straight to the vncwebsocket of
+// the target using the ticket as VNC password.
+func noVNCURL(baseURL string, t consoleTarget, tk consoleTicket) string {
+	wsPath := strings.TrimPrefix(t.path("vncwebsocket", "vncwebsocket"), "/")
+	wsPath = fmt.Sprintf("api2/json/%s?port=%s&vncticket=%s", wsPath, tk.Port.String(), url.QueryEscape(tk.Ticket))
+
+	q := url.Values{}
+	q.Set("autoconnect", "true")
+	q.Set("encrypt", "true")
+	q.Set("resize", "scale")
+	q.Set("path", wsPath)
+	q.Set("password", tk.Ticket)
+	return baseURL + "/novnc/vnc.html?" + q.Encode()
+}
+
+// xtermURL builds the Proxmox web UI URL of the xterm.js console of the target.
+func xtermURL(baseURL string, t consoleTarget) string {
+	q := url.Values{}
+	q.Set("console", t.consoleParam())
+	q.Set("xtermjs", "1")
+	q.Set("node", t.node)
+	if t.vmid != "" {
+		q.Set("vmid", t.vmid)
+	}
+	return baseURL + "/?" + q.Encode()
+}
+
+// spiceVVFile renders the spiceproxy response as a virt-viewer (.vv) file.
+func spiceVVFile(fields map[string]any) string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString("[virt-viewer]\n")
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s=%v\n", k, fields[k])
+	}
+	return sb.String()
+}
+
+func consoleToolOptions(description string) []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("vmid",
+			mcp.Description("VM/container ID (omit for the node shell)"),
+		),
+		mcp.WithString("type",
+			mcp.Description("Guest type: qemu or lxc (default: qemu)"),
+		),
+	}
+}
+
+func RegisterConsoleTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen
+	// The terminal console only links to the web UI, which authenticates the browser itself.
+	s.AddTool(
+		mcp.NewTool("get_terminal_console",
+			consoleToolOptions(
+				"Return the xterm.js console URL of a guest or node shell. No ticket is issued; the "+
+					"Proxmox web UI opens the terminal with the session of the browser",
+			)...,
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := consoleTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(consoleResponse{
+				URL:  xtermURL(c.BaseURL, t),
+				Note: "Open the URL in a browser that is logged in to the Proxmox web UI",
+			}, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	// Console tickets hand out interactive access to guests and node shells.
+	if !opts.AllowElevated {
+		return
+	}
+
+	s.AddTool(
+		mcp.NewTool("get_vnc_console",
+			consoleToolOptions(
+				"[elevated] Request a short-lived VNC ticket for a guest or node shell and return a "+
+					"ready-to-open noVNC URL",
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := consoleTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var tk consoleTicket
+			result, err := c.Post(ctx, t.path("vncproxy", "vncshell"), url.Values{"websocket": {"1"}})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := json.Unmarshal([]byte(result), &tk); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("parsing vncproxy response: %v", err)), nil
+			}
+
+			out, err := json.MarshalIndent(consoleResponse{
+				URL:              noVNCURL(c.BaseURL, t, tk),
+				Ticket:           tk.Ticket,
+				Port:             tk.Port.String(),
+				User:             tk.User,
+				UPID:             tk.UPID,
+				ExpiresInSeconds: vncTicketLifetimeSeconds,
+				Note:             "Open the URL right away in a browser that is logged in to the Proxmox web UI",
+			}, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	spiceOpts := append(
+		consoleToolOptions(
+			"[elevated] Request a short-lived SPICE ticket for a guest or node shell and return it as a "+
+				"virt-viewer (.vv) file",
+		),
+		mcp.WithString("proxy",
+			mcp.Description("SPICE proxy host the client should connect through (default: the node)"),
+		),
+	)
+	s.AddTool(
+		mcp.NewTool("get_spice_console", spiceOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := consoleTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			if v := req.GetString("proxy", ""); v != "" {
+				data.Set("proxy", v)
+			}
+
+			var fields map[string]any
+			result, err := c.Post(ctx, t.path("spiceproxy", "spiceshell"), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := json.Unmarshal([]byte(result), &fields); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("parsing spiceproxy response: %v", err)), nil
+			}
+
+			name := "pve-spice-" + t.node
+			if t.vmid != "" {
+				name += "-" + t.vmid
+			}
+			return mcp.NewToolResultResource(
+				fmt.Sprintf(
+					"Save as %s.vv and open it with virt-viewer within %d seconds; the ticket expires after that.",
+					name, spiceTicketLifetimeSeconds,
+				),
+				mcp.TextResourceContents{
+					URI:      "file:///" + name + ".vv",
+					MIMEType: "application/x-virt-viewer",
+					Text:     spiceVVFile(fields),
+				},
+			), nil
+		},
+	)
+}
@@ -0,0 +1,581 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Severities of disk health findings.
+const (
+	diskSeverityCritical = "critical"
+	diskSeverityWarning  = "warning"
+)
+
+// minSSDWearout is the remaining SSD lifetime (percent) below which a disk is flagged.
+const minSSDWearout = 10
+
+type diskInfo struct {
+	DevPath string `json:"devpath"`
+	Type    string `json:"type"`
+	Model   string `json:"model"`
+	Serial  string `json:"serial"`
+	Health  string `json:"health"`
+	Wearout any    `json:"wearout"`
+}
+
+type smartAttribute struct {
+	ID        json.Number `json:"id"`
+	Name      string      `json:"name"`
+	Value     json.Number `json:"value"`
+	Threshold json.Number `json:"threshold"`
+	Fail      string      `json:"fail"`
+	Raw       string      `json:"raw"`
+}
+
+type smartData struct {
+	Health     string           `json:"health"`
+	Attributes []smartAttribute `json:"attributes"`
+}
+
+type zfsPoolInfo struct {
+	Name   string `json:"name"`
+	Health string `json:"health"`
+}
+
+type lvmThinPool struct {
+	LV           string `json:"lv"`
+	VG           string `json:"vg"`
+	Size         int64  `json:"lv_size"`
+	Used         int64  `json:"used"`
+	MetadataSize int64  `json:"metadata_size"`
+	MetadataUsed int64  `json:"metadata_used"`
+}
+
+// diskFinding is a single problem found by get_disk_health.
+type diskFinding struct {
+	Severity  string `json:"severity"`
+	Component string `json:"component"`
+	Name      string `json:"name"`
+	Message   string `json:"message"`
+}
+
+// diskHealthReport summarizes the disk, ZFS and LVM-thin health of a node.
+type diskHealthReport struct {
+	Node     string        `json:"node"`
+	Status   string        `json:"status"`
+	Summary  string        `json:"summary"`
+	Findings []diskFinding `json:"findings"`
+	Errors   []string      `json:"errors,omitempty"`
+}
+
+// smartFindings flags SMART attributes that are failing now or failed in the
+// past, and normalized values at or below their threshold.
+func smartFindings(dev string, data smartData) []diskFinding {
+	var findings []diskFinding
+	for _, a := range data.Attributes {
+		value, errV := a.Value.Int64()
+		threshold, errT := a.Threshold.Int64()
+		belowThreshold := errV == nil && errT == nil && threshold > 0 && value <= threshold
+
+		switch {
+		case a.Fail == "FAILING_NOW" || belowThreshold:
+			findings = append(findings, diskFinding{
+				Severity:  diskSeverityCritical,
+				Component: "smart",
+				Name:      dev,
+				Message: fmt.Sprintf("SMART attribute %s (%s) is failing: value %s, threshold %s, raw %s",
+					a.ID, a.Name, a.Value, a.Threshold, a.Raw),
+			})
+		case a.Fail != "" && a.Fail != "-":
+			findings = append(findings, diskFinding{
+				Severity:  diskSeverityWarning,
+				Component: "smart",
+				Name:      dev,
+				Message:   fmt.Sprintf("SMART attribute %s (%s) failed in the past (raw %s)", a.ID, a.Name, a.Raw),
+			})
+		}
+	}
+	return findings
+}
+
+// diskListFindings flags disks whose SMART overall health is not passing and
+// SSDs that are close to the end of their rated lifetime.
+func diskListFindings(disks []diskInfo) []diskFinding {
+	var findings []diskFinding
+	for _, d := range disks {
+		switch strings.ToUpper(d.Health) {
+		case "", "PASSED", "OK", "UNKNOWN":
+		default:
+			findings = append(findings, diskFinding{
+				Severity:  diskSeverityCritical,
+				Component: "disk",
+				Name:      d.DevPath,
+				Message:   fmt.Sprintf("SMART overall health is %s (%s %s)", d.Health, d.Model, d.Serial),
+			})
+		}
+
+		var wearout float64
+		switch w := d.Wearout.(type) {
+		case float64:
+			wearout = w
+		case string:
+			v, err := strconv.ParseFloat(w, 64)
+			if err != nil {
+				continue
+			}
+			wearout = v
+		default:
+			continue
+		}
+		if wearout < minSSDWearout {
+			findings = append(findings, diskFinding{
+				Severity:  diskSeverityWarning,
+				Component: "disk",
+				Name:      d.DevPath,
+				Message:   fmt.Sprintf("only %.0f%% of the rated SSD lifetime left", wearout),
+			})
+		}
+	}
+	return findings
+}
+
+func zfsFindings(pools []zfsPoolInfo) []diskFinding {
+	var findings []diskFinding
+	for _, p := range pools {
+		if p.Health == "ONLINE" {
+			continue
+		}
+		severity := diskSeverityWarning
+		if p.Health != "DEGRADED" {
+			severity = diskSeverityCritical
+		}
+		findings = append(findings, diskFinding{
+			Severity:  severity,
+			Component: "zfs",
+			Name:      p.Name,
+			Message:   fmt.Sprintf("ZFS pool is %s", p.Health),
+		})
+	}
+	return findings
+}
+
+// thinPoolFindings flags thin pools whose data or metadata usage reached
+// thresholdPercent. A full thin pool suspends all volumes in it.
+func thinPoolFindings(pools []lvmThinPool, thresholdPercent float64) []diskFinding {
+	var findings []diskFinding
+	check := func(p lvmThinPool, kind string, used, size int64) {
+		if size <= 0 {
+			return
+		}
+		pct := float64(used) * 100 / float64(size)
+		if pct < thresholdPercent {
+			return
+		}
+		severity := diskSeverityWarning
+		if pct >= 98 {
+			severity = diskSeverityCritical
+		}
+		findings = append(findings, diskFinding{
+			Severity:  severity,
+			Component: "lvmthin",
+			Name:      p.VG + "/" + p.LV,
+			Message:   fmt.Sprintf("thin pool %s is %.1f%% full", kind, pct),
+		})
+	}
+	for _, p := range pools {
+		check(p, "data", p.Used, p.Size)
+		check(p, "metadata", p.MetadataUsed, p.MetadataSize)
+	}
+	return findings
+}
+
+// buildDiskHealthReport queries disks, SMART data, ZFS pools and thin pools
+// of node. Endpoints that fail (e.g. no ZFS on the node) are reported in
+// Errors instead of failing the whole report.
+func buildDiskHealthReport(ctx context.Context, c *ProxmoxClient, node string, thinThreshold float64,
+) diskHealthReport {
+	report := diskHealthReport{Node: node, Findings: []diskFinding{}}
+
+	var disks []diskInfo
+	if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/disks/list", node), &disks); err != nil {
+		report.Errors = append(report.Errors, "disks: "+err.Error())
+	}
+	report.Findings = append(report.Findings, diskListFindings(disks)...)
+
+	for _, d := range disks {
+		if d.Type == "partition" {
+			continue
+		}
+		var data smartData
+		path := fmt.Sprintf("/nodes/%s/disks/smart?disk=%s", node, url.QueryEscape(d.DevPath))
+		if err := c.GetJSON(ctx, path, &data); err != nil {
+			report.Errors = append(report.Errors, "smart "+d.DevPath+": "+err.Error())
+			continue
+		}
+		report.Findings = append(report.Findings, smartFindings(d.DevPath, data)...)
+	}
+
+	var pools []zfsPoolInfo
+	if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/disks/zfs", node), &pools); err != nil {
+		report.Errors = append(report.Errors, "zfs: "+err.Error())
+	}
+	report.Findings = append(report.Findings, zfsFindings(pools)...)
+
+	var thin []lvmThinPool
+	if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/disks/lvmthin", node), &thin); err != nil {
+		report.Errors = append(report.Errors, "lvmthin: "+err.Error())
+	}
+	report.Findings = append(report.Findings, thinPoolFindings(thin, thinThreshold)...)
+
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		// "critical" sorts before "warning".
+		return report.Findings[i].Severity < report.Findings[j].Severity
+	})
+
+	if len(report.Findings) == 0 {
+		report.Status = "OK"
+		report.Summary = fmt.Sprintf("No disk problems found on %s", node)
+		return report
+	}
+
+	worst := report.Findings[0]
+	report.Status = "WARNING"
+	if worst.Severity == diskSeverityCritical {
+		report.Status = "CRITICAL"
+	}
+	report.Summary = fmt.Sprintf("%d disk problem(s) on %s; most severe: %s %s: %s",
+		len(report.Findings), node, worst.Component, worst.Name, worst.Message)
+	return report
+}
+
+// diskReadTool registers a read-only tool returning /nodes/{node}/disks/{endpoint}.
+func diskReadTool(s *server.MCPServer, c *ProxmoxClient, name, description, endpoint string) {
+	s.AddTool(
+		mcp.NewTool(name,
+			mcp.WithDescription(description),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/disks/%s", node, endpoint))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
+
+func RegisterDiskTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_disks",
+			mcp.WithDescription("List the physical disks of a node with type, size, usage, SMART health and wearout"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("include_partitions",
+				mcp.Description("Also list partitions: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			path := fmt.Sprintf("/nodes/%s/disks/list", node)
+			if req.GetString("include_partitions", "0") == "1" {
+				path += "?include-partitions=1"
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_disk_smart",
+			mcp.WithDescription("Get the SMART health and attributes of a disk"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("disk",
+				mcp.Description("Block device path (e.g. /dev/sda)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			disk, err := req.RequireString("disk")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/disks/smart?disk=%s", node, url.QueryEscape(disk)))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	diskReadTool(s, c, "list_zfs_pools",
+		"List the ZFS pools of a node with health, size, allocation and fragmentation", "zfs")
+	diskReadTool(s, c, "list_lvm_volume_groups",
+		"List the LVM volume groups of a node with their physical volumes", "lvm")
+	diskReadTool(s, c, "list_lvmthin_pools",
+		"List the LVM thin pools of a node with data and metadata usage", "lvmthin")
+	diskReadTool(s, c, "list_disk_directories",
+		"List the directory mounts (systemd mount units) created on the disks of a node", "directory")
+
+	s.AddTool(
+		mcp.NewTool("get_zfs_pool",
+			mcp.WithDescription("Get the detailed status of a ZFS pool (zpool status): vdevs, errors and scan state"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("ZFS pool name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/disks/zfs/%s", node, url.PathEscape(name)))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_disk_health",
+			mcp.WithDescription(
+				"Check the disks of a node and report findings: failing SMART attributes and overall health, worn "+
+					"out SSDs, degraded or faulted ZFS pools and nearly full LVM thin pools",
+			),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("thin_threshold",
+				mcp.Description("Thin pool data/metadata usage (percent) from which to warn (default: 90)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			threshold, err := strconv.ParseFloat(req.GetString("thin_threshold", "90"), 64)
+			if err != nil || threshold <= 0 || threshold > 100 {
+				return mcp.NewToolResultError("thin_threshold must be a percentage between 0 and 100"), nil
+			}
+
+			out, err := json.MarshalIndent(buildDiskHealthReport(ctx, c, node, threshold), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("initialize_disk_gpt",
+			mcp.WithDescription("Initialize an unused disk with a new GPT partition table. Returns the task UPID"),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("disk",
+				mcp.Description("Block device path (e.g. /dev/sdb)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			disk, err := req.RequireString("disk")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/disks/initgpt", node), url.Values{"disk": {disk}})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_disk_storage",
+			mcp.WithDescription(
+				"Create a ZFS pool, LVM volume group, LVM thin pool or directory on unused disks of a node, "+
+					"optionally adding it as storage. Returns the task UPID",
+			),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("type",
+				mcp.Description("What to create: zfs, lvm, lvmthin, or directory"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Name of the pool, volume group, thin pool or directory storage"),
+				mcp.Required(),
+			),
+			mcp.WithArray("devices",
+				mcp.Description("Block devices to use (e.g. [\"/dev/sdb\"]); only zfs accepts more than one"),
+				mcp.WithStringItems(),
+				mcp.Required(),
+			),
+			mcp.WithString("raidlevel",
+				mcp.Description("ZFS RAID level: single, mirror, raid10, raidz, raidz2, raidz3, draid, draid2, draid3"),
+			),
+			mcp.WithString("ashift",
+				mcp.Description("ZFS pool sector size exponent (default: 12)"),
+			),
+			mcp.WithString("compression",
+				mcp.Description("ZFS compression: on, off, lz4, zstd, gzip, lzjb, zle (default: on)"),
+			),
+			mcp.WithString("filesystem",
+				mcp.Description("Directory filesystem: ext4 or xfs (default: ext4)"),
+			),
+			mcp.WithString("add_storage",
+				mcp.Description("Add the result as a storage definition: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			kind, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			devices, err := req.RequireStringSlice("devices")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if len(devices) == 0 {
+				return mcp.NewToolResultError("at least one device is required"), nil
+			}
+
+			data := url.Values{"name": {name}}
+			if v := req.GetString("add_storage", ""); v != "" {
+				data.Set("add_storage", v)
+			}
+
+			switch kind {
+			case "zfs":
+				data.Set("devices", strings.Join(devices, ","))
+				data.Set("raidlevel", req.GetString("raidlevel", "single"))
+				for _, key := range []string{"ashift", "compression"} {
+					if v := req.GetString(key, ""); v != "" {
+						data.Set(key, v)
+					}
+				}
+			case "lvm", "lvmthin", "directory":
+				if len(devices) != 1 {
+					return mcp.NewToolResultError(kind + " takes exactly one device"), nil
+				}
+				data.Set("device", devices[0])
+				if kind == "directory" {
+					data.Set("filesystem", req.GetString("filesystem", "ext4"))
+				}
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported type %q", kind)), nil
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/disks/%s", node, kind), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("wipe_disk",
+			mcp.WithDescription(
+				"Wipe a disk or partition: removes partition tables, filesystem and LVM signatures. "+
+					"All data on it is lost. Returns the task UPID",
+			),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("disk",
+				mcp.Description("Block device path (e.g. /dev/sdb)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			disk, err := req.RequireString("disk")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Put(ctx, fmt.Sprintf("/nodes/%s/disks/wipedisk", node), url.Values{"disk": {disk}})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
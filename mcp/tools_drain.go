@@ -0,0 +1,675 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// nodeNameRe matches a valid node name. Node names end up in shell commands
+// (ha-manager), so they are checked strictly.
+var nodeNameRe = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+const (
+	defaultDrainTimeout  = 3600
+	defaultDrainParallel = 2
+	// haPollInterval is how often the guest locations are checked while the
+	// HA manager moves guests.
+	haPollInterval = 5 * time.Second
+	// haCommandTimeout bounds a ha-manager call in the node shell.
+	haCommandTimeout = time.Minute
+)
+
+// nodeCapacity is an entry of /nodes.
+type nodeCapacity struct {
+	Node   string  `json:"node"`
+	Status string  `json:"status"`
+	CPU    float64 `json:"cpu"`
+	MaxCPU float64 `json:"maxcpu"`
+	Mem    int64   `json:"mem"`
+	MaxMem int64   `json:"maxmem"`
+}
+
+// drainedGuest is a guest moved off a drained node. HA-managed guests are
+// moved by the HA manager, so they have no planned target.
+type drainedGuest struct {
+	VMID   int    `json:"vmid"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	HA     bool   `json:"ha,omitempty"`
+	Target string `json:"target,omitempty"`
+	Result string `json:"result,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// drainRecord is stored in the state directory while a node is drained, so
+// that undrain_node can move the guests back.
+type drainRecord struct {
+	Node          string    `json:"node"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished,omitzero"`
+	HAMaintenance bool      `json:"ha_maintenance"`
+	// WithLocalDisks is set when VMs were migrated with their local disks,
+	// so that undrain_node moves them back the same way.
+	WithLocalDisks bool           `json:"with_local_disks,omitempty"`
+	Guests         []drainedGuest `json:"guests"`
+}
+
+func drainStateName(node string) string {
+	return "drain-" + node
+}
+
+func haSID(r clusterResource) string {
+	if r.Type == "lxc" {
+		return "ct:" + strconv.Itoa(r.VMID)
+	}
+	return "vm:" + strconv.Itoa(r.VMID)
+}
+
+// haResources returns the SIDs of all HA-managed resources.
+func haResources(ctx context.Context, c *ProxmoxClient) (map[string]bool, error) {
+	var resources []struct {
+		SID string `json:"sid"`
+	}
+	if err := c.GetJSON(ctx, "/cluster/ha/resources", &resources); err != nil {
+		return nil, err
+	}
+	sids := make(map[string]bool, len(resources))
+	for _, r := range resources {
+		sids[r.SID] = true
+	}
+	return sids, nil
+}
+
+// setHAMaintenance enables or disables the HA maintenance mode of node. There
+// is no API endpoint for it, so ha-manager is run in the node shell.
+func setHAMaintenance(ctx context.Context, c *ProxmoxClient, node string, enable bool) error {
+	if !nodeNameRe.MatchString(node) {
+		return fmt.Errorf("invalid node name %q", node)
+	}
+	mode := "disable"
+	if enable {
+		mode = "enable"
+	}
+	res, err := runTerminalCommand(ctx, c, "/nodes/"+node,
+		"ha-manager crm-command node-maintenance "+mode+" "+node, haCommandTimeout)
+	if err != nil {
+		return fmt.Errorf("%s HA maintenance: %w", mode, err)
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s HA maintenance failed (exit code %d): %s", mode, res.ExitCode,
+			strings.TrimSpace(res.Output))
+	}
+	return nil
+}
+
+// nodeGuests returns the guests on node, templates excluded.
+func nodeGuests(ctx context.Context, c *ProxmoxClient, node string) ([]clusterResource, error) {
+	all, err := selectGuests(ctx, c, bulkSelector{})
+	if err != nil {
+		return nil, err
+	}
+	var guests []clusterResource
+	for _, g := range all {
+		if g.Node == node {
+			guests = append(guests, g)
+		}
+	}
+	return guests, nil
+}
+
+// planDrain assigns a target node to every guest that is not HA-managed.
+// Running guests go to the candidate with the most free memory that can hold
+// their configured memory, ties broken by lower CPU load; the chosen node's
+// free memory and load are updated before the next guest is placed. Stopped
+// guests only need a node to live on.
+func planDrain(guests []clusterResource, ha map[string]bool, candidates []nodeCapacity) []drainedGuest {
+	free := map[string]int64{}
+	load := map[string]float64{}
+	for _, n := range candidates {
+		free[n.Node] = n.MaxMem - n.Mem
+		load[n.Node] = n.CPU * n.MaxCPU
+	}
+	loadRatio := func(n nodeCapacity) float64 {
+		if n.MaxCPU == 0 {
+			return 0
+		}
+		return load[n.Node] / n.MaxCPU
+	}
+
+	order := slices.Clone(guests)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].MaxMem > order[j].MaxMem })
+
+	plan := make([]drainedGuest, 0, len(order))
+	for _, g := range order {
+		d := drainedGuest{VMID: g.VMID, Name: g.Name, Type: g.Type, Status: g.Status, HA: ha[haSID(g)]}
+		if d.HA {
+			plan = append(plan, d)
+			continue
+		}
+
+		running := g.Status == "running"
+		var best *nodeCapacity
+		for i := range candidates {
+			n := &candidates[i]
+			if running && free[n.Node] < g.MaxMem {
+				continue
+			}
+			if best == nil || free[n.Node] > free[best.Node] ||
+				(free[n.Node] == free[best.Node] && loadRatio(*n) < loadRatio(*best)) {
+				best = n
+			}
+		}
+		if best == nil {
+			d.Result = "failed"
+			d.Detail = fmt.Sprintf("no target node has %d MiB of free memory", g.MaxMem>>20)
+			plan = append(plan, d)
+			continue
+		}
+		d.Target = best.Node
+		if running {
+			free[best.Node] -= g.MaxMem
+			load[best.Node] += g.CPU * g.MaxCPU
+		}
+		plan = append(plan, d)
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].VMID < plan[j].VMID })
+	return plan
+}
+
+// mergeDrainedGuests replaces the entries of a resumed drain record with the
+// new plan for the guests that are still on the node.
+func mergeDrainedGuests(recorded, plan []drainedGuest) []drainedGuest {
+	merged := slices.Clone(recorded)
+	for _, p := range plan {
+		i := slices.IndexFunc(merged, func(d drainedGuest) bool { return d.VMID == p.VMID })
+		if i < 0 {
+			merged = append(merged, p)
+		} else {
+			merged[i] = p
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].VMID < merged[j].VMID })
+	return merged
+}
+
+// migrateGuestOperation migrates guests to the node returned by target:
+// running VMs live, running containers by restart migration, stopped guests
+// offline.
+func migrateGuestOperation(c *ProxmoxClient, target func(r clusterResource) string, withLocalDisks bool,
+	timeout time.Duration,
+) bulkOperation {
+	return guestTaskOperation(c, "migrate", func(r clusterResource) url.Values {
+		data := url.Values{"target": {target(r)}}
+		if r.Status == "running" {
+			if r.Type == "qemu" {
+				data.Set("online", "1")
+			} else {
+				data.Set("restart", "1")
+				data.Set("timeout", strconv.Itoa(defaultShutdownTimeout))
+			}
+		}
+		if withLocalDisks && r.Type == "qemu" {
+			data.Set("with-local-disks", "1")
+		}
+		return data
+	}, func(clusterResource) string { return "" }, timeout)
+}
+
+// waitForGuestLocation polls until every guest in vmids is on node (onNode)
+// or off it (!onNode), and returns the guests that did not get there.
+func waitForGuestLocation(ctx context.Context, c *ProxmoxClient, vmids []int, node string, onNode bool,
+	progress progressFunc,
+) ([]int, error) {
+	for {
+		all, err := selectGuests(ctx, c, bulkSelector{})
+		if err != nil {
+			return vmids, err
+		}
+		location := map[int]string{}
+		for _, g := range all {
+			location[g.VMID] = g.Node
+		}
+		var pending []int
+		for _, id := range vmids {
+			if (location[id] == node) != onNode {
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			return nil, nil
+		}
+		progress(float64(len(vmids)-len(pending)), float64(len(vmids)),
+			fmt.Sprintf("waiting for the HA manager to move %d guests", len(pending)))
+
+		select {
+		case <-ctx.Done():
+			return pending, ctx.Err()
+		case <-time.After(haPollInterval):
+		}
+	}
+}
+
+// drainProgress reports the phases of a drain or undrain as one increasing
+// count of steps: switching the HA maintenance mode, the migrations and the
+// guests moved by the HA manager. Values that do not increase are dropped.
+type drainProgress struct {
+	progress    progressFunc
+	total, last float64
+}
+
+// phase returns a progressFunc for a phase whose steps start after offset.
+func (p *drainProgress) phase(offset int) progressFunc {
+	return func(done, _ float64, message string) {
+		if v := float64(offset) + done; v > p.last {
+			p.last = v
+			p.progress(v, p.total, message)
+		}
+	}
+}
+
+// errDrainPoolScoped is returned when pool scoping is enabled: a drain moves
+// every guest on the node, including guests outside the allowed pools.
+var errDrainPoolScoped = errors.New("draining a node moves guests outside the allowed pools and is not " +
+	"available when allowed_pools is set")
+
+// drainParams configures drainNode.
+type drainParams struct {
+	node           string
+	targets        []string
+	parallel       int
+	timeout        time.Duration
+	withLocalDisks bool
+	haMaintenance  bool
+	dryRun         bool
+	// resume continues a drain whose record already exists, moving the
+	// guests that are still on the node.
+	resume bool
+}
+
+// drainNode moves all guests off a node and records them in the state
+// directory. It returns the record also when some guests failed to move.
+func drainNode(ctx context.Context, c *ProxmoxClient, opts Options, p drainParams, //nolint:funlen,gocognit
+	progress progressFunc,
+) (drainRecord, error) {
+	if len(opts.AllowedPools) > 0 {
+		return drainRecord{}, errDrainPoolScoped
+	}
+	if !nodeNameRe.MatchString(p.node) {
+		return drainRecord{}, fmt.Errorf("invalid node name %q", p.node)
+	}
+	var existing drainRecord
+	if !p.dryRun {
+		err := readStateFile(opts.StateDir, drainStateName(p.node), &existing)
+		switch {
+		case err == nil && !p.resume:
+			return drainRecord{}, fmt.Errorf("node %s is already drained since %s; run undrain_node first or "+
+				"resume the drain",
+				p.node, existing.Started.Format(time.RFC3339))
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return drainRecord{}, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	guests, err := nodeGuests(ctx, c, p.node)
+	if err != nil {
+		return drainRecord{}, err
+	}
+	ha, err := haResources(ctx, c)
+	if err != nil {
+		return drainRecord{}, err
+	}
+	hasHAGuests := slices.ContainsFunc(guests, func(g clusterResource) bool { return ha[haSID(g)] })
+	useMaintenance := p.haMaintenance && len(ha) > 0
+	if hasHAGuests && !useMaintenance {
+		return drainRecord{}, errors.New("the node runs HA-managed guests, which can only be moved by the " +
+			"HA maintenance mode (ha_maintenance=1)")
+	}
+	if useMaintenance && !opts.AllowElevated {
+		return drainRecord{}, errors.New("HA maintenance mode is set with ha-manager in the node shell, which " +
+			"requires allow_elevated_tools")
+	}
+
+	var nodes []nodeCapacity
+	if err := c.GetJSON(ctx, "/nodes", &nodes); err != nil {
+		return drainRecord{}, err
+	}
+	var candidates []nodeCapacity
+	for _, n := range nodes {
+		if n.Node != p.node && n.Status == "online" && (len(p.targets) == 0 || slices.Contains(p.targets, n.Node)) {
+			candidates = append(candidates, n)
+		}
+	}
+	if len(candidates) == 0 && len(guests) > 0 {
+		return drainRecord{}, errors.New("no online target node available")
+	}
+
+	plan := planDrain(guests, ha, candidates)
+	rec := drainRecord{Node: p.node, Started: time.Now().UTC(), Guests: plan}
+	if p.dryRun {
+		return rec, nil
+	}
+	if existing.Node != "" {
+		rec = existing
+		rec.Finished = time.Time{}
+		rec.Guests = mergeDrainedGuests(existing.Guests, plan)
+	}
+	rec.WithLocalDisks = rec.WithLocalDisks || p.withLocalDisks
+	if err := writeStateFile(opts.StateDir, drainStateName(p.node), rec); err != nil {
+		return rec, err
+	}
+
+	targets := map[int]string{}
+	var toMigrate []clusterResource
+	var haGuests []int
+	for _, d := range rec.Guests {
+		switch {
+		case d.HA:
+			haGuests = append(haGuests, d.VMID)
+		case d.Target != "":
+			targets[d.VMID] = d.Target
+		}
+	}
+	for _, g := range guests {
+		if targets[g.VMID] != "" {
+			toMigrate = append(toMigrate, g)
+		}
+	}
+
+	steps := 0
+	if useMaintenance && !rec.HAMaintenance {
+		steps = 1
+	}
+	pr := &drainProgress{progress: progress, total: float64(steps + len(toMigrate) + len(haGuests))}
+	if steps > 0 {
+		if err := setHAMaintenance(ctx, c, p.node, true); err != nil {
+			return rec, err
+		}
+		pr.phase(0)(1, 0, "enabled HA maintenance mode on "+p.node)
+		rec.HAMaintenance = true
+		if err := writeStateFile(opts.StateDir, drainStateName(p.node), rec); err != nil {
+			return rec, err
+		}
+	}
+
+	op := migrateGuestOperation(c, func(r clusterResource) string { return targets[r.VMID] }, p.withLocalDisks,
+		p.timeout)
+	results := map[int]bulkGuestResult{}
+	for _, r := range runBulk(ctx, toMigrate, p.parallel, op, pr.phase(steps)) {
+		results[r.VMID] = r
+	}
+
+	var stuck []int
+	var waitErr error
+	if len(haGuests) > 0 {
+		stuck, waitErr = waitForGuestLocation(ctx, c, haGuests, p.node, false, pr.phase(steps+len(toMigrate)))
+	}
+
+	for i := range rec.Guests {
+		d := &rec.Guests[i]
+		switch {
+		case d.HA && slices.Contains(stuck, d.VMID):
+			d.Result = "failed"
+			d.Detail = fmt.Sprintf("still on %s: %v", p.node, waitErr)
+		case d.HA:
+			d.Result = "ok"
+			d.Detail = "moved by the HA manager"
+		case d.Target != "":
+			if r, ok := results[d.VMID]; ok {
+				d.Result, d.Detail = r.Result, r.Detail
+			}
+		}
+	}
+	rec.Finished = time.Now().UTC()
+	return rec, writeStateFile(opts.StateDir, drainStateName(p.node), rec)
+}
+
+// undrainReport is returned by undrainNode.
+type undrainReport struct {
+	Node                  string            `json:"node"`
+	HAMaintenanceDisabled bool              `json:"ha_maintenance_disabled"`
+	Results               []bulkGuestResult `json:"results"`
+	RecordRemoved         bool              `json:"record_removed"`
+}
+
+// undrainNode moves the guests recorded by drainNode back to the node and
+// removes the record once every guest is back.
+func undrainNode(ctx context.Context, c *ProxmoxClient, opts Options, node string, parallel int,
+	timeout time.Duration, progress progressFunc,
+) (undrainReport, error) {
+	if len(opts.AllowedPools) > 0 {
+		return undrainReport{}, errDrainPoolScoped
+	}
+	if !nodeNameRe.MatchString(node) {
+		return undrainReport{}, fmt.Errorf("invalid node name %q", node)
+	}
+	var rec drainRecord
+	if err := readStateFile(opts.StateDir, drainStateName(node), &rec); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return undrainReport{}, fmt.Errorf("no drain record for node %s", node)
+		}
+		return undrainReport{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	report := undrainReport{Node: node}
+
+	steps := 0
+	if rec.HAMaintenance {
+		if !opts.AllowElevated {
+			return report, errors.New("HA maintenance mode is disabled with ha-manager in the node shell, which " +
+				"requires allow_elevated_tools")
+		}
+		if err := setHAMaintenance(ctx, c, node, false); err != nil {
+			return report, err
+		}
+		steps = 1
+		report.HAMaintenanceDisabled = true
+		rec.HAMaintenance = false
+		if err := writeStateFile(opts.StateDir, drainStateName(node), rec); err != nil {
+			return report, err
+		}
+	}
+
+	all, err := selectGuests(ctx, c, bulkSelector{})
+	if err != nil {
+		return report, err
+	}
+	current := map[int]clusterResource{}
+	for _, g := range all {
+		current[g.VMID] = g
+	}
+
+	var toMigrate []clusterResource
+	var haGuests []int
+	for _, d := range rec.Guests {
+		g, exists := current[d.VMID]
+		row := bulkGuestResult{VMID: d.VMID, Name: d.Name, Type: d.Type, Node: g.Node}
+		switch {
+		case d.Result != "ok":
+			row.Result, row.Detail = "skipped", "was not moved by the drain"
+		case !exists:
+			row.Result, row.Detail = "skipped", "guest no longer exists"
+		case g.Node == node:
+			row.Result, row.Detail = "skipped", "already on "+node
+		case d.HA:
+			haGuests = append(haGuests, d.VMID)
+			continue
+		default:
+			toMigrate = append(toMigrate, g)
+			continue
+		}
+		report.Results = append(report.Results, row)
+	}
+
+	op := migrateGuestOperation(c, func(clusterResource) string { return node }, rec.WithLocalDisks, timeout)
+	pr := &drainProgress{progress: progress, total: float64(steps + len(toMigrate) + len(haGuests))}
+	if steps > 0 {
+		pr.phase(0)(1, 0, "disabled HA maintenance mode on "+node)
+	}
+	report.Results = append(report.Results, runBulk(ctx, toMigrate, parallel, op, pr.phase(steps))...)
+
+	if len(haGuests) > 0 {
+		stuck, waitErr := waitForGuestLocation(ctx, c, haGuests, node, true, pr.phase(steps+len(toMigrate)))
+		for _, id := range haGuests {
+			g := current[id]
+			row := bulkGuestResult{VMID: id, Name: g.Name, Type: g.Type, Node: node, Result: "ok",
+				Detail: "moved back by the HA manager"}
+			if slices.Contains(stuck, id) {
+				row.Node, row.Result, row.Detail = g.Node, "failed", fmt.Sprintf("not back on %s: %v", node, waitErr)
+			}
+			report.Results = append(report.Results, row)
+		}
+	}
+	sort.Slice(report.Results, func(i, j int) bool { return report.Results[i].VMID < report.Results[j].VMID })
+
+	if !slices.ContainsFunc(report.Results, func(r bulkGuestResult) bool { return r.Result == "failed" }) {
+		if err := removeStateFile(opts.StateDir, drainStateName(node)); err != nil {
+			return report, err
+		}
+		report.RecordRemoved = true
+	}
+	return report, nil
+}
+
+func RegisterDrainTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen
+	s.AddTool(
+		mcp.NewTool("drain_node",
+			mcp.WithDescription(
+				"Move every guest off a node for maintenance: running VMs by live migration, running containers "+
+					"by restart migration, stopped guests offline, each to the node with the most free memory. "+
+					"When HA is in use, the node is put in HA maintenance mode (requires allow_elevated_tools) so "+
+					"the HA manager moves its guests. Waits for all migrations, reports progress and records the "+
+					"moves for undrain_node. Templates stay on the node",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node to drain"),
+				mcp.Required(),
+			),
+			mcp.WithArray("targets",
+				mcp.Description("Only migrate to these nodes (default: all other online nodes)"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithString("parallel",
+				mcp.Description("Number of migrations run in parallel (default: 2, max: 16)"),
+			),
+			mcp.WithString("with_local_disks",
+				mcp.Description("Also migrate VMs with disks on local storage: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("ha_maintenance",
+				mcp.Description("Enable HA maintenance mode when HA is in use: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the whole drain (default: 3600)"),
+			),
+			mcp.WithString("dry_run",
+				mcp.Description("Only show the planned targets: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("resume",
+				mcp.Description("Continue an earlier drain of the node that left guests behind: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			parallel, err := strconv.Atoi(req.GetString("parallel", strconv.Itoa(defaultDrainParallel)))
+			if err != nil || parallel < 1 || parallel > maxBulkConcurrency {
+				return mcp.NewToolResultError(fmt.Sprintf("parallel must be between 1 and %d", maxBulkConcurrency)), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultDrainTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			rec, err := drainNode(ctx, c, opts, drainParams{
+				node:           node,
+				targets:        req.GetStringSlice("targets", nil),
+				parallel:       parallel,
+				timeout:        time.Duration(timeout) * time.Second,
+				withLocalDisks: req.GetString("with_local_disks", "0") == "1",
+				haMaintenance:  req.GetString("ha_maintenance", "1") == "1",
+				dryRun:         req.GetString("dry_run", "0") == "1",
+				resume:         req.GetString("resume", "0") == "1",
+			}, progressReporter(ctx, req))
+			if err != nil && rec.Node == "" {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, jsonErr := json.MarshalIndent(rec, "", "  ")
+			if jsonErr != nil {
+				return mcp.NewToolResultError(jsonErr.Error()), nil
+			}
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("drain of %s stopped: %v\n%s", node, err, out)), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("undrain_node",
+			mcp.WithDescription(
+				"Move the guests recorded by drain_node back to the node (with their local disks if the drain "+
+					"used with_local_disks) and disable its HA maintenance mode. The record is removed once every "+
+					"guest is back; failed guests can be retried by calling undrain_node again",
+			),
+			mcp.WithString("node",
+				mcp.Description("Drained node"),
+				mcp.Required(),
+			),
+			mcp.WithString("parallel",
+				mcp.Description("Number of migrations run in parallel (default: 2, max: 16)"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the whole undrain (default: 3600)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			parallel, err := strconv.Atoi(req.GetString("parallel", strconv.Itoa(defaultDrainParallel)))
+			if err != nil || parallel < 1 || parallel > maxBulkConcurrency {
+				return mcp.NewToolResultError(fmt.Sprintf("parallel must be between 1 and %d", maxBulkConcurrency)), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultDrainTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			report, err := undrainNode(ctx, c, opts, node, parallel, time.Duration(timeout)*time.Second,
+				progressReporter(ctx, req))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+}
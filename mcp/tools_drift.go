@@ -0,0 +1,762 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	baselineStatePrefix = "baseline-"
+	minDriftInterval    = 5
+	// driftWebhookTimeout bounds a webhook delivery.
+	driftWebhookTimeout = 30 * time.Second
+)
+
+// driftScope is what a baseline covers.
+type driftScope struct {
+	VMIDs    []int `json:"vmids"`
+	Storages bool  `json:"storages"`
+	Firewall bool  `json:"firewall"`
+	HA       bool  `json:"ha"`
+}
+
+// driftState holds flattened configs by kind and ID, e.g. Guests["100"]["memory"].
+// Firewall rules are keyed by their content (see addFirewallRules).
+type driftState struct {
+	Guests   map[string]map[string]string `json:"guests"`
+	Storages map[string]map[string]string `json:"storages,omitempty"`
+	Firewall map[string]map[string]string `json:"firewall,omitempty"`
+	HA       map[string]map[string]string `json:"ha,omitempty"`
+}
+
+type driftSchedule struct {
+	IntervalMinutes int       `json:"interval_minutes"`
+	WebhookURL      string    `json:"webhook_url"`
+	LastRun         time.Time `json:"last_run,omitzero"`
+	LastFindings    int       `json:"last_findings"`
+	LastError       string    `json:"last_error,omitempty"`
+}
+
+// driftBaseline is the stored baseline.
+type driftBaseline struct {
+	Name     string         `json:"name"`
+	Created  time.Time      `json:"created"`
+	Scope    driftScope     `json:"scope"`
+	State    driftState     `json:"state"`
+	Schedule *driftSchedule `json:"schedule,omitempty"`
+}
+
+// driftFinding is a difference between the baseline and the live cluster.
+// Pending findings are guest changes that only take effect after a restart.
+type driftFinding struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Field    string `json:"field,omitempty"`
+	Change   string `json:"change"`
+	Baseline string `json:"baseline,omitempty"`
+	Live     string `json:"live,omitempty"`
+}
+
+type driftReport struct {
+	Baseline string         `json:"baseline"`
+	Checked  time.Time      `json:"checked"`
+	Findings []driftFinding `json:"findings"`
+}
+
+// flattenConfig converts a config object to strings, leaving out the digest
+// and secrets.
+func flattenConfig(conf map[string]any, skip ...string) map[string]string {
+	flat := make(map[string]string, len(conf))
+	for k := range conf {
+		if k == "digest" || slices.Contains(skip, k) || sensitiveParamRe.MatchString(k) {
+			continue
+		}
+		flat[k] = configString(conf, k)
+	}
+	return flat
+}
+
+func guestConfigPath(r clusterResource) string {
+	return fmt.Sprintf("/nodes/%s/%s/%d", r.Node, r.Type, r.VMID)
+}
+
+// addFirewallRules adds the rules of a firewall (cluster or a VMID) keyed by
+// scope and content, e.g. "cluster/action=ACCEPT,dport=22,type=in", so that
+// inserting or deleting a rule does not shift the keys of the others. Identical
+// rules are numbered ("#2"). The position is kept in the pos field.
+func addFirewallRules(into map[string]map[string]string, scope string, rules []map[string]any) {
+	for _, rule := range rules {
+		flat := flattenConfig(rule, "pos")
+		parts := make([]string, 0, len(flat))
+		for _, k := range sortedKeys(flat) {
+			parts = append(parts, k+"="+flat[k])
+		}
+		key := scope + "/" + strings.Join(parts, ",")
+		id := key
+		for n := 2; into[id] != nil; n++ {
+			id = fmt.Sprintf("%s#%d", key, n)
+		}
+		flat["pos"] = configString(rule, "pos")
+		into[id] = flat
+	}
+}
+
+// collectDriftState reads the live configuration covered by scope.
+func collectDriftState(ctx context.Context, c *ProxmoxClient, scope driftScope, //nolint:funlen,gocognit
+) (driftState, map[string]clusterResource, error) {
+	st := driftState{Guests: map[string]map[string]string{}}
+	var resources []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+		return st, nil, err
+	}
+	guests := map[string]clusterResource{}
+	for _, r := range resources {
+		if slices.Contains(scope.VMIDs, r.VMID) {
+			guests[strconv.Itoa(r.VMID)] = r
+		}
+	}
+
+	if scope.Firewall {
+		st.Firewall = map[string]map[string]string{}
+		var rules []map[string]any
+		if err := c.GetJSON(ctx, "/cluster/firewall/rules", &rules); err != nil {
+			return st, nil, err
+		}
+		addFirewallRules(st.Firewall, "cluster", rules)
+	}
+
+	for _, id := range sortedKeys(guests) {
+		r := guests[id]
+		// current=1 returns the running values; pending changes are
+		// reported separately.
+		var conf map[string]any
+		if err := c.GetJSON(ctx, guestConfigPath(r)+"/config?current=1", &conf); err != nil {
+			return st, nil, err
+		}
+		flat := flattenConfig(conf)
+		flat["node"] = r.Node
+		flat["type"] = r.Type
+		st.Guests[id] = flat
+
+		if scope.Firewall {
+			var rules []map[string]any
+			if err := c.GetJSON(ctx, guestConfigPath(r)+"/firewall/rules", &rules); err != nil {
+				return st, nil, err
+			}
+			addFirewallRules(st.Firewall, id, rules)
+		}
+	}
+
+	if scope.Storages {
+		st.Storages = map[string]map[string]string{}
+		var storages []map[string]any
+		if err := c.GetJSON(ctx, "/storage", &storages); err != nil {
+			return st, nil, err
+		}
+		for _, s := range storages {
+			st.Storages[configString(s, "storage")] = flattenConfig(s)
+		}
+	}
+
+	if scope.HA {
+		st.HA = map[string]map[string]string{}
+		var resources []map[string]any
+		if err := c.GetJSON(ctx, "/cluster/ha/resources", &resources); err != nil {
+			return st, nil, err
+		}
+		for _, r := range resources {
+			st.HA[configString(r, "sid")] = flattenConfig(r)
+		}
+	}
+	return st, guests, nil
+}
+
+// compareDriftKind compares the configs of one kind field by field.
+func compareDriftKind(kind string, base, live map[string]map[string]string) []driftFinding {
+	var findings []driftFinding
+	ids := sortedKeys(base)
+	for _, id := range sortedKeys(live) {
+		if _, ok := base[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range ids {
+		b, inBase := base[id]
+		l, inLive := live[id]
+		switch {
+		case !inLive:
+			findings = append(findings, driftFinding{Kind: kind, ID: id, Change: "removed"})
+			continue
+		case !inBase:
+			findings = append(findings, driftFinding{Kind: kind, ID: id, Change: "added"})
+			continue
+		}
+		fields := sortedKeys(b)
+		for _, f := range sortedKeys(l) {
+			if _, ok := b[f]; !ok {
+				fields = append(fields, f)
+			}
+		}
+		for _, f := range fields {
+			bv, inB := b[f]
+			lv, inL := l[f]
+			switch {
+			case !inL:
+				findings = append(findings, driftFinding{Kind: kind, ID: id, Field: f, Change: "removed", Baseline: bv})
+			case !inB:
+				findings = append(findings, driftFinding{Kind: kind, ID: id, Field: f, Change: "added", Live: lv})
+			case bv != lv:
+				findings = append(findings, driftFinding{
+					Kind: kind, ID: id, Field: f, Change: "changed", Baseline: bv, Live: lv,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// compareFirewallRules reports the rules added and removed since the baseline,
+// and the rules that moved: those outside the longest sequence of rules kept
+// in the same order, so that an inserted or deleted rule moves no other rule.
+func compareFirewallRules(base, live map[string]map[string]string) []driftFinding {
+	withoutPos := func(rules map[string]map[string]string) map[string]map[string]string {
+		out := make(map[string]map[string]string, len(rules))
+		for id, r := range rules {
+			out[id] = maps.Clone(r)
+			delete(out[id], "pos")
+		}
+		return out
+	}
+	findings := compareDriftKind("firewall", withoutPos(base), withoutPos(live))
+
+	// Group the rules present in both by firewall.
+	common := map[string][]string{}
+	for _, id := range sortedKeys(base) {
+		if _, ok := live[id]; ok {
+			scope, _, _ := strings.Cut(id, "/")
+			common[scope] = append(common[scope], id)
+		}
+	}
+	for _, scope := range sortedKeys(common) {
+		byPos := func(rules map[string]map[string]string) []string {
+			ids := slices.Clone(common[scope])
+			slices.SortStableFunc(ids, func(a, b string) int {
+				pa, _ := strconv.Atoi(rules[a]["pos"])
+				pb, _ := strconv.Atoi(rules[b]["pos"])
+				return pa - pb
+			})
+			return ids
+		}
+		kept := longestCommonSequence(byPos(base), byPos(live))
+		for _, id := range byPos(live) {
+			if !kept[id] {
+				findings = append(findings, driftFinding{
+					Kind: "firewall", ID: id, Field: "pos", Change: "moved",
+					Baseline: base[id]["pos"], Live: live[id]["pos"],
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// longestCommonSequence returns the elements of the longest common
+// subsequence of a and b, which hold the same distinct elements.
+func longestCommonSequence(a, b []string) map[string]bool {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	kept := map[string]bool{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			kept[a[i]] = true
+			i++
+			j++
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return kept
+}
+
+// pendingFindings lists the pending config changes of a guest.
+func pendingFindings(ctx context.Context, c *ProxmoxClient, id string, r clusterResource) ([]driftFinding, error) {
+	var pending []map[string]any
+	if err := c.GetJSON(ctx, guestConfigPath(r)+"/pending", &pending); err != nil {
+		return nil, err
+	}
+	var findings []driftFinding
+	for _, p := range pending {
+		key := configString(p, "key")
+		if sensitiveParamRe.MatchString(key) {
+			continue
+		}
+		f := driftFinding{Kind: "pending", ID: id, Field: key, Baseline: configString(p, "value")}
+		switch {
+		case configString(p, "delete") != "":
+			f.Change = "pending delete"
+		case configString(p, "pending") != "":
+			f.Change = "pending change"
+			f.Live = configString(p, "pending")
+		default:
+			continue
+		}
+		findings = append(findings, f)
+	}
+	return findings, nil
+}
+
+// detectDrift compares the live cluster with a baseline.
+func detectDrift(ctx context.Context, c *ProxmoxClient, b *driftBaseline) (driftReport, error) {
+	report := driftReport{Baseline: b.Name, Checked: time.Now().UTC(), Findings: []driftFinding{}}
+	live, guests, err := collectDriftState(ctx, c, b.Scope)
+	if err != nil {
+		return report, err
+	}
+	report.Findings = append(report.Findings, compareDriftKind("guest", b.State.Guests, live.Guests)...)
+	for _, id := range sortedKeys(guests) {
+		pending, err := pendingFindings(ctx, c, id, guests[id])
+		if err != nil {
+			return report, err
+		}
+		report.Findings = append(report.Findings, pending...)
+	}
+	report.Findings = append(report.Findings, compareDriftKind("storage", b.State.Storages, live.Storages)...)
+	report.Findings = append(report.Findings, compareFirewallRules(b.State.Firewall, live.Firewall)...)
+	report.Findings = append(report.Findings, compareDriftKind("ha", b.State.HA, live.HA)...)
+	return report, nil
+}
+
+// postDriftWebhook sends a drift report as JSON to url.
+func postDriftWebhook(ctx context.Context, webhookURL string, report driftReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, driftWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("posting drift report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("posting drift report: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// redactedURL hides the query of a webhook URL, which often holds a token.
+func redactedURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.RawQuery == "" {
+		return raw
+	}
+	u.RawQuery = "[REDACTED]"
+	return u.String()
+}
+
+// driftScheduler runs the scheduled drift checks of the stored baselines.
+type driftScheduler struct {
+	c    *ProxmoxClient
+	opts Options
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func (d *driftScheduler) load(name string) (*driftBaseline, error) {
+	var b driftBaseline
+	if err := readStateFile(d.opts.StateDir, baselineStatePrefix+name, &b); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no drift baseline %s", name)
+		}
+		return nil, err
+	}
+	return &b, nil
+}
+
+// start (re)starts the scheduled check of a baseline; a nil schedule stops it.
+func (d *driftScheduler) start(name string, schedule *driftSchedule) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cancel, ok := d.cancels[name]; ok {
+		cancel()
+		delete(d.cancels, name)
+	}
+	if schedule == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancels[name] = cancel
+	go d.loop(ctx, name, time.Duration(schedule.IntervalMinutes)*time.Minute)
+}
+
+// resume starts the schedules saved in the state directory.
+func (d *driftScheduler) resume() {
+	names, err := listStateFiles(d.opts.StateDir, baselineStatePrefix)
+	if err != nil {
+		return
+	}
+	for _, name := range names {
+		b, err := d.load(strings.TrimPrefix(name, baselineStatePrefix))
+		if err != nil {
+			log.Warnf("Drift baseline %s: %v", name, err)
+			continue
+		}
+		if b.Schedule != nil {
+			d.start(b.Name, b.Schedule)
+		}
+	}
+}
+
+func (d *driftScheduler) loop(ctx context.Context, name string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := d.check(ctx, name); err != nil {
+			log.Warnf("Scheduled drift check of %s failed: %v", name, err)
+		}
+	}
+}
+
+// check runs a drift check, posts the findings to the webhook and saves the
+// outcome in the baseline.
+func (d *driftScheduler) check(ctx context.Context, name string) error {
+	b, err := d.load(name)
+	if err != nil || b.Schedule == nil {
+		return err
+	}
+	report, err := detectDrift(ctx, d.c, b)
+	if err == nil && len(report.Findings) > 0 {
+		err = postDriftWebhook(ctx, b.Schedule.WebhookURL, report)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Reload so that a schedule changed meanwhile is not overwritten.
+	current, loadErr := d.load(name)
+	if loadErr != nil || current.Schedule == nil {
+		return err
+	}
+	current.Schedule.LastRun = report.Checked
+	current.Schedule.LastFindings = len(report.Findings)
+	current.Schedule.LastError = ""
+	if err != nil {
+		current.Schedule.LastError = err.Error()
+	}
+	if saveErr := writeStateFile(d.opts.StateDir, baselineStatePrefix+name, current); saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+func RegisterDriftTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	d := &driftScheduler{c: c, opts: opts, cancels: map[string]context.CancelFunc{}}
+	d.resume()
+
+	s.AddTool(
+		mcp.NewTool("create_drift_baseline",
+			mcp.WithDescription(
+				"Save the current configuration of selected guests, and optionally of the storages, firewall "+
+					"rules (cluster and guest level) and HA resources, as a named baseline in state_dir for "+
+					"detect_drift. An existing baseline with the same name is replaced",
+			),
+			mcp.WithString("name",
+				mcp.Description("Baseline name (letters, digits, '.', '_' and '-')"),
+				mcp.Required(),
+			),
+			mcp.WithArray("vmids",
+				mcp.Description("Guest IDs to include"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithString("tag",
+				mcp.Description("Include guests with this tag"),
+			),
+			mcp.WithString("pool",
+				mcp.Description("Include the guests of this pool"),
+			),
+			mcp.WithString("name_pattern",
+				mcp.Description("Include guests whose name matches this glob pattern (e.g. web-*)"),
+			),
+			mcp.WithString("storages",
+				mcp.Description("Include the storage configuration: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("firewall",
+				mcp.Description("Include the cluster firewall rules and those of the selected guests: 1 or 0 "+
+					"(default: 0)"),
+			),
+			mcp.WithString("ha",
+				mcp.Description("Include the HA resources: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			scope := driftScope{
+				Storages: req.GetString("storages", "0") == "1",
+				Firewall: req.GetString("firewall", "0") == "1",
+				HA:       req.GetString("ha", "0") == "1",
+			}
+			if len(opts.AllowedPools) > 0 && (scope.Storages || scope.Firewall || scope.HA) {
+				return mcp.NewToolResultError("storages, firewall and ha cover the whole cluster and are not " +
+					"available when allowed_pools is set"), nil
+			}
+
+			sel := bulkSelector{
+				tag:          req.GetString("tag", ""),
+				pool:         req.GetString("pool", ""),
+				namePattern:  req.GetString("name_pattern", ""),
+				allowedPools: opts.AllowedPools,
+			}
+			vmids := req.GetStringSlice("vmids", nil)
+			all, err := selectGuests(ctx, c, bulkSelector{allowedPools: opts.AllowedPools})
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			bySelector := sel.tag != "" || sel.pool != "" || sel.namePattern != ""
+			for _, r := range all {
+				if slices.Contains(vmids, strconv.Itoa(r.VMID)) || (bySelector && sel.matches(r)) {
+					scope.VMIDs = append(scope.VMIDs, r.VMID)
+				}
+			}
+			for _, id := range vmids {
+				n, err := strconv.Atoi(id)
+				if err != nil || !slices.Contains(scope.VMIDs, n) {
+					return mcp.NewToolResultError(fmt.Sprintf("guest %s not found", id)), nil
+				}
+			}
+			if len(scope.VMIDs) == 0 && !scope.Storages && !scope.Firewall && !scope.HA {
+				return mcp.NewToolResultError("the baseline would be empty; select guests or include storages, " +
+					"firewall or ha"), nil
+			}
+
+			state, _, err := collectDriftState(ctx, c, scope)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			b := driftBaseline{Name: name, Created: time.Now().UTC(), Scope: scope, State: state}
+			d.mu.Lock()
+			if old, err := d.load(name); err == nil {
+				b.Schedule = old.Schedule
+			}
+			err = writeStateFile(opts.StateDir, baselineStatePrefix+name, b)
+			d.mu.Unlock()
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			return mcp.NewToolResultText(fmt.Sprintf("Baseline %s saved: %d guests, %d storages, %d firewall "+
+				"rules, %d HA resources\n", name, len(state.Guests), len(state.Storages), len(state.Firewall),
+				len(state.HA))), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_drift_baselines",
+			mcp.WithDescription("List the drift baselines with their scope and scheduled check"),
+			mcp.WithReadOnlyHintAnnotation(true),
+		),
+		func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			names, err := listStateFiles(opts.StateDir, baselineStatePrefix)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			type summary struct {
+				Name     string         `json:"name"`
+				Created  time.Time      `json:"created"`
+				Scope    driftScope     `json:"scope"`
+				Schedule *driftSchedule `json:"schedule,omitempty"`
+			}
+			out := make([]summary, 0, len(names))
+			for _, name := range names {
+				b, err := d.load(strings.TrimPrefix(name, baselineStatePrefix))
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if b.Schedule != nil {
+					b.Schedule.WebhookURL = redactedURL(b.Schedule.WebhookURL)
+				}
+				out = append(out, summary{b.Name, b.Created, b.Scope, b.Schedule})
+			}
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(data)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_drift_baseline",
+			mcp.WithDescription("Delete a drift baseline and its scheduled check"),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("name",
+				mcp.Description("Baseline name"),
+				mcp.Required(),
+			),
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if _, err := d.load(name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			d.start(name, nil)
+			if err := removeStateFile(opts.StateDir, baselineStatePrefix+name); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Baseline %s deleted\n", name)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("detect_drift",
+			mcp.WithDescription(
+				"Compare the live cluster with a drift baseline field by field: changed, added and removed config "+
+					"values of guests, storages and HA resources, added, removed and moved firewall rules, and "+
+					"pending guest changes that still need a restart. Secrets are not compared",
+			),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithString("name",
+				mcp.Description("Baseline name"),
+				mcp.Required(),
+			),
+			mcp.WithString("notify",
+				mcp.Description("Also post the findings to the webhook of the scheduled check: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			b, err := d.load(name)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			report, err := detectDrift(ctx, c, b)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if req.GetString("notify", "0") == "1" && len(report.Findings) > 0 {
+				if b.Schedule == nil {
+					return mcp.NewToolResultError("the baseline has no scheduled check with a webhook"), nil
+				}
+				if err := postDriftWebhook(ctx, b.Schedule.WebhookURL, report); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+			}
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("schedule_drift_check",
+			mcp.WithDescription(
+				"Run detect_drift for a baseline periodically in the background and post the findings as JSON "+
+					"to a webhook whenever there are any. The schedule is saved with the baseline and restarted "+
+					"with the server. interval_minutes=0 removes the schedule",
+			),
+			mcp.WithString("name",
+				mcp.Description("Baseline name"),
+				mcp.Required(),
+			),
+			mcp.WithString("interval_minutes",
+				mcp.Description("Minutes between checks (minimum 5), or 0 to stop the checks"),
+				mcp.Required(),
+			),
+			mcp.WithString("webhook_url",
+				mcp.Description("http(s) URL the findings are posted to (required unless interval_minutes=0)"),
+			),
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			interval, err := strconv.Atoi(req.GetString("interval_minutes", ""))
+			if err != nil || (interval != 0 && interval < minDriftInterval) {
+				return mcp.NewToolResultError(fmt.Sprintf("interval_minutes must be 0 or at least %d",
+					minDriftInterval)), nil
+			}
+			var schedule *driftSchedule
+			if interval > 0 {
+				webhook := req.GetString("webhook_url", "")
+				u, err := url.Parse(webhook)
+				if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return mcp.NewToolResultError("webhook_url must be an http or https URL"), nil
+				}
+				schedule = &driftSchedule{IntervalMinutes: interval, WebhookURL: webhook}
+			}
+
+			d.mu.Lock()
+			b, err := d.load(name)
+			if err == nil {
+				b.Schedule = schedule
+				err = writeStateFile(opts.StateDir, baselineStatePrefix+name, b)
+			}
+			d.mu.Unlock()
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			d.start(name, schedule)
+
+			if schedule == nil {
+				return mcp.NewToolResultText(fmt.Sprintf("Scheduled drift check of %s removed\n", name)), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Drift check of %s scheduled every %d minutes\n", name,
+				interval)), nil
+		},
+	)
+}
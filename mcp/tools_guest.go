@@ -5,6 +5,7 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 
@@ -12,7 +13,23 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+// clusterResource is a guest entry of /cluster/resources?type=vm.
+type clusterResource struct {
+	ID       string  `json:"id"`
+	Type     string  `json:"type"`
+	Node     string  `json:"node"`
+	VMID     int     `json:"vmid"`
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Pool     string  `json:"pool"`
+	Tags     string  `json:"tags"`
+	Template int     `json:"template"`
+	CPU      float64 `json:"cpu"`
+	MaxCPU   float64 `json:"maxcpu"`
+	MaxMem   int64   `json:"maxmem"`
+}
+
+func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
 	s.AddTool(
 		mcp.NewTool("list_vms",
 			mcp.WithDescription("List all QEMU virtual machines on a node"),
@@ -58,13 +75,36 @@ func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
 	s.AddTool(
 		mcp.NewTool("list_cluster_resources",
 			mcp.WithDescription("List all VMs and containers across the entire cluster"),
+			mcp.WithString("pool",
+				mcp.Description("Only list guests that are members of this pool"),
+			),
 		),
-		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			result, err := c.Get(ctx, "/cluster/resources?type=vm")
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			pool := req.GetString("pool", "")
+			if pool == "" {
+				result, err := c.Get(ctx, "/cluster/resources?type=vm")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return mcp.NewToolResultText(result), nil
+			}
+
+			var resources []map[string]any
+			if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			filtered := make([]map[string]any, 0, len(resources))
+			for _, r := range resources {
+				if r["pool"] == pool {
+					filtered = append(filtered, r)
+				}
+			}
+
+			out, err := json.MarshalIndent(filtered, "", "  ")
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			return mcp.NewToolResultText(result), nil
+			return mcp.NewToolResultText(string(out)), nil
 		},
 	)
 
@@ -165,6 +205,10 @@ func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
 			}
 			guestType := req.GetString("type", "qemu")
 			action := req.GetString("action", "shutdown")
+			if action != "stop" && action != "shutdown" && action != "reboot" {
+				return mcp.NewToolResultError(fmt.Sprintf(
+					"unsupported action %q (supported: stop, shutdown, reboot)", action)), nil
+			}
 
 			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/%s/%s/status/%s", node, guestType, vmid, action), nil)
 			if err != nil {
@@ -251,7 +295,10 @@ func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
 				return mcp.NewToolResultError("at least one config field must be provided"), nil
 			}
 
-			result, err := c.Put(ctx, fmt.Sprintf("/nodes/%s/%s/%s/config", node, guestType, vmid), data)
+			meta := configChange{Tool: "update_guest_config", Node: node, Type: guestType, VMID: vmid}
+			result, err := opts.journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, fmt.Sprintf("/nodes/%s/%s/%s/config", node, guestType, vmid), data)
+			})
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -356,7 +403,10 @@ func RegisterGuestTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
 			data.Set("disk", disk)
 			data.Set("size", size)
 
-			result, err := c.Put(ctx, fmt.Sprintf("/nodes/%s/%s/%s/resize", node, guestType, vmid), data)
+			meta := configChange{Tool: "resize_guest_disk", Node: node, Type: guestType, VMID: vmid}
+			result, err := opts.journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, fmt.Sprintf("/nodes/%s/%s/%s/resize", node, guestType, vmid), data)
+			})
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
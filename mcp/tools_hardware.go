@@ -0,0 +1,495 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Number of hostpciN and usbN slots of a QEMU guest.
+const (
+	maxHostPCISlots = 16
+	maxUSBSlots     = 14
+)
+
+type pciDevice struct {
+	ID         string  `json:"id"`
+	Class      string  `json:"class"`
+	Vendor     string  `json:"vendor"`
+	Device     string  `json:"device"`
+	VendorName string  `json:"vendor_name"`
+	DeviceName string  `json:"device_name"`
+	IOMMUGroup int     `json:"iommugroup"`
+	MDev       pveBool `json:"mdev"`
+}
+
+type iommuGroup struct {
+	Group   int         `json:"iommugroup"`
+	Devices []pciDevice `json:"devices"`
+}
+
+// groupPCIDevices groups devices by IOMMU group. Devices of a group can only
+// be passed through together; -1 means IOMMU is not enabled.
+func groupPCIDevices(devices []pciDevice) []iommuGroup {
+	byGroup := map[int][]pciDevice{}
+	for _, d := range devices {
+		byGroup[d.IOMMUGroup] = append(byGroup[d.IOMMUGroup], d)
+	}
+	groups := make([]iommuGroup, 0, len(byGroup))
+	for g, devs := range byGroup {
+		sort.Slice(devs, func(i, j int) bool { return devs[i].ID < devs[j].ID })
+		groups = append(groups, iommuGroup{Group: g, Devices: devs})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+	return groups
+}
+
+// parsePropertyString parses a Proxmox property string ("a=1,b=2").
+func parsePropertyString(s string) map[string]string {
+	props := map[string]string{}
+	for _, part := range strings.Split(s, ",") {
+		k, v, found := strings.Cut(part, "=")
+		if found {
+			props[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return props
+}
+
+// freeGuestSlot returns the first unused key prefix+N in the guest config.
+func freeGuestSlot(conf map[string]any, prefix string, slots int) (string, error) {
+	for i := range slots {
+		key := prefix + strconv.Itoa(i)
+		if _, used := conf[key]; !used {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("all %s slots are in use", prefix)
+}
+
+// mappedPCIClass returns the PCI class of the device a mapping points to on
+// node, or "" when it cannot be determined.
+func mappedPCIClass(ctx context.Context, c *ProxmoxClient, node string, entries []string) (string, error) {
+	var path string
+	for _, e := range entries {
+		props := parsePropertyString(e)
+		if props["node"] == node {
+			path = props["path"]
+			break
+		}
+	}
+	if path == "" {
+		return "", fmt.Errorf("the mapping has no device on node %s", node)
+	}
+
+	var devices []pciDevice
+	if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/hardware/pci?pci-class-blacklist=", node), &devices); err != nil {
+		return "", err
+	}
+	for _, d := range devices {
+		// Mappings of multi-function devices omit the function (0000:01:00).
+		if d.ID == path || strings.HasPrefix(d.ID, path+".") {
+			return d.Class, nil
+		}
+	}
+	return "", nil
+}
+
+// checkPassthroughMachine verifies the guest machine type and firmware for a
+// PCI device: PCIe passthrough needs the q35 machine type, and GPUs (display
+// class 0x03) are only supported with q35 and OVMF (UEFI).
+func checkPassthroughMachine(conf map[string]any, pcie bool, class string, primaryGPU bool) error {
+	machine, _ := conf["machine"].(string)
+	bios, _ := conf["bios"].(string)
+	isQ35 := strings.Contains(machine, "q35")
+	isOVMF := bios == "ovmf"
+	isGPU := strings.HasPrefix(class, "0x03")
+
+	var problems []string
+	if (pcie || isGPU) && !isQ35 {
+		problems = append(problems, "machine type q35 (machine=q35)")
+	}
+	if (isGPU || primaryGPU) && !isOVMF {
+		problems = append(problems, "OVMF firmware (bios=ovmf, with an efidisk0)")
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("the device requires %s; change the guest config first", strings.Join(problems, " and "))
+}
+
+func mappingTypeFromRequest(req mcp.CallToolRequest) (string, error) {
+	t, err := req.RequireString("type")
+	if err != nil {
+		return "", err
+	}
+	if t != "pci" && t != "usb" {
+		return "", fmt.Errorf("unsupported mapping type %q (supported: pci, usb)", t)
+	}
+	return t, nil
+}
+
+func mappingParams(req mcp.CallToolRequest, mappingType string) (url.Values, error) {
+	data := url.Values{}
+	for _, m := range req.GetStringSlice("map", nil) {
+		data.Add("map", m)
+	}
+	if v := req.GetString("description", ""); v != "" {
+		data.Set("description", v)
+	}
+	if v := req.GetString("mdev", ""); v != "" {
+		if mappingType != "pci" {
+			return nil, errors.New("mdev is only valid for pci mappings")
+		}
+		data.Set("mdev", v)
+	}
+	if v := req.GetString("live_migration_capable", ""); v != "" {
+		if mappingType != "pci" {
+			return nil, errors.New("live_migration_capable is only valid for pci mappings")
+		}
+		data.Set("live-migration-capable", v)
+	}
+	return data, nil
+}
+
+func mappingOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithArray("map",
+			mcp.Description(
+				"Device per node, as property strings. pci: node=pve1,path=0000:01:00.0,id=10de:2204,iommugroup=12; "+
+					"usb: node=pve1,id=046d:c52b or node=pve1,path=1-2",
+			),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("description",
+			mcp.Description("Description of the mapping"),
+		),
+		mcp.WithString("mdev",
+			mcp.Description("pci: the device supports mediated devices (vGPU): 1 or 0"),
+		),
+		mcp.WithString("live_migration_capable",
+			mcp.Description("pci: the device supports live migration: 1 or 0"),
+		),
+	}
+}
+
+func RegisterHardwareTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_pci_devices",
+			mcp.WithDescription(
+				"List the PCI devices of a node grouped by IOMMU group (devices in one group can only be passed "+
+					"through together; group -1 means IOMMU is disabled)",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("all",
+				mcp.Description("Include bridges and memory controllers hidden by default: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			path := fmt.Sprintf("/nodes/%s/hardware/pci", node)
+			if req.GetString("all", "0") == "1" {
+				path += "?pci-class-blacklist="
+			}
+
+			var devices []pciDevice
+			if err := c.GetJSON(ctx, path, &devices); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out, err := json.MarshalIndent(groupPCIDevices(devices), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_usb_devices",
+			mcp.WithDescription("List the USB devices of a node with vendor/product IDs, bus and port"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/hardware/usb", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_hardware_mappings",
+			mcp.WithDescription("List the cluster-wide PCI or USB resource mappings"),
+			mcp.WithString("type",
+				mcp.Description("Mapping type: pci or usb"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			mappingType, err := mappingTypeFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/cluster/mapping/"+mappingType)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	createOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Create a cluster-wide PCI or USB resource mapping"),
+		mcp.WithString("type",
+			mcp.Description("Mapping type: pci or usb"),
+			mcp.Required(),
+		),
+		mcp.WithString("id",
+			mcp.Description("Mapping name (e.g. gpu0)"),
+			mcp.Required(),
+		),
+	}, mappingOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_hardware_mapping", createOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			mappingType, err := mappingTypeFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := mappingParams(req, mappingType)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if len(data["map"]) == 0 {
+				return mcp.NewToolResultError("map requires at least one device"), nil
+			}
+			data.Set("id", id)
+
+			result, err := c.Post(ctx, "/cluster/mapping/"+mappingType, data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updateOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Update a PCI or USB resource mapping; map replaces all device entries"),
+		mcp.WithString("type",
+			mcp.Description("Mapping type: pci or usb"),
+			mcp.Required(),
+		),
+		mcp.WithString("id",
+			mcp.Description("Mapping name"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to remove"),
+		),
+	}, mappingOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_hardware_mapping", updateOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			mappingType, err := mappingTypeFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := mappingParams(req, mappingType)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("no settings to update"), nil
+			}
+
+			result, err := c.Put(ctx, fmt.Sprintf("/cluster/mapping/%s/%s", mappingType, url.PathEscape(id)), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_hardware_mapping",
+			mcp.WithDescription("Delete a PCI or USB resource mapping"),
+			mcp.WithString("type",
+				mcp.Description("Mapping type: pci or usb"),
+				mcp.Required(),
+			),
+			mcp.WithString("id",
+				mcp.Description("Mapping name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			mappingType, err := mappingTypeFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, fmt.Sprintf("/cluster/mapping/%s/%s", mappingType, url.PathEscape(id)), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("attach_mapped_device",
+			mcp.WithDescription(
+				"Attach a mapped PCI or USB device to a VM as the next free hostpciN/usbN. For PCI devices the VM "+
+					"must use the q35 machine type when pcie=1, and q35 with OVMF for GPUs. Takes effect on the "+
+					"next VM start",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("type",
+				mcp.Description("Mapping type: pci or usb"),
+				mcp.Required(),
+			),
+			mcp.WithString("mapping",
+				mcp.Description("Mapping name"),
+				mcp.Required(),
+			),
+			mcp.WithString("pcie",
+				mcp.Description("pci: attach as PCI Express device: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("x_vga",
+				mcp.Description("pci: use the device as primary GPU: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("rombar",
+				mcp.Description("pci: expose the device ROM: 1 or 0"),
+			),
+			mcp.WithString("usb3",
+				mcp.Description("usb: attach to a USB 3 controller: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			mappingType, err := mappingTypeFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			mapping, err := req.RequireString("mapping")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var mapped struct {
+				Map []string `json:"map"`
+			}
+			mappingPath := fmt.Sprintf("/cluster/mapping/%s/%s", mappingType, url.PathEscape(mapping))
+			if err := c.GetJSON(ctx, mappingPath, &mapped); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var conf map[string]any
+			configPath := fmt.Sprintf("/nodes/%s/qemu/%s/config", node, vmid)
+			if err := c.GetJSON(ctx, configPath, &conf); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var key, value string
+			if mappingType == "pci" {
+				class, err := mappedPCIClass(ctx, c, node, mapped.Map)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				pcie := req.GetString("pcie", "1") == "1"
+				primaryGPU := req.GetString("x_vga", "0") == "1"
+				if err := checkPassthroughMachine(conf, pcie, class, primaryGPU); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+
+				if key, err = freeGuestSlot(conf, "hostpci", maxHostPCISlots); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				value = "mapping=" + mapping
+				if pcie {
+					value += ",pcie=1"
+				}
+				if primaryGPU {
+					value += ",x-vga=1"
+				}
+				if v := req.GetString("rombar", ""); v != "" {
+					value += ",rombar=" + v
+				}
+			} else {
+				if key, err = freeGuestSlot(conf, "usb", maxUSBSlots); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				value = "mapping=" + mapping
+				if v := req.GetString("usb3", ""); v != "" {
+					value += ",usb3=" + v
+				}
+			}
+
+			data := url.Values{key: {value}}
+			if digest, ok := conf["digest"].(string); ok {
+				// Refuse the update if the config changed since it was checked.
+				data.Set("digest", digest)
+			}
+			meta := configChange{Tool: "attach_mapped_device", Node: node, Type: "qemu", VMID: vmid}
+			if _, err := opts.journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, configPath, data)
+			}); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Attached %s as %s: %s", mapping, key, value)), nil
+		},
+	)
+}
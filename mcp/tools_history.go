@@ -0,0 +1,221 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const defaultHistoryLimit = 20
+
+// revertPlan holds the config update that undoes a journal entry. Skipped
+// lists the disks whose size change is kept.
+type revertPlan struct {
+	Data      url.Values
+	Fields    []string
+	Skipped   []string
+	Conflicts []string
+}
+
+// locateGuest finds the node and type of a guest, which may have moved since
+// a journal entry was recorded.
+func locateGuest(ctx context.Context, c *ProxmoxClient, vmid int) (clusterResource, error) {
+	var resources []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+		return clusterResource{}, err
+	}
+	for _, r := range resources {
+		if r.VMID == vmid {
+			return r, nil
+		}
+	}
+	return clusterResource{}, fmt.Errorf("guest %d not found", vmid)
+}
+
+// planRevert computes the update restoring the values before e from the live
+// config. Fields changed again since e are conflicts. Disk sizes are kept
+// because disks cannot be shrunk, so a change of the size alone is skipped.
+func planRevert(e configChange, live map[string]any) revertPlan {
+	flat := flattenConfig(live)
+	p := revertPlan{Data: url.Values{}}
+	var deletes []string
+	for _, ch := range e.Changes {
+		current := flat[ch.Field]
+		if current != ch.After {
+			p.Conflicts = append(p.Conflicts, fmt.Sprintf("%s: expected %q, found %q", ch.Field, ch.After, current))
+		}
+		value := ch.Before
+		if size := parsePropertyString(current)["size"]; size != "" && value != "" {
+			value = setProperty(value, "size", size)
+		}
+		switch {
+		case value == current && value != ch.Before:
+			p.Skipped = append(p.Skipped, ch.Field)
+		case value == current:
+		case value == "":
+			deletes = append(deletes, ch.Field)
+			p.Fields = append(p.Fields, ch.Field)
+		default:
+			p.Data.Set(ch.Field, value)
+			p.Fields = append(p.Fields, ch.Field)
+		}
+	}
+	if len(deletes) > 0 {
+		p.Data.Set("delete", strings.Join(deletes, ","))
+	}
+	return p
+}
+
+// RegisterHistoryTools registers the tools reading and undoing the recorded
+// config changes. The journal covers update_guest_config, resize_guest_disk,
+// set_cloudinit_config, attach_mapped_device, the tag action of
+// bulk_guest_action, the update and resize steps of apply_guest_plan and
+// reverts; guest creation and removal, rollbacks and restores are not
+// recorded.
+func RegisterHistoryTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("get_config_history",
+			mcp.WithDescription("List the recorded config changes of a VM or container, newest first"),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithString("vmid",
+				mcp.Description("VM/container ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("limit",
+				mcp.Description(fmt.Sprintf("Maximum number of changes (default: %d)", defaultHistoryLimit)),
+			),
+			mcp.WithString("full",
+				mcp.Description("Include the complete config before and after each change: 1 or 0 (default: 0)"),
+			),
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if _, err := strconv.Atoi(vmid); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid vmid %q", vmid)), nil
+			}
+			limit, err := strconv.Atoi(req.GetString("limit", strconv.Itoa(defaultHistoryLimit)))
+			if err != nil || limit < 1 {
+				return mcp.NewToolResultError("limit must be a positive number"), nil
+			}
+			entries, err := opts.journal.entries(vmid)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			slices.Reverse(entries)
+			entries = entries[:min(limit, len(entries))]
+			if req.GetString("full", "0") != "1" {
+				for i := range entries {
+					entries[i].Before, entries[i].After = nil, nil
+				}
+			}
+			out, err := json.MarshalIndent(entries, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("revert_config_change",
+			mcp.WithDescription("Restore the values a recorded config change replaced. Refused unless force "+
+				"is set when the config changed since (its digest differs from the recorded one)"),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("vmid",
+				mcp.Description("VM/container ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("change_id",
+				mcp.Description("ID of the change from get_config_history"),
+				mcp.Required(),
+			),
+			mcp.WithString("force",
+				mcp.Description("Revert although the config changed after the recorded change: 1 or 0 "+
+					"(default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			id, err := strconv.Atoi(vmid)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid vmid %q", vmid)), nil
+			}
+			changeID, err := req.RequireString("change_id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			entries, err := opts.journal.entries(vmid)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			i := slices.IndexFunc(entries, func(e configChange) bool { return e.ID == changeID })
+			if i < 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("change %s not found for guest %s", changeID, vmid)), nil
+			}
+			entry := entries[i]
+			if entry.Reverted != "" {
+				return mcp.NewToolResultError(fmt.Sprintf("change %s was already reverted by %s",
+					changeID, entry.Reverted)), nil
+			}
+
+			r, err := locateGuest(ctx, c, id)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			live, err := guestConfig(ctx, c, r.Node, r.Type, vmid)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			p := planRevert(entry, live)
+			digest := configString(live, "digest")
+			if req.GetString("force", "0") != "1" {
+				if len(p.Conflicts) > 0 {
+					return mcp.NewToolResultError("fields changed since " + changeID + " (set force=1 to " +
+						"overwrite): " + strings.Join(p.Conflicts, "; ")), nil
+				}
+				if digest != entry.Digest {
+					return mcp.NewToolResultError(fmt.Sprintf("the config of guest %s changed since %s "+
+						"(digest %s, recorded %s); set force=1 to revert anyway", vmid, changeID, digest,
+						entry.Digest)), nil
+				}
+			}
+			if len(p.Fields) == 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("nothing to revert: the values before %s are "+
+					"already set, or it only grew disks, which cannot be shrunk", changeID)), nil
+			}
+			p.Data.Set("digest", digest)
+
+			meta := configChange{Tool: "revert_config_change", Node: r.Node, Type: r.Type, VMID: vmid,
+				RevertOf: changeID}
+			if _, err := opts.journal.record(ctx, c, meta, func() (string, error) {
+				return c.Put(ctx, fmt.Sprintf("/nodes/%s/%s/%s/config", r.Node, r.Type, vmid), p.Data)
+			}); err != nil {
+				return mcp.NewToolResultError("revert failed (the config may have changed meanwhile): " +
+					err.Error()), nil
+			}
+
+			msg := fmt.Sprintf("Reverted change %s of guest %s: %s\n", changeID, vmid, strings.Join(p.Fields, ", "))
+			if len(p.Skipped) > 0 {
+				msg += fmt.Sprintf("Kept disk size: %s (disks cannot be shrunk)\n", strings.Join(p.Skipped, ", "))
+			}
+			return mcp.NewToolResultText(msg), nil
+		},
+	)
+}
@@ -0,0 +1,283 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var ansiEscapeRe = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b\][^\x07]*\x07`)
+
+type termProxyTicket struct {
+	Port   json.Number `json:"port"`
+	Ticket string      `json:"ticket"`
+	User   string      `json:"user"`
+	UPID   string      `json:"upid"`
+}
+
+// terminalExecResult is the outcome of a command run through a termproxy terminal.
+type terminalExecResult struct {
+	ExitCode int    `json:"exitcode"`
+	Output   string `json:"output"`
+	TimedOut bool   `json:"timed_out,omitempty"`
+}
+
+// terminalInput frames data for the Proxmox xterm.js protocol ("0:LEN:DATA").
+func terminalInput(data string) []byte {
+	return []byte("0:" + strconv.Itoa(len(data)) + ":" + data)
+}
+
+// Markers delimiting the output of a command in the terminal stream. Each is
+// followed by a per-run nonce.
+const (
+	execBeginMarker = "__MCP_BEGIN_"
+	execEndMarker   = "__MCP_END_"
+)
+
+func execNonce() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating marker: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// buildExecLine wraps command so its output is delimited by markers and
+// followed by its exit status. The markers are printed from two printf
+// arguments so the terminal echo of the typed input never contains them
+// verbatim. command runs through eval, so a trailing comment in it cannot
+// swallow the end marker, and with stdin from /dev/null, so a command reading
+// its input cannot consume the rest of the line.
+func buildExecLine(command, nonce string) string {
+	quoted := "'" + strings.ReplaceAll(command, "'", `'\''`) + "'"
+	return fmt.Sprintf(
+		"stty -echo 2>/dev/null; printf '%%s%%s\\n' %s %s; eval %s </dev/null; "+
+			"printf '\\n%%s%%s:%%d\\n' %s %s $?\n",
+		execBeginMarker, nonce, quoted, execEndMarker, nonce,
+	)
+}
+
+// execOutput extracts the command output and exit code from the terminal
+// stream as it arrives. Only complete lines are cleaned and searched for the
+// markers, each of them once.
+type execOutput struct {
+	nonce   string
+	partial []byte
+	begun   bool
+	output  strings.Builder
+	code    int
+	done    bool
+}
+
+func cleanTerminalText(b []byte) string {
+	return ansiEscapeRe.ReplaceAllString(strings.ReplaceAll(string(b), "\r\n", "\n"), "")
+}
+
+// write adds data read from the terminal and reports whether the end marker
+// was seen.
+func (o *execOutput) write(data []byte) bool {
+	o.partial = append(o.partial, data...)
+	i := bytes.LastIndexByte(o.partial, '\n')
+	if o.done || i < 0 {
+		return o.done
+	}
+	text := strings.TrimSuffix(cleanTerminalText(o.partial[:i+1]), "\n")
+	o.partial = append(o.partial[:0], o.partial[i+1:]...)
+
+	for line := range strings.SplitSeq(text, "\n") {
+		switch {
+		case !o.begun:
+			o.begun = strings.HasSuffix(line, execBeginMarker+o.nonce)
+		case strings.HasPrefix(line, execEndMarker+o.nonce+":"):
+			o.code, _ = strconv.Atoi(strings.TrimPrefix(line, execEndMarker+o.nonce+":"))
+			o.done = true
+			return true
+		default:
+			o.output.WriteString(line + "\n")
+		}
+	}
+	return false
+}
+
+// result returns the command output so far. The end marker is preceded by a
+// newline of its own, which is not part of the output.
+func (o *execOutput) result() terminalExecResult {
+	res := terminalExecResult{ExitCode: o.code}
+	if !o.begun {
+		return res
+	}
+	res.Output = o.output.String()
+	if o.done {
+		res.Output = strings.TrimSuffix(res.Output, "\n")
+	} else {
+		res.Output += cleanTerminalText(o.partial)
+	}
+	return res
+}
+
+// runTerminalCommand opens the terminal of target via termproxy, runs command
+// in it and returns its output once it finished or timeout elapsed. target is
+// the API path of a container ("/nodes/pve1/lxc/200") or of a node, in which
+// case the node shell is used.
+func runTerminalCommand(ctx context.Context, c *ProxmoxClient, target, command string,
+	timeout time.Duration,
+) (terminalExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var ticket termProxyTicket
+	result, err := c.Post(ctx, target+"/termproxy", nil)
+	if err != nil {
+		return terminalExecResult{}, err
+	}
+	if err := json.Unmarshal([]byte(result), &ticket); err != nil {
+		return terminalExecResult{}, fmt.Errorf("parsing termproxy response: %w", err)
+	}
+
+	ws, err := c.dialWebSocket(ctx, fmt.Sprintf(
+		"%s/vncwebsocket?port=%s&vncticket=%s",
+		target, ticket.Port.String(), url.QueryEscape(ticket.Ticket),
+	))
+	if err != nil {
+		return terminalExecResult{}, err
+	}
+	defer ws.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = ws.SetDeadline(deadline)
+
+	if err := ws.WriteMessage(wsOpText, []byte(ticket.User+":"+ticket.Ticket+"\n")); err != nil {
+		return terminalExecResult{}, err
+	}
+	_, reply, err := ws.ReadMessage()
+	if err != nil {
+		return terminalExecResult{}, fmt.Errorf("terminal authentication: %w", err)
+	}
+	if !bytes.HasPrefix(reply, []byte("OK")) {
+		return terminalExecResult{}, fmt.Errorf("terminal authentication failed: %s", bytes.TrimSpace(reply))
+	}
+
+	nonce, err := execNonce()
+	if err != nil {
+		return terminalExecResult{}, err
+	}
+	// A wide terminal keeps long output lines from being wrapped.
+	if err := ws.WriteMessage(wsOpText, []byte("1:500:50:")); err != nil {
+		return terminalExecResult{}, err
+	}
+	if err := ws.WriteMessage(wsOpText, terminalInput(buildExecLine(command, nonce))); err != nil {
+		return terminalExecResult{}, err
+	}
+
+	out := &execOutput{nonce: nonce}
+	for {
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			res := out.result()
+			if ctx.Err() != nil {
+				res.TimedOut = true
+				return res, nil
+			}
+			return res, fmt.Errorf("reading terminal output: %w", err)
+		}
+		if out.write(msg) {
+			_ = ws.WriteMessage(wsOpText, terminalInput("exit\n"))
+			return out.result(), nil
+		}
+	}
+}
+
+func RegisterLXCTools(s *server.MCPServer, c *ProxmoxClient, opts Options) {
+	// Running commands inside containers is shell-level access, so the tool
+	// only exists when explicitly enabled.
+	if !opts.AllowLXCExec {
+		return
+	}
+
+	s.AddTool(
+		mcp.NewTool("lxc_exec",
+			mcp.WithDescription(
+				"Run a shell command inside an LXC container through its terminal (termproxy) and return the "+
+					"output and exit code. The container console mode must be 'shell' (cmode=shell)",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("Container ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("command",
+				mcp.Description("Single-line shell command (e.g. systemctl status nginx --no-pager)"),
+				mcp.Required(),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the command to finish (default: 30)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			command, err := req.RequireString("command")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if strings.ContainsAny(command, "\r\n") {
+				return mcp.NewToolResultError("command must be a single line"), nil
+			}
+			timeout, err := strconv.Atoi(req.GetString("timeout", "30"))
+			if err != nil || timeout <= 0 {
+				return mcp.NewToolResultError("timeout must be a positive number of seconds"), nil
+			}
+
+			var conf struct {
+				CMode string `json:"cmode"`
+			}
+			if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/lxc/%s/config", node, vmid), &conf); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if conf.CMode != "shell" {
+				return mcp.NewToolResultError(errors.New(
+					"container console mode is not 'shell'; set cmode=shell in the container config to use lxc_exec",
+				).Error()), nil
+			}
+
+			target := fmt.Sprintf("/nodes/%s/lxc/%s", node, vmid)
+			res, err := runTerminalCommand(ctx, c, target, command, time.Duration(timeout)*time.Second)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if res.TimedOut {
+				return mcp.NewToolResultError(fmt.Sprintf("command did not finish within %ds\n%s", timeout, out)), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp_test
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // required by the WebSocket handshake (RFC 6455)
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	mcplib "github.com/anthoniech/proxmox-mcp-go/mcp"
+)
+
+// fakeTerminal is a server-side WebSocket speaking the Proxmox termproxy
+// protocol, backed by a real /bin/sh so that commands actually run.
+type fakeTerminal struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+func (f *fakeTerminal) readMessage() ([]byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(f.br, head[:]); err != nil {
+		return nil, err
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(f.br, ext[:]); err != nil {
+			return nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(f.br, ext[:]); err != nil {
+			return nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(f.br, mask[:]); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(f.br, payload); err != nil {
+		return nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	if head[0]&0x0F == 0x8 {
+		return nil, io.EOF
+	}
+	return payload, nil
+}
+
+func (f *fakeTerminal) writeMessage(data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	header := []byte{0x82}
+	switch n := len(data); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_, _ = f.conn.Write(append(header, data...))
+}
+
+// serve authenticates the client, then forwards "0:LEN:DATA" input to a
+// shell, echoing it like a tty would, and streams the shell output back.
+func (f *fakeTerminal) serve(t *testing.T, wantAuth string) {
+	auth, err := f.readMessage()
+	if err != nil || string(auth) != wantAuth {
+		f.writeMessage([]byte("permission denied"))
+		return
+	}
+	f.writeMessage([]byte("OK"))
+
+	sh := exec.Command("/bin/sh")
+	stdin, _ := sh.StdinPipe()
+	stdout, _ := sh.StdoutPipe()
+	sh.Stderr = sh.Stdout
+	if err := sh.Start(); err != nil {
+		t.Errorf("starting shell: %v", err)
+		return
+	}
+	defer func() { _ = sh.Process.Kill(); _ = sh.Wait() }()
+
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := stdout.Read(buf)
+			if n > 0 {
+				f.writeMessage([]byte(strings.ReplaceAll(string(buf[:n]), "\n", "\r\n")))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		msg, err := f.readMessage()
+		if err != nil {
+			return
+		}
+		kind, rest, _ := strings.Cut(string(msg), ":")
+		if kind != "0" {
+			continue
+		}
+		size, data, _ := strings.Cut(rest, ":")
+		if n, err := strconv.Atoi(size); err != nil || n != len(data) {
+			t.Errorf("bad input frame %q", msg)
+			return
+		}
+		f.writeMessage([]byte(strings.ReplaceAll(data, "\n", "\r\n")))
+		_, _ = io.WriteString(stdin, data)
+	}
+}
+
+func startFakeTerminalPVE(t *testing.T, cmode string) string {
+	t.Helper()
+
+	const ticket = "PVEVNC:6543FAKE::ticket"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api2/json/nodes/pve1/lxc/200/config", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"hostname":"ct200","cmode":"` + cmode + `"}}`))
+	})
+	mux.HandleFunc("POST /api2/json/nodes/pve1/lxc/200/termproxy", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"port":5901,"ticket":"` + ticket + `","user":"root@pam","upid":"UPID:x"}}`))
+	})
+	mux.HandleFunc("POST /api2/json/nodes/pve1/termproxy", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"port":5902,"ticket":"` + ticket + `","user":"root@pam","upid":"UPID:x"}}`))
+	})
+	websocket := func(port string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("port") != port || r.URL.Query().Get("vncticket") != ticket {
+				http.Error(w, "bad ticket", http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Authorization") != "PVEAPIToken="+fakeToken {
+				http.Error(w, "bad token", http.StatusUnauthorized)
+				return
+			}
+
+			h := sha1.New() //nolint:gosec // required by the WebSocket handshake (RFC 6455)
+			h.Write([]byte(r.Header.Get("Sec-WebSocket-Key") + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+			accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+			conn, brw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				t.Errorf("hijack: %v", err)
+				return
+			}
+			defer conn.Close()
+
+			_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n" +
+				"Connection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+			_ = brw.Flush()
+
+			term := &fakeTerminal{conn: conn, br: brw.Reader}
+			term.serve(t, "root@pam:"+ticket+"\n")
+		}
+	}
+	mux.HandleFunc("GET /api2/json/nodes/pve1/lxc/200/vncwebsocket", websocket("5901"))
+	mux.HandleFunc("GET /api2/json/nodes/pve1/vncwebsocket", websocket("5902"))
+
+	pve := httptest.NewServer(mux)
+	t.Cleanup(pve.Close)
+	return pve.URL
+}
+
+func TestLXCExecDisabledByDefault(t *testing.T) {
+	s := newTestServer(t)
+
+	if s.MCPServer().GetTool("lxc_exec") != nil {
+		t.Fatal("lxc_exec must not be registered unless enabled")
+	}
+}
+
+func TestLXCExecThroughTerminal(t *testing.T) {
+	s, err := mcplib.New(startFakeTerminalPVE(t, "shell"), fakeToken, nil, mcplib.Options{AllowLXCExec: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "lxc_exec", map[string]any{
+		"node":    "pve1",
+		"vmid":    "200",
+		"command": "echo hello; echo world; exit_code() { return 3; }; exit_code # trailing comment",
+		"timeout": "10",
+	})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+
+	var got struct {
+		ExitCode int    `json:"exitcode"`
+		Output   string `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.Output != "hello\nworld\n" {
+		t.Errorf("expected output %q, got %q", "hello\nworld\n", got.Output)
+	}
+	if got.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", got.ExitCode)
+	}
+}
+
+func TestLXCExecCommandCannotReadTerminalInput(t *testing.T) {
+	s, err := mcplib.New(startFakeTerminalPVE(t, "shell"), fakeToken, nil, mcplib.Options{AllowLXCExec: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "lxc_exec", map[string]any{
+		"node":    "pve1",
+		"vmid":    "200",
+		"command": "cat; read answer; echo \"it's done\"",
+		"timeout": "10",
+	})
+	var got struct {
+		Output   string `json:"output"`
+		TimedOut bool   `json:"timed_out"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.TimedOut || got.Output != "it's done\n" {
+		t.Errorf("expected the command to get no input, got %+v", got)
+	}
+}
+
+func TestLXCExecRequiresShellConsole(t *testing.T) {
+	s, err := mcplib.New(startFakeTerminalPVE(t, "tty"), fakeToken, nil, mcplib.Options{AllowLXCExec: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "lxc_exec", map[string]any{"node": "pve1", "vmid": "200", "command": "true"})
+	if !res.IsError || !strings.Contains(resultText(res), "cmode=shell") {
+		t.Errorf("expected cmode error, got %q", resultText(res))
+	}
+}
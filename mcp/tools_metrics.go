@@ -0,0 +1,240 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// metricStats summarizes one RRD series.
+type metricStats struct {
+	Min  float64 `json:"min"`
+	Avg  float64 `json:"avg"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	Max  float64 `json:"max"`
+	Last float64 `json:"last"`
+}
+
+// metricsSummary is the server-side digest of an rrddata response.
+type metricsSummary struct {
+	Timeframe string                 `json:"timeframe"`
+	CF        string                 `json:"cf"`
+	Samples   int                    `json:"samples"`
+	Start     int64                  `json:"start,omitempty"`
+	End       int64                  `json:"end,omitempty"`
+	Metrics   map[string]metricStats `json:"metrics"`
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// summarizeRRD computes statistics for every numeric series in rows. Missing
+// datapoints (null in the RRD output) are skipped.
+func summarizeRRD(rows []map[string]any, timeframe, cf string) metricsSummary {
+	summary := metricsSummary{
+		Timeframe: timeframe,
+		CF:        cf,
+		Samples:   len(rows),
+		Metrics:   map[string]metricStats{},
+	}
+
+	series := map[string][]float64{}
+	last := map[string]float64{}
+	for _, row := range rows {
+		for k, v := range row {
+			f, ok := v.(float64)
+			if !ok {
+				continue
+			}
+			if k == "time" {
+				t := int64(f)
+				if summary.Start == 0 || t < summary.Start {
+					summary.Start = t
+				}
+				if t > summary.End {
+					summary.End = t
+				}
+				continue
+			}
+			series[k] = append(series[k], f)
+			last[k] = f
+		}
+	}
+
+	for k, values := range series {
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		summary.Metrics[k] = metricStats{
+			Min:  round(sorted[0]),
+			Avg:  round(sum / float64(len(values))),
+			P50:  round(percentile(sorted, 50)),
+			P95:  round(percentile(sorted, 95)),
+			Max:  round(sorted[len(sorted)-1]),
+			Last: round(last[k]),
+		}
+	}
+	return summary
+}
+
+func rrdQuery(req mcp.CallToolRequest) (string, string, error) {
+	timeframe := req.GetString("timeframe", "hour")
+	switch timeframe {
+	case "hour", "day", "week", "month", "year":
+	default:
+		return "", "", fmt.Errorf("unsupported timeframe %q", timeframe)
+	}
+	cf := req.GetString("cf", "AVERAGE")
+	if cf != "AVERAGE" && cf != "MAX" {
+		return "", "", fmt.Errorf("unsupported cf %q", cf)
+	}
+	return timeframe, cf, nil
+}
+
+func rrdToolResult(ctx context.Context, c *ProxmoxClient, path, timeframe, cf string) *mcp.CallToolResult {
+	var rows []map[string]any
+	if err := c.GetJSON(ctx, fmt.Sprintf("%s?timeframe=%s&cf=%s", path, timeframe, cf), &rows); err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	out, err := json.MarshalIndent(summarizeRRD(rows, timeframe, cf), "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return mcp.NewToolResultText(string(out))
+}
+
+func rrdToolOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("timeframe",
+			mcp.Description("Time frame: hour, day, week, month, or year (default: hour)"),
+		),
+		mcp.WithString("cf",
+			mcp.Description("RRD consolidation function: AVERAGE or MAX (default: AVERAGE)"),
+		),
+	}
+}
+
+func RegisterMetricsTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
+	nodeOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Summarize node performance over a time frame: min/avg/p50/p95/max/last of CPU, memory, " +
+				"load, I/O wait and network (CPU as a fraction of 1, sizes in bytes)",
+		),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+	}, rrdToolOptions()...)
+	s.AddTool(
+		mcp.NewTool("get_node_metrics", nodeOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeframe, cf, err := rrdQuery(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return rrdToolResult(ctx, c, fmt.Sprintf("/nodes/%s/rrddata", node), timeframe, cf), nil
+		},
+	)
+
+	guestOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Summarize VM or container performance over a time frame: min/avg/p50/p95/max/last of CPU, " +
+				"memory, netin/netout and diskread/diskwrite (CPU as a fraction of 1, rates in bytes/s)",
+		),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("vmid",
+			mcp.Description("VM/container ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("type",
+			mcp.Description("Guest type: qemu or lxc (default: qemu)"),
+		),
+	}, rrdToolOptions()...)
+	s.AddTool(
+		mcp.NewTool("get_guest_metrics", guestOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			vmid, err := req.RequireString("vmid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			guestType := req.GetString("type", "qemu")
+			timeframe, cf, err := rrdQuery(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			path := fmt.Sprintf("/nodes/%s/%s/%s/rrddata", node, guestType, vmid)
+			return rrdToolResult(ctx, c, path, timeframe, cf), nil
+		},
+	)
+
+	storageOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Summarize storage usage over a time frame: min/avg/p50/p95/max/last of used and total bytes",
+		),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("storage",
+			mcp.Description("Storage name"),
+			mcp.Required(),
+		),
+	}, rrdToolOptions()...)
+	s.AddTool(
+		mcp.NewTool("get_storage_metrics", storageOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeframe, cf, err := rrdQuery(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			path := fmt.Sprintf("/nodes/%s/storage/%s/rrddata", node, storage)
+			return rrdToolResult(ctx, c, path, timeframe, cf), nil
+		},
+	)
+}
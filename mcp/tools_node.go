@@ -0,0 +1,354 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// upgradeUnit is the transient systemd unit the node upgrade runs in. The
+// upgrade is detached from the node shell, so a timeout or a dropped terminal
+// (pveproxy restarts during the upgrade) never interrupts the package
+// manager.
+const upgradeUnit = "mcp-dist-upgrade.service"
+
+// nodeUpgradeCommand starts a non-interactive dist-upgrade that keeps locally
+// modified configuration files, unless one is still running. The unit remains
+// after apt-get exits so its result can be read.
+const nodeUpgradeCommand = `if [ "$(systemctl show -p SubState --value ` + upgradeUnit + `)" != running ]; then ` +
+	`systemctl stop ` + upgradeUnit + ` 2>/dev/null; systemctl reset-failed ` + upgradeUnit + ` 2>/dev/null; ` +
+	`systemd-run --quiet --unit=` + upgradeUnit + ` --property=RemainAfterExit=yes ` +
+	`--setenv=DEBIAN_FRONTEND=noninteractive apt-get -y ` +
+	`-o Dpkg::Options::=--force-confdef -o Dpkg::Options::=--force-confold dist-upgrade; fi`
+
+// maxUpgradeOutput bounds the upgrade output returned to the client; the
+// tail is kept since it holds the summary and any errors.
+const maxUpgradeOutput = 16 << 10
+
+const (
+	upgradePollInterval = 10 * time.Second
+	upgradePollTimeout  = time.Minute
+)
+
+// upgradeUnitState reads the state of upgradeUnit, e.g. SubState "running"
+// or "exited" with ExecMainStatus "0".
+func upgradeUnitState(ctx context.Context, c *ProxmoxClient, node string) (map[string]string, error) {
+	res, err := runTerminalCommand(ctx, c, "/nodes/"+node,
+		"systemctl show -p SubState -p ExecMainStatus "+upgradeUnit, upgradePollTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if res.TimedOut {
+		return nil, errors.New("reading the upgrade state timed out")
+	}
+	state := map[string]string{}
+	for line := range strings.Lines(res.Output) {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			state[k] = v
+		}
+	}
+	return state, nil
+}
+
+// upgradeNode starts nodeUpgradeCommand on the node, or attaches to an
+// upgrade still running there, and polls it until it exits or timeout
+// elapsed. A timed out upgrade keeps running on the node. Failed polls, e.g.
+// while pveproxy restarts, are retried.
+func upgradeNode(ctx context.Context, c *ProxmoxClient, node string, timeout time.Duration, //nolint:gocognit
+) (terminalExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	res, err := runTerminalCommand(ctx, c, "/nodes/"+node, nodeUpgradeCommand, upgradePollTimeout)
+	if err != nil {
+		return res, err
+	}
+	if res.TimedOut || res.ExitCode != 0 {
+		return res, fmt.Errorf("starting the upgrade on %s failed (exit code %d, timed out: %t): %s",
+			node, res.ExitCode, res.TimedOut, strings.TrimSpace(res.Output))
+	}
+
+	var lastErr error
+	for {
+		state, err := upgradeUnitState(ctx, c, node)
+		switch {
+		case err != nil:
+			lastErr = err
+		case state["SubState"] == "running" || state["SubState"] == "start":
+		case state["SubState"] == "exited" || state["SubState"] == "failed":
+			res.ExitCode, _ = strconv.Atoi(state["ExecMainStatus"])
+			if state["SubState"] == "failed" && res.ExitCode == 0 {
+				res.ExitCode = 1
+			}
+			out, err := runTerminalCommand(ctx, c, "/nodes/"+node, fmt.Sprintf(
+				"journalctl -o cat --no-pager _SYSTEMD_INVOCATION_ID=$(systemctl show -p InvocationID --value %s)"+
+					" | tail -c %d", upgradeUnit, maxUpgradeOutput), upgradePollTimeout)
+			res.Output = out.Output
+			if err != nil {
+				res.Output = "reading the upgrade log: " + err.Error()
+			}
+			return res, nil
+		default:
+			return res, fmt.Errorf("upgrade unit %s on %s is %q", upgradeUnit, node, state["SubState"])
+		}
+
+		select {
+		case <-ctx.Done():
+			res.TimedOut = true
+			res.Output = "the upgrade is still running on the node; it continues in " + upgradeUnit
+			if lastErr != nil {
+				res.Output += " (last check failed: " + lastErr.Error() + ")"
+			}
+			return res, nil
+		case <-time.After(upgradePollInterval):
+		}
+	}
+}
+
+func RegisterNodeTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_node_services",
+			mcp.WithDescription("List the system services of a node (pveproxy, corosync, ...) with their state"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/services", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("node_service_action",
+			mcp.WithDescription("Start, stop, restart or reload a system service on a node"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("service",
+				mcp.Description("Service name as returned by list_node_services (e.g. pveproxy)"),
+				mcp.Required(),
+			),
+			mcp.WithString("action",
+				mcp.Description("Action: start, stop, restart, or reload"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			service, err := req.RequireString("service")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			action, err := req.RequireString("action")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			switch action {
+			case "start", "stop", "restart", "reload":
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported service action %q", action)), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/services/%s/%s", node, url.PathEscape(service), action)
+			result, err := c.Post(ctx, path, nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("apt_update",
+			mcp.WithDescription("Refresh the APT package index of a node (apt-get update). Returns the task UPID"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/apt/update", node), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_apt_updates",
+			mcp.WithDescription("List the package updates pending on a node (run apt_update first to refresh it)"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/apt/update", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_apt_changelog",
+			mcp.WithDescription("Get the changelog of a package update pending on a node"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Package name"),
+				mcp.Required(),
+			),
+			mcp.WithString("version",
+				mcp.Description("Package version (default: the candidate version)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			q := url.Values{"name": {name}}
+			if v := req.GetString("version", ""); v != "" {
+				q.Set("version", v)
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/apt/changelog?%s", node, q.Encode()))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_package_versions",
+			mcp.WithDescription("List the installed versions of the Proxmox VE related packages on a node"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/apt/versions", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_subscription",
+			mcp.WithDescription("Get the subscription status, level and next due date of a node"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, fmt.Sprintf("/nodes/%s/subscription", node))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	// Installing packages changes the node itself, so the upgrade is only
+	// available together with the other elevated tools.
+	if !opts.AllowElevated {
+		return
+	}
+
+	s.AddTool(
+		mcp.NewTool("upgrade_node",
+			mcp.WithDescription(
+				"[elevated] Install all pending package updates on a node (apt-get dist-upgrade, keeping modified "+
+					"config files) in a systemd unit started through the node shell, and wait for it. An upgrade "+
+					"still running after the timeout continues on the node. Requires a root@pam API token. "+
+					"Does not reboot the node",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the upgrade to finish; the upgrade itself is not "+
+					"interrupted (default: 1800)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := strconv.Atoi(req.GetString("timeout", "1800"))
+			if err != nil || timeout <= 0 {
+				return mcp.NewToolResultError("timeout must be a positive number of seconds"), nil
+			}
+
+			res, err := upgradeNode(ctx, c, node, time.Duration(timeout)*time.Second)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(res, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if res.TimedOut || res.ExitCode != 0 {
+				return mcp.NewToolResultError(fmt.Sprintf("upgrade of node %s did not complete\n%s", node, out)), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+}
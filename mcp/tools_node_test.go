@@ -0,0 +1,79 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mcplib "github.com/anthoniech/proxmox-mcp-go/mcp"
+)
+
+// fakeSystemd puts systemctl, systemd-run and journalctl stand-ins on the
+// PATH of the fake node shell. The unit state lives in files of the returned
+// directory.
+func fakeSystemd(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"systemctl": `case "$*" in
+*"--value mcp-dist-upgrade.service") cat ` + dir + `/substate 2>/dev/null || echo dead ;;
+*"-p SubState -p ExecMainStatus"*) echo "ExecMainStatus=$(cat ` + dir + `/status)"
+  echo "SubState=$(cat ` + dir + `/substate)" ;;
+esac`,
+		"systemd-run": `echo "$@" > ` + dir + `/run; echo exited > ` + dir + `/substate; echo 0 > ` + dir + `/status`,
+		"journalctl":  `echo "1 upgraded, 0 newly installed, 0 to remove and 0 not upgraded."`,
+	}
+	for name, script := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return dir
+}
+
+func TestUpgradeNodeRunsDetached(t *testing.T) {
+	dir := fakeSystemd(t)
+	s, err := mcplib.New(startFakeTerminalPVE(t, "shell"), fakeToken, nil, mcplib.Options{AllowElevated: true})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	res := callTool(t, s, "upgrade_node", map[string]any{"node": "pve1", "timeout": "30"})
+	if res.IsError {
+		t.Fatalf("unexpected error: %s", resultText(res))
+	}
+	var got struct {
+		ExitCode int    `json:"exitcode"`
+		Output   string `json:"output"`
+	}
+	if err := json.Unmarshal([]byte(resultText(res)), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.ExitCode != 0 || !strings.Contains(got.Output, "1 upgraded") {
+		t.Errorf("unexpected result: %+v", got)
+	}
+	run, _ := os.ReadFile(filepath.Join(dir, "run"))
+	if !strings.Contains(string(run), "--unit=mcp-dist-upgrade.service") ||
+		!strings.Contains(string(run), "apt-get") {
+		t.Errorf("expected the upgrade to run in a systemd unit, got %q", run)
+	}
+
+	// An upgrade still running is attached to, not started again, and keeps
+	// running when the timeout elapses.
+	_ = os.Remove(filepath.Join(dir, "run"))
+	_ = os.WriteFile(filepath.Join(dir, "substate"), []byte("running\n"), 0o600)
+	res = callTool(t, s, "upgrade_node", map[string]any{"node": "pve1", "timeout": "1"})
+	if !res.IsError || !strings.Contains(resultText(res), `"timed_out": true`) ||
+		!strings.Contains(resultText(res), "still running") {
+		t.Errorf("expected a timeout with the upgrade still running, got %s", resultText(res))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "run")); err == nil {
+		t.Error("a running upgrade must not be started again")
+	}
+}
@@ -0,0 +1,560 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// notificationEndpointSpec lists the type-specific parameters of a
+// notification endpoint type by their API name.
+type notificationEndpointSpec struct {
+	required []string
+	optional []string
+}
+
+func notificationEndpointTypes() []string {
+	return []string{"sendmail", "smtp", "gotify", "webhook"}
+}
+
+func notificationEndpointSpecFor(endpointType string) (notificationEndpointSpec, bool) {
+	switch endpointType {
+	case "sendmail":
+		return notificationEndpointSpec{
+			optional: []string{"mailto", "mailto-user", "from-address", "author"},
+		}, true
+	case "smtp":
+		return notificationEndpointSpec{
+			required: []string{"server", "from-address"},
+			optional: []string{"port", "mode", "username", "password", "mailto", "mailto-user", "author"},
+		}, true
+	case "gotify":
+		return notificationEndpointSpec{
+			required: []string{"server", "token"},
+		}, true
+	case "webhook":
+		return notificationEndpointSpec{
+			required: []string{"url", "method"},
+			optional: []string{"header", "body", "secret"},
+		}, true
+	}
+	return notificationEndpointSpec{}, false
+}
+
+// notificationListParams are endpoint parameters passed as repeated API
+// parameters.
+func notificationListParams() []string {
+	return []string{"mailto", "mailto-user", "header", "secret"}
+}
+
+// allNotificationEndpointParams returns every endpoint parameter, sorted.
+func allNotificationEndpointParams() []string {
+	seen := map[string]bool{"comment": true, "disable": true}
+	for _, t := range notificationEndpointTypes() {
+		spec, _ := notificationEndpointSpecFor(t)
+		for _, p := range append(spec.required, spec.optional...) {
+			seen[p] = true
+		}
+	}
+	params := make([]string, 0, len(seen))
+	for p := range seen {
+		params = append(params, p)
+	}
+	sort.Strings(params)
+	return params
+}
+
+// webhookKeyValue converts "name=value" into the property string Proxmox
+// expects for webhook headers and secrets, with the value base64 encoded.
+func webhookKeyValue(arg, entry string) (string, error) {
+	name, value, found := strings.Cut(entry, "=")
+	if !found || strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("%s entries must have the form name=value, got %q", arg, entry)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(value))
+	return fmt.Sprintf("name=%s,value=%s", strings.TrimSpace(name), encoded), nil
+}
+
+// notificationEndpointParams validates the endpoint parameters in req against
+// endpointType and returns them keyed by API name.
+func notificationEndpointParams(req mcp.CallToolRequest, endpointType string, create bool) (url.Values, error) {
+	spec, ok := notificationEndpointSpecFor(endpointType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported endpoint type %q (supported: %s)", endpointType,
+			strings.Join(notificationEndpointTypes(), ", "))
+	}
+	allowed := append(append([]string{"comment", "disable"}, spec.required...), spec.optional...)
+
+	data := url.Values{}
+	for _, p := range allNotificationEndpointParams() {
+		arg := storageArgName(p)
+		var values []string
+		if slices.Contains(notificationListParams(), p) {
+			values = req.GetStringSlice(arg, nil)
+		} else if v := req.GetString(arg, ""); v != "" {
+			values = []string{v}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if !slices.Contains(allowed, p) {
+			return nil, fmt.Errorf("%s is not a valid parameter for %s endpoints", arg, endpointType)
+		}
+
+		for _, v := range values {
+			switch p {
+			case "header", "secret":
+				kv, err := webhookKeyValue(arg, v)
+				if err != nil {
+					return nil, err
+				}
+				v = kv
+			case "body":
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			data.Add(p, v)
+		}
+	}
+
+	if create {
+		var missing []string
+		for _, p := range spec.required {
+			if len(data[p]) == 0 {
+				missing = append(missing, storageArgName(p))
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s endpoints require %s", endpointType, strings.Join(missing, ", "))
+		}
+		if endpointType == "sendmail" && len(data["mailto"]) == 0 && len(data["mailto-user"]) == 0 {
+			return nil, fmt.Errorf("sendmail endpoints require mailto or mailto_user")
+		}
+	}
+	return data, nil
+}
+
+func notificationEndpointParamOptions() []mcp.ToolOption {
+	descriptions := map[string]string{
+		"comment":      "Comment",
+		"disable":      "Disable the endpoint: 1 or 0",
+		"mailto":       "sendmail/smtp: recipient e-mail addresses",
+		"mailto-user":  "sendmail/smtp: recipient users (e-mail address from the user config, e.g. root@pam)",
+		"from-address": "sendmail/smtp: sender address",
+		"author":       "sendmail/smtp: sender display name",
+		"server":       "smtp: mail server host; gotify: server URL",
+		"port":         "smtp: server port (default depends on mode)",
+		"mode":         "smtp: connection security: insecure, starttls or tls (default: tls)",
+		"username":     "smtp: user name for authentication",
+		"password":     "smtp: password (never logged or returned)",
+		"token":        "gotify: application token (never logged or returned)",
+		"url":          "webhook: URL, may contain {{ secrets.<name> }} templates",
+		"method":       "webhook: HTTP method: post, put or get",
+		"header":       "webhook: HTTP headers as name=value (stored in plain text; put credentials in secret)",
+		"body":         "webhook: body template (e.g. {\"text\": \"{{ escape message }}\"})",
+		"secret":       "webhook: secrets as name=value, usable as {{ secrets.<name> }} (never logged or returned)",
+	}
+
+	var opts []mcp.ToolOption
+	for _, p := range allNotificationEndpointParams() {
+		if slices.Contains(notificationListParams(), p) {
+			opts = append(opts, mcp.WithArray(storageArgName(p),
+				mcp.Description(descriptions[p]),
+				mcp.WithStringItems(),
+			))
+			continue
+		}
+		opts = append(opts, mcp.WithString(storageArgName(p), mcp.Description(descriptions[p])))
+	}
+	return opts
+}
+
+// notificationMatcherParams returns the matcher parameters in req keyed by
+// API name.
+func notificationMatcherParams(req mcp.CallToolRequest) url.Values {
+	data := url.Values{}
+	for _, p := range []string{"match-field", "match-severity", "match-calendar", "target"} {
+		for _, v := range req.GetStringSlice(storageArgName(p), nil) {
+			data.Add(p, v)
+		}
+	}
+	for _, p := range []string{"mode", "invert-match", "comment", "disable"} {
+		if v := req.GetString(storageArgName(p), ""); v != "" {
+			data.Set(p, v)
+		}
+	}
+	return data
+}
+
+func notificationMatcherParamOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithArray("match_field",
+			mcp.Description("Metadata field rules, e.g. exact:type=vzdump or regex:hostname=^pve1$"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("match_severity",
+			mcp.Description("Severities to match, e.g. error,warning (info, notice, warning, error, unknown)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("match_calendar",
+			mcp.Description("Calendar events to match on the notification timestamp, e.g. mon..fri 8-17"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithArray("target",
+			mcp.Description("Targets (endpoint names) to notify when the matcher matches"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("mode",
+			mcp.Description("Combine the match rules with: all or any (default: all)"),
+		),
+		mcp.WithString("invert_match",
+			mcp.Description("Invert the result of the match rules: 1 or 0"),
+		),
+		mcp.WithString("comment",
+			mcp.Description("Comment"),
+		),
+		mcp.WithString("disable",
+			mcp.Description("Disable the matcher: 1 or 0"),
+		),
+	}
+}
+
+func notificationEndpointPath(endpointType, name string) string {
+	path := "/cluster/notifications/endpoints/" + endpointType
+	if name != "" {
+		path += "/" + url.PathEscape(name)
+	}
+	return path
+}
+
+func RegisterNotificationTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_notification_targets",
+			mcp.WithDescription("List all notification targets (endpoints of every type) with their type and origin"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/notifications/targets")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_notification_endpoints",
+			mcp.WithDescription("List the notification endpoints of a type; secrets are redacted"),
+			mcp.WithString("type",
+				mcp.Description("Endpoint type: sendmail, smtp, gotify or webhook"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			endpointType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !slices.Contains(notificationEndpointTypes(), endpointType) {
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported endpoint type %q", endpointType)), nil
+			}
+			result, err := c.Get(ctx, notificationEndpointPath(endpointType, ""))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_notification_endpoint",
+			mcp.WithDescription("Get a notification endpoint; secrets are redacted"),
+			mcp.WithString("type",
+				mcp.Description("Endpoint type: sendmail, smtp, gotify or webhook"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Endpoint name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			endpointType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !slices.Contains(notificationEndpointTypes(), endpointType) {
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported endpoint type %q", endpointType)), nil
+			}
+			result, err := c.Get(ctx, notificationEndpointPath(endpointType, name))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(redactResponseSecrets(result)), nil
+		},
+	)
+
+	createOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Create a notification endpoint. Required parameters per type: sendmail (mailto or mailto_user), " +
+				"smtp (server, from_address), gotify (server, token), webhook (url, method)",
+		),
+		mcp.WithString("type",
+			mcp.Description("Endpoint type: sendmail, smtp, gotify or webhook"),
+			mcp.Required(),
+		),
+		mcp.WithString("name",
+			mcp.Description("Endpoint name"),
+			mcp.Required(),
+		),
+	}, notificationEndpointParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_notification_endpoint", createOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			endpointType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := notificationEndpointParams(req, endpointType, true)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data.Set("name", name)
+
+			result, err := c.Post(ctx, notificationEndpointPath(endpointType, ""), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updateOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Update a notification endpoint. List parameters (mailto, header, secret, ...) replace the current " +
+				"values",
+		),
+		mcp.WithString("type",
+			mcp.Description("Endpoint type: sendmail, smtp, gotify or webhook"),
+			mcp.Required(),
+		),
+		mcp.WithString("name",
+			mcp.Description("Endpoint name"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to remove"),
+		),
+	}, notificationEndpointParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_notification_endpoint", updateOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			endpointType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := notificationEndpointParams(req, endpointType, false)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("no settings to update"), nil
+			}
+
+			result, err := c.Put(ctx, notificationEndpointPath(endpointType, name), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_notification_endpoint",
+			mcp.WithDescription("Delete a notification endpoint"),
+			mcp.WithString("type",
+				mcp.Description("Endpoint type: sendmail, smtp, gotify or webhook"),
+				mcp.Required(),
+			),
+			mcp.WithString("name",
+				mcp.Description("Endpoint name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			endpointType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !slices.Contains(notificationEndpointTypes(), endpointType) {
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported endpoint type %q", endpointType)), nil
+			}
+			result, err := c.Delete(ctx, notificationEndpointPath(endpointType, name), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_notification_matchers",
+			mcp.WithDescription("List the notification matchers that route notifications to targets"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			result, err := c.Get(ctx, "/cluster/notifications/matchers")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_notification_matcher",
+			mcp.WithDescription("Get a notification matcher"),
+			mcp.WithString("name",
+				mcp.Description("Matcher name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/cluster/notifications/matchers/"+url.PathEscape(name))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	createMatcherOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Create a notification matcher"),
+		mcp.WithString("name",
+			mcp.Description("Matcher name"),
+			mcp.Required(),
+		),
+	}, notificationMatcherParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_notification_matcher", createMatcherOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := notificationMatcherParams(req)
+			data.Set("name", name)
+
+			result, err := c.Post(ctx, "/cluster/notifications/matchers", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updateMatcherOpts := append([]mcp.ToolOption{
+		mcp.WithDescription("Update a notification matcher. List parameters replace the current values"),
+		mcp.WithString("name",
+			mcp.Description("Matcher name"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to remove"),
+		),
+	}, notificationMatcherParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_notification_matcher", updateMatcherOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := notificationMatcherParams(req)
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("no settings to update"), nil
+			}
+
+			result, err := c.Put(ctx, "/cluster/notifications/matchers/"+url.PathEscape(name), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_notification_matcher",
+			mcp.WithDescription("Delete a notification matcher"),
+			mcp.WithString("name",
+				mcp.Description("Matcher name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			name, err := req.RequireString("name")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/cluster/notifications/matchers/"+url.PathEscape(name), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("send_test_notification",
+			mcp.WithDescription("Send a test notification to a target, bypassing the matchers"),
+			mcp.WithString("target",
+				mcp.Description("Target (endpoint) name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			target, err := req.RequireString("target")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			path := fmt.Sprintf("/cluster/notifications/targets/%s/test", url.PathEscape(target))
+			if _, err := c.Post(ctx, path, nil); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Test notification sent to %s", target)), nil
+		},
+	)
+}
@@ -0,0 +1,435 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxFileRestoreSize bounds files and archives returned by download_backup_file.
+const maxFileRestoreSize = 64 << 20
+
+// pbsSnapshot is a backup snapshot as listed in the content of a PBS storage.
+type pbsSnapshot struct {
+	VolID        string  `json:"volid"`
+	VMID         int     `json:"vmid"`
+	CTime        int64   `json:"ctime"`
+	Size         int64   `json:"size"`
+	Notes        string  `json:"notes"`
+	Protected    pveBool `json:"protected"`
+	Verification *struct {
+		State string `json:"state"`
+	} `json:"verification"`
+}
+
+// group returns the backup group ("vm/100") of the snapshot.
+func (p pbsSnapshot) group() string {
+	_, name, _ := strings.Cut(p.VolID, ":")
+	parts := strings.Split(strings.TrimPrefix(name, "backup/"), "/")
+	if len(parts) < 2 {
+		return name
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+func (p pbsSnapshot) verifyState() string {
+	if p.Verification == nil || p.Verification.State == "" {
+		return "none"
+	}
+	return p.Verification.State
+}
+
+type pbsSnapshotInfo struct {
+	VolID        string `json:"volid"`
+	VMID         int    `json:"vmid"`
+	Time         string `json:"time"`
+	Size         int64  `json:"size"`
+	Protected    bool   `json:"protected"`
+	Verification string `json:"verification"`
+	Notes        string `json:"notes,omitempty"`
+}
+
+type pbsGroupInfo struct {
+	Group         string `json:"group"`
+	Snapshots     int    `json:"snapshots"`
+	LastBackup    string `json:"last_backup"`
+	TotalSize     int64  `json:"total_size"`
+	Protected     int    `json:"protected"`
+	VerifyFailed  int    `json:"verify_failed"`
+	VerifyMissing int    `json:"unverified"`
+	LastSnapshot  string `json:"last_snapshot"`
+}
+
+func formatCTime(ctime int64) string {
+	return time.Unix(ctime, 0).UTC().Format(time.RFC3339)
+}
+
+func listPBSSnapshots(ctx context.Context, c *ProxmoxClient, node, storage, vmid string) ([]pbsSnapshot, error) {
+	q := url.Values{"content": {"backup"}}
+	if vmid != "" {
+		q.Set("vmid", vmid)
+	}
+	var snaps []pbsSnapshot
+	path := fmt.Sprintf("/nodes/%s/storage/%s/content?%s", node, storage, q.Encode())
+	if err := c.GetJSON(ctx, path, &snaps); err != nil {
+		return nil, err
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].CTime > snaps[j].CTime })
+	return snaps, nil
+}
+
+// summarizePBSGroups groups snapshots (newest first) by backup group.
+func summarizePBSGroups(snaps []pbsSnapshot) []pbsGroupInfo {
+	byGroup := map[string]*pbsGroupInfo{}
+	var order []string
+	for _, s := range snaps {
+		name := s.group()
+		g, ok := byGroup[name]
+		if !ok {
+			g = &pbsGroupInfo{Group: name, LastBackup: formatCTime(s.CTime), LastSnapshot: s.VolID}
+			byGroup[name] = g
+			order = append(order, name)
+		}
+		g.Snapshots++
+		g.TotalSize += s.Size
+		if s.Protected {
+			g.Protected++
+		}
+		switch s.verifyState() {
+		case "ok":
+		case "none":
+			g.VerifyMissing++
+		default:
+			g.VerifyFailed++
+		}
+	}
+
+	sort.Strings(order)
+	groups := make([]pbsGroupInfo, 0, len(order))
+	for _, name := range order {
+		groups = append(groups, *byGroup[name])
+	}
+	return groups
+}
+
+// encodeRestorePath encodes a path inside a backup for the file-restore API,
+// which takes base64 paths except for the root.
+func encodeRestorePath(p string) string {
+	if p == "" || p == "/" {
+		return "/"
+	}
+	return base64.StdEncoding.EncodeToString([]byte(p))
+}
+
+// restoreFileName names a download_backup_file result. Directories are
+// returned by Proxmox as zip or tar.zst archives.
+func restoreFileName(p string, data []byte) (string, string) {
+	trimmed := strings.TrimRight(p, "/")
+	name := trimmed[strings.LastIndex(trimmed, "/")+1:]
+	if name == "" {
+		name = "backup"
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return name + ".zip", "application/zip"
+	case bytes.HasPrefix(data, []byte{0x28, 0xB5, 0x2F, 0xFD}):
+		return name + ".tar.zst", "application/zstd"
+	}
+	return name, "application/octet-stream"
+}
+
+func pbsVolumeOptions() []mcp.ToolOption {
+	return []mcp.ToolOption{
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("storage",
+			mcp.Description("PBS storage name"),
+			mcp.Required(),
+		),
+		mcp.WithString("volume",
+			mcp.Description("Backup snapshot volume ID (e.g. pbs:backup/vm/100/2025-01-01T02:00:00Z)"),
+			mcp.Required(),
+		),
+	}
+}
+
+func RegisterPBSTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_pbs_namespaces",
+			mcp.WithDescription(
+				"List the Proxmox Backup Server datastores and namespaces configured as storages, with the "+
+					"storage name to use in the other PBS tools",
+			),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var storages []struct {
+				Storage   string  `json:"storage"`
+				Server    string  `json:"server"`
+				Datastore string  `json:"datastore"`
+				Namespace string  `json:"namespace"`
+				Nodes     string  `json:"nodes"`
+				Disable   pveBool `json:"disable"`
+			}
+			if err := c.GetJSON(ctx, "/storage?type=pbs", &storages); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			type namespaceInfo struct {
+				Storage   string `json:"storage"`
+				Server    string `json:"server"`
+				Datastore string `json:"datastore"`
+				Namespace string `json:"namespace"`
+				Nodes     string `json:"nodes,omitempty"`
+				Disabled  bool   `json:"disabled,omitempty"`
+			}
+			out := make([]namespaceInfo, 0, len(storages))
+			for _, st := range storages {
+				ns := st.Namespace
+				if ns == "" {
+					ns = "(root)"
+				}
+				out = append(out, namespaceInfo{
+					Storage: st.Storage, Server: st.Server, Datastore: st.Datastore, Namespace: ns,
+					Nodes: st.Nodes, Disabled: bool(st.Disable),
+				})
+			}
+
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(b)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_pbs_groups",
+			mcp.WithDescription(
+				"List the backup groups (vm/<id>, ct/<id>) on a PBS storage with snapshot count, latest backup, "+
+					"total size, and protected and unverified snapshot counts",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("storage",
+				mcp.Description("PBS storage name"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			snaps, err := listPBSSnapshots(ctx, c, node, storage, "")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			b, err := json.MarshalIndent(summarizePBSGroups(snaps), "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(b)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_pbs_snapshots",
+			mcp.WithDescription(
+				"List the backup snapshots on a PBS storage, newest first, with size, protection and verification "+
+					"state (ok, failed or none). Use update_volume to protect a snapshot",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("storage",
+				mcp.Description("PBS storage name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("Only list snapshots of this VM/container ID"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			snaps, err := listPBSSnapshots(ctx, c, node, storage, req.GetString("vmid", ""))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out := make([]pbsSnapshotInfo, 0, len(snaps))
+			for _, s := range snaps {
+				out = append(out, pbsSnapshotInfo{
+					VolID: s.VolID, VMID: s.VMID, Time: formatCTime(s.CTime), Size: s.Size,
+					Protected: bool(s.Protected), Verification: s.verifyState(), Notes: s.Notes,
+				})
+			}
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(b)), nil
+		},
+	)
+
+	browseOpts := append(pbsVolumeOptions(),
+		mcp.WithDescription(
+			"Browse the files inside a PBS backup snapshot. Start at / to see the archives (disk images or "+
+				"container root), then descend into partitions and directories",
+		),
+		mcp.WithString("path",
+			mcp.Description("Path inside the snapshot, as returned in the path field of earlier results (default: /)"),
+		),
+	)
+	s.AddTool(
+		mcp.NewTool("browse_backup_files", browseOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			volume, err := req.RequireString("volume")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			q := url.Values{
+				"volume":   {volume},
+				"filepath": {encodeRestorePath(req.GetString("path", "/"))},
+			}
+			var entries []struct {
+				FilePath string  `json:"filepath"`
+				Text     string  `json:"text"`
+				Type     string  `json:"type"`
+				Size     int64   `json:"size"`
+				MTime    int64   `json:"mtime"`
+				Leaf     pveBool `json:"leaf"`
+			}
+			path := fmt.Sprintf("/nodes/%s/storage/%s/file-restore/list?%s", node, storage, q.Encode())
+			if err := c.GetJSON(ctx, path, &entries); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			type fileEntry struct {
+				Path  string `json:"path"`
+				Name  string `json:"name"`
+				Type  string `json:"type"`
+				Size  int64  `json:"size,omitempty"`
+				MTime string `json:"mtime,omitempty"`
+				Leaf  bool   `json:"leaf"`
+			}
+			out := make([]fileEntry, 0, len(entries))
+			for _, e := range entries {
+				p, err := base64.StdEncoding.DecodeString(e.FilePath)
+				if err != nil {
+					p = []byte(e.FilePath)
+				}
+				f := fileEntry{Path: string(p), Name: e.Text, Type: e.Type, Size: e.Size, Leaf: bool(e.Leaf)}
+				if e.MTime > 0 {
+					f.MTime = formatCTime(e.MTime)
+				}
+				out = append(out, f)
+			}
+			b, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(b)), nil
+		},
+	)
+
+	downloadOpts := append(pbsVolumeOptions(),
+		mcp.WithDescription(
+			"Download a file or directory from a PBS backup snapshot (up to 64 MiB). Directories are returned "+
+				"as a zip archive, or tar.zst with format=tar",
+		),
+		mcp.WithString("path",
+			mcp.Description("Path inside the snapshot, as returned by browse_backup_files"),
+			mcp.Required(),
+		),
+		mcp.WithString("format",
+			mcp.Description("Archive format for directories: zip or tar (default: zip)"),
+		),
+	)
+	s.AddTool(
+		mcp.NewTool("download_backup_file", downloadOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			volume, err := req.RequireString("volume")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			filePath, err := req.RequireString("path")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			q := url.Values{
+				"volume":   {volume},
+				"filepath": {encodeRestorePath(filePath)},
+			}
+			switch req.GetString("format", "zip") {
+			case "zip":
+			case "tar":
+				q.Set("tar", "1")
+			default:
+				return mcp.NewToolResultError("format must be zip or tar"), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/storage/%s/file-restore/download?%s", node, storage, q.Encode())
+			data, err := c.Download(ctx, path, maxFileRestoreSize)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			name, mimeType := restoreFileName(filePath, data)
+			return mcp.NewToolResultResource(
+				fmt.Sprintf("Restored %s from %s (%d bytes) as %s", filePath, volume, len(data), name),
+				mcp.BlobResourceContents{
+					URI:      "file:///" + name,
+					MIMEType: mimeType,
+					Blob:     base64.StdEncoding.EncodeToString(data),
+				},
+			), nil
+		},
+	)
+}
@@ -0,0 +1,835 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	specDiskKeyRe   = regexp.MustCompile(`^(scsi|virtio|sata|ide)[0-9]+$`)
+	specNICKeyRe    = regexp.MustCompile(`^net[0-9]+$`)
+	specOptionKeyRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	specSizeRe      = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)([KMGT]?)$`)
+)
+
+const (
+	planStatePrefix     = "plan-"
+	defaultApplyTimeout = 1800
+)
+
+// guestSpec is the desired state of a VM. Only the fields that are set are
+// managed; nothing that is missing from the spec is removed from a guest.
+type guestSpec struct {
+	VMID      int                 `yaml:"vmid"`
+	Name      string              `yaml:"name"`
+	Node      string              `yaml:"node"`
+	Cores     int                 `yaml:"cores"`
+	Sockets   int                 `yaml:"sockets"`
+	Memory    int                 `yaml:"memory"`
+	CPU       string              `yaml:"cpu"`
+	OSType    string              `yaml:"ostype"`
+	Disks     map[string]diskSpec `yaml:"disks"`
+	NICs      map[string]nicSpec  `yaml:"nics"`
+	CloudInit *cloudInitSpec      `yaml:"cloudinit"`
+	Tags      []string            `yaml:"tags"`
+	Pool      string              `yaml:"pool"`
+	Options   map[string]string   `yaml:"options"`
+}
+
+type diskSpec struct {
+	Storage string `yaml:"storage"`
+	Size    string `yaml:"size"`
+	Options string `yaml:"options"`
+}
+
+type nicSpec struct {
+	Model    string `yaml:"model"`
+	Bridge   string `yaml:"bridge"`
+	Tag      *int   `yaml:"tag"`
+	Firewall *bool  `yaml:"firewall"`
+	MACAddr  string `yaml:"macaddr"`
+	Options  string `yaml:"options"`
+}
+
+type cloudInitSpec struct {
+	Drive        string            `yaml:"drive"`
+	Storage      string            `yaml:"storage"`
+	User         string            `yaml:"user"`
+	SSHKeys      string            `yaml:"sshkeys"`
+	IPConfig     map[string]string `yaml:"ipconfig"`
+	Nameserver   string            `yaml:"nameserver"`
+	Searchdomain string            `yaml:"searchdomain"`
+}
+
+type guestSpecFile struct {
+	Guests []guestSpec `yaml:"guests"`
+}
+
+// parseGuestSpec decodes a YAML or JSON spec. JSON is valid YAML, so both go
+// through the YAML decoder; unknown fields are refused to catch typos.
+func parseGuestSpec(spec string) ([]guestSpec, error) {
+	dec := yaml.NewDecoder(strings.NewReader(spec))
+	dec.KnownFields(true)
+	var f guestSpecFile
+	if err := dec.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	if len(f.Guests) == 0 {
+		return nil, errors.New("the spec has no guests")
+	}
+
+	seen := map[int]bool{}
+	for _, g := range f.Guests {
+		if g.VMID < 100 {
+			return nil, fmt.Errorf("guest %q: vmid must be 100 or higher", g.Name)
+		}
+		if seen[g.VMID] {
+			return nil, fmt.Errorf("guest %d is listed twice", g.VMID)
+		}
+		seen[g.VMID] = true
+		if err := g.validate(); err != nil {
+			return nil, fmt.Errorf("guest %d: %w", g.VMID, err)
+		}
+	}
+	return f.Guests, nil
+}
+
+func (g guestSpec) validate() error {
+	for key, d := range g.Disks {
+		if !specDiskKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid disk %q", key)
+		}
+		if _, err := parseSpecSize(d.Size); err != nil {
+			return fmt.Errorf("disk %s: %w", key, err)
+		}
+	}
+	for key := range g.NICs {
+		if !specNICKeyRe.MatchString(key) {
+			return fmt.Errorf("invalid NIC %q", key)
+		}
+	}
+	if g.CloudInit != nil {
+		for key := range g.CloudInit.IPConfig {
+			if !ipconfigKeyRe.MatchString(key) {
+				return fmt.Errorf("invalid cloud-init key %q", key)
+			}
+		}
+	}
+	for key := range g.Options {
+		if !specOptionKeyRe.MatchString(key) || specDiskKeyRe.MatchString(key) || specNICKeyRe.MatchString(key) {
+			return fmt.Errorf("option %q must be set through disks or nics, or is invalid", key)
+		}
+	}
+	for _, tag := range g.Tags {
+		if !pveTagRe.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	return nil
+}
+
+// parseSpecSize converts a size like 32G or 512M to bytes. A number without
+// unit is in GiB, as in the Proxmox storage:size syntax.
+func parseSpecSize(s string) (int64, error) {
+	m := specSizeRe.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q (e.g. 32G)", s)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := map[string]uint{"K": 10, "M": 20, "G": 30, "": 30, "T": 40}[m[2]]
+	return int64(v * float64(int64(1)<<shift)), nil
+}
+
+func formatGiB(b int64) string {
+	return strconv.FormatFloat(float64(b)/(1<<30), 'f', -1, 64)
+}
+
+// setProperty sets key=value in a Proxmox property string, keeping the order
+// of the other properties; an empty value removes the key.
+func setProperty(s, key, value string) string {
+	var parts []string
+	found := false
+	for _, part := range strings.Split(s, ",") {
+		k, _, _ := strings.Cut(part, "=")
+		switch {
+		case part == "":
+		case k != key:
+			parts = append(parts, part)
+		case value != "" && !found:
+			parts = append(parts, key+"="+value)
+			found = true
+		}
+	}
+	if value != "" && !found {
+		parts = append(parts, key+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// mergeProperties applies the key=value pairs of options to s.
+func mergeProperties(s, options string) string {
+	for _, part := range strings.Split(options, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			s = setProperty(s, strings.TrimSpace(k), strings.TrimSpace(v))
+		}
+	}
+	return s
+}
+
+// planStep is a single change of a plan.
+type planStep struct {
+	Action  string            `json:"action"`
+	VMID    int               `json:"vmid"`
+	Node    string            `json:"node"`
+	Changes []string          `json:"changes"`
+	Reboot  bool              `json:"reboot,omitempty"`
+	Params  map[string]string `json:"params"`
+	Digest  string            `json:"digest,omitempty"`
+	Result  string            `json:"result,omitempty"`
+	Detail  string            `json:"detail,omitempty"`
+}
+
+// guestPlan is saved in the state directory by plan_guests and executed by
+// apply_guest_plan.
+type guestPlan struct {
+	ID       string     `json:"id,omitempty"`
+	Status   string     `json:"status"`
+	Created  time.Time  `json:"created"`
+	Applied  time.Time  `json:"applied,omitzero"`
+	Steps    []planStep `json:"steps"`
+	Warnings []string   `json:"warnings,omitempty"`
+}
+
+// configChanges collects the config parameters of an update step.
+type configChanges struct {
+	params  map[string]string
+	changes []string
+	reboot  bool
+}
+
+func (cc *configChanges) set(key, from, to string, reboot bool) {
+	if from == to {
+		return
+	}
+	if cc.params == nil {
+		cc.params = map[string]string{}
+	}
+	cc.params[key] = to
+	if from == "" {
+		cc.changes = append(cc.changes, fmt.Sprintf("%s: set to %s", key, to))
+	} else {
+		cc.changes = append(cc.changes, fmt.Sprintf("%s: %s -> %s", key, from, to))
+	}
+	cc.reboot = cc.reboot || reboot
+}
+
+func configString(conf map[string]any, key string) string {
+	switch v := conf[key].(type) {
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// nicValue builds the netX value of a new NIC.
+func nicValue(n nicSpec) string {
+	model := n.Model
+	if model == "" {
+		model = "virtio"
+	}
+	v := model
+	if n.MACAddr != "" {
+		v += "=" + n.MACAddr
+	}
+	if n.Bridge != "" {
+		v += ",bridge=" + n.Bridge
+	}
+	if n.Tag != nil && *n.Tag > 0 {
+		v += ",tag=" + strconv.Itoa(*n.Tag)
+	}
+	if n.Firewall != nil && *n.Firewall {
+		v += ",firewall=1"
+	}
+	return mergeProperties(v, n.Options)
+}
+
+// updatedNIC applies n to the live netX value. It reports whether the change
+// needs a restart of the VM (model or MAC address).
+func updatedNIC(live string, n nicSpec) (string, bool) {
+	first, rest, _ := strings.Cut(live, ",")
+	model, mac, _ := strings.Cut(first, "=")
+	reboot := false
+	if n.Model != "" && n.Model != model {
+		model, reboot = n.Model, true
+	}
+	if n.MACAddr != "" && !strings.EqualFold(n.MACAddr, mac) {
+		mac, reboot = n.MACAddr, true
+	}
+	v := model
+	if mac != "" {
+		v += "=" + mac
+	}
+	if rest != "" {
+		v += "," + rest
+	}
+	if n.Bridge != "" {
+		v = setProperty(v, "bridge", n.Bridge)
+	}
+	if n.Tag != nil {
+		tag := ""
+		if *n.Tag > 0 {
+			tag = strconv.Itoa(*n.Tag)
+		}
+		v = setProperty(v, "tag", tag)
+	}
+	if n.Firewall != nil {
+		fw := "0"
+		if *n.Firewall {
+			fw = "1"
+		}
+		v = setProperty(v, "firewall", fw)
+	}
+	return mergeProperties(v, n.Options), reboot
+}
+
+// noRebootOptions are config options that take effect without a restart.
+func noRebootOptions() []string {
+	return []string{"name", "tags", "description", "onboot", "protection", "startup", "hotplug", "boot"}
+}
+
+// hotplugs returns the hotplug features of a VM config.
+func hotplugs(conf map[string]any) []string {
+	v := configString(conf, "hotplug")
+	switch v {
+	case "", "1":
+		return []string{"network", "disk", "usb"}
+	case "0":
+		return nil
+	}
+	return strings.Split(v, ",")
+}
+
+// planGuest compares a spec with the live guest and returns the steps that
+// make the guest match it.
+func planGuest(g guestSpec, node string, conf map[string]any, //nolint:funlen,gocognit
+	running bool,
+) ([]planStep, []string) {
+	var warnings []string
+	hot := hotplugs(conf)
+	var cc configChanges
+
+	setInt := func(key string, want int, reboot bool) {
+		if want > 0 {
+			from := configString(conf, key)
+			if _, current, ok := strings.Cut(from, "current="); ok {
+				from = current
+			}
+			cc.set(key, from, strconv.Itoa(want), reboot)
+		}
+	}
+	setString := func(key, want string, reboot bool) {
+		if want != "" {
+			cc.set(key, configString(conf, key), want, reboot)
+		}
+	}
+
+	setString("name", g.Name, false)
+	setInt("cores", g.Cores, true)
+	setInt("sockets", g.Sockets, true)
+	setInt("memory", g.Memory, !slices.Contains(hot, "memory"))
+	setString("cpu", g.CPU, true)
+	setString("ostype", g.OSType, true)
+	if g.Tags != nil {
+		live := strings.FieldsFunc(configString(conf, "tags"), func(r rune) bool { return r == ';' || r == ',' })
+		slices.Sort(live)
+		want := slices.Clone(g.Tags)
+		slices.Sort(want)
+		cc.set("tags", strings.Join(live, ";"), strings.Join(want, ";"), false)
+	}
+	for _, key := range sortedKeys(g.Options) {
+		cc.set(key, configString(conf, key), g.Options[key], !slices.Contains(noRebootOptions(), key))
+	}
+
+	var resizes []planStep
+	for _, key := range sortedKeys(g.Disks) {
+		d := g.Disks[key]
+		size, _ := parseSpecSize(d.Size)
+		live := configString(conf, key)
+		if live == "" {
+			if d.Storage == "" {
+				warnings = append(warnings, fmt.Sprintf("guest %d: disk %s needs a storage to be created", g.VMID, key))
+				continue
+			}
+			hotDisk := slices.Contains(hot, "disk") &&
+				(strings.HasPrefix(key, "scsi") || strings.HasPrefix(key, "virtio"))
+			value := mergeProperties(d.Storage+":"+formatGiB(size), d.Options)
+			cc.set(key, "", value, !hotDisk)
+			continue
+		}
+
+		volume, _, _ := strings.Cut(live, ",")
+		if d.Storage != "" && !strings.HasPrefix(volume, d.Storage+":") {
+			warnings = append(warnings, fmt.Sprintf("guest %d: disk %s is on %s, not %s; moving disks is not "+
+				"planned", g.VMID, key, volume, d.Storage))
+		}
+		if d.Options != "" {
+			cc.set(key, live, mergeProperties(live, d.Options), true)
+		}
+		liveSize, err := parseSpecSize(parsePropertyString(live)["size"])
+		switch {
+		case err != nil:
+			warnings = append(warnings, fmt.Sprintf("guest %d: size of disk %s is unknown", g.VMID, key))
+		case size < liveSize:
+			warnings = append(warnings, fmt.Sprintf("guest %d: disk %s is %s, shrinking to %s is not supported",
+				g.VMID, key, parsePropertyString(live)["size"], d.Size))
+		case size > liveSize:
+			resizes = append(resizes, planStep{
+				Action:  "resize",
+				VMID:    g.VMID,
+				Node:    node,
+				Changes: []string{fmt.Sprintf("%s: %s -> %s", key, parsePropertyString(live)["size"], d.Size)},
+				Params:  map[string]string{"disk": key, "size": formatGiB(size) + "G"},
+			})
+		}
+	}
+
+	for _, key := range sortedKeys(g.NICs) {
+		n := g.NICs[key]
+		live := configString(conf, key)
+		if live == "" {
+			cc.set(key, "", nicValue(n), !slices.Contains(hot, "network"))
+			continue
+		}
+		value, reboot := updatedNIC(live, n)
+		cc.set(key, live, value, reboot)
+	}
+
+	if ci := g.CloudInit; ci != nil {
+		if ci.Storage != "" && !slices.ContainsFunc(sortedKeys(conf), func(k string) bool {
+			return specDiskKeyRe.MatchString(k) && strings.Contains(configString(conf, k), "cloudinit")
+		}) {
+			drive := ci.Drive
+			if drive == "" {
+				drive = "ide2"
+			}
+			cc.set(drive, configString(conf, drive), ci.Storage+":cloudinit", true)
+		}
+		setString("ciuser", ci.User, true)
+		setString("nameserver", ci.Nameserver, true)
+		setString("searchdomain", ci.Searchdomain, true)
+		for _, key := range sortedKeys(ci.IPConfig) {
+			setString(key, ci.IPConfig[key], true)
+		}
+		if ci.SSHKeys != "" {
+			live, _ := url.QueryUnescape(configString(conf, "sshkeys"))
+			if strings.TrimSpace(live) != strings.TrimSpace(strings.ReplaceAll(ci.SSHKeys, "\r\n", "\n")) {
+				if cc.params == nil {
+					cc.params = map[string]string{}
+				}
+				cc.params["sshkeys"] = encodeSSHKeys(ci.SSHKeys)
+				cc.changes = append(cc.changes, "sshkeys: changed")
+				cc.reboot = true
+			}
+		}
+	}
+
+	var steps []planStep
+	if len(cc.params) > 0 {
+		steps = append(steps, planStep{
+			Action:  "update",
+			VMID:    g.VMID,
+			Node:    node,
+			Changes: cc.changes,
+			Reboot:  cc.reboot && running,
+			Params:  cc.params,
+		})
+	}
+	steps = append(steps, resizes...)
+	if len(steps) > 0 {
+		// The digest guards the first change against edits made since the
+		// plan; later steps of the same guest change the digest themselves.
+		steps[0].Digest = configString(conf, "digest")
+	}
+	return steps, warnings
+}
+
+// createStep returns the step creating a guest from its spec.
+func createStep(g guestSpec) (planStep, error) {
+	if g.Node == "" {
+		return planStep{}, fmt.Errorf("guest %d does not exist and the spec has no node to create it on", g.VMID)
+	}
+	params := map[string]string{"vmid": strconv.Itoa(g.VMID)}
+	var changes []string
+	add := func(key, value string) {
+		if value != "" && value != "0" {
+			params[key] = value
+			changes = append(changes, key+": "+value)
+		}
+	}
+	add("name", g.Name)
+	add("cores", strconv.Itoa(g.Cores))
+	add("sockets", strconv.Itoa(g.Sockets))
+	add("memory", strconv.Itoa(g.Memory))
+	add("cpu", g.CPU)
+	add("ostype", g.OSType)
+	add("tags", strings.Join(g.Tags, ";"))
+	add("pool", g.Pool)
+	for _, key := range sortedKeys(g.Disks) {
+		d := g.Disks[key]
+		if d.Storage == "" {
+			return planStep{}, fmt.Errorf("guest %d: disk %s needs a storage", g.VMID, key)
+		}
+		size, _ := parseSpecSize(d.Size)
+		add(key, mergeProperties(d.Storage+":"+formatGiB(size), d.Options))
+	}
+	for _, key := range sortedKeys(g.NICs) {
+		add(key, nicValue(g.NICs[key]))
+	}
+	if ci := g.CloudInit; ci != nil {
+		if ci.Storage != "" {
+			drive := ci.Drive
+			if drive == "" {
+				drive = "ide2"
+			}
+			add(drive, ci.Storage+":cloudinit")
+		}
+		add("ciuser", ci.User)
+		add("nameserver", ci.Nameserver)
+		add("searchdomain", ci.Searchdomain)
+		for _, key := range sortedKeys(ci.IPConfig) {
+			add(key, ci.IPConfig[key])
+		}
+		if ci.SSHKeys != "" {
+			params["sshkeys"] = encodeSSHKeys(ci.SSHKeys)
+			changes = append(changes, "sshkeys: set")
+		}
+	}
+	for _, key := range sortedKeys(g.Options) {
+		add(key, g.Options[key])
+	}
+	return planStep{Action: "create", VMID: g.VMID, Node: g.Node, Changes: changes, Params: params}, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// buildGuestPlan computes the steps that make the cluster match the specs.
+func buildGuestPlan(ctx context.Context, c *ProxmoxClient, opts Options, specs []guestSpec) (*guestPlan, error) {
+	var resources []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &resources); err != nil {
+		return nil, err
+	}
+	live := map[int]clusterResource{}
+	for _, r := range resources {
+		live[r.VMID] = r
+	}
+
+	plan := &guestPlan{Status: "planned", Created: time.Now().UTC(), Steps: []planStep{}}
+	for _, g := range specs {
+		r, exists := live[g.VMID]
+		if len(opts.AllowedPools) > 0 {
+			if exists && !slices.Contains(opts.AllowedPools, r.Pool) {
+				return nil, fmt.Errorf("access denied: guest %d is not a member of an allowed pool", g.VMID)
+			}
+			if !exists && !slices.Contains(opts.AllowedPools, g.Pool) {
+				return nil, fmt.Errorf("guest %d must be created in one of the allowed pools", g.VMID)
+			}
+		}
+		if len(opts.AllowedPools) > 0 && g.Pool != "" && !slices.Contains(opts.AllowedPools, g.Pool) {
+			return nil, fmt.Errorf("access denied: pool %q is outside the allowed pools", g.Pool)
+		}
+
+		if !exists {
+			step, err := createStep(g)
+			if err != nil {
+				return nil, err
+			}
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+		if r.Type != "qemu" {
+			return nil, fmt.Errorf("guest %d is a %s, only VMs can be planned", g.VMID, r.Type)
+		}
+		if g.Node != "" && g.Node != r.Node {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("guest %d is on %s, not %s; migrate it with "+
+				"migrate_guest", g.VMID, r.Node, g.Node))
+		}
+
+		var conf map[string]any
+		if err := c.GetJSON(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/config", r.Node, g.VMID), &conf); err != nil {
+			return nil, err
+		}
+		steps, warnings := planGuest(g, r.Node, conf, r.Status == "running")
+		plan.Steps = append(plan.Steps, steps...)
+		plan.Warnings = append(plan.Warnings, warnings...)
+
+		if g.Pool != "" && g.Pool != r.Pool {
+			plan.Steps = append(plan.Steps, planStep{
+				Action:  "pool",
+				VMID:    g.VMID,
+				Node:    r.Node,
+				Changes: []string{fmt.Sprintf("pool: %q -> %q", r.Pool, g.Pool)},
+				Params:  map[string]string{"poolid": g.Pool},
+			})
+		}
+	}
+	return plan, nil
+}
+
+// runTaskResult waits for the task a call returned, if it returned one.
+// Some endpoints (e.g. resize on older versions) finish synchronously.
+func runTaskResult(ctx context.Context, c *ProxmoxClient, result string) error {
+	upid, err := parseUPID(result)
+	if err != nil {
+		return nil //nolint:nilerr // synchronous call, nothing to wait for
+	}
+	st, err := waitForTask(ctx, c, upid, nil)
+	if err != nil {
+		return err
+	}
+	if !st.OK() {
+		return fmt.Errorf("task %s failed: %s", upid, st.ExitStatus)
+	}
+	return nil
+}
+
+func applyPlanStep(ctx context.Context, c *ProxmoxClient, journal *configJournal, step planStep) error {
+	data := url.Values{}
+	for k, v := range step.Params {
+		data.Set(k, v)
+	}
+	if step.Digest != "" {
+		data.Set("digest", step.Digest)
+	}
+
+	meta := configChange{Tool: "apply_guest_plan", Node: step.Node, Type: "qemu", VMID: strconv.Itoa(step.VMID)}
+	var result string
+	var err error
+	switch step.Action {
+	case "create":
+		result, err = c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu", step.Node), data)
+	case "update":
+		result, err = journal.record(ctx, c, meta, func() (string, error) {
+			return c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/config", step.Node, step.VMID), data)
+		})
+	case "resize":
+		result, err = journal.record(ctx, c, meta, func() (string, error) {
+			return c.Put(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/resize", step.Node, step.VMID), data)
+		})
+	case "pool":
+		poolid := data.Get("poolid")
+		result, err = c.Put(ctx, "/pools/"+url.PathEscape(poolid),
+			url.Values{"vms": {strconv.Itoa(step.VMID)}, "allow-move": {"1"}})
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+	if err != nil {
+		return err
+	}
+	return runTaskResult(ctx, c, result)
+}
+
+// applyGuestPlan runs the steps of plan in order and stops at the first
+// failure. With reboot set, running VMs with changes that need a restart are
+// rebooted at the end.
+func applyGuestPlan(ctx context.Context, c *ProxmoxClient, journal *configJournal, plan *guestPlan,
+	reboot bool, progress progressFunc,
+) error {
+	var failed error
+	rebootVMs := map[int]string{}
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if failed != nil {
+			step.Result = "not run"
+			continue
+		}
+		progress(float64(i), float64(len(plan.Steps)), fmt.Sprintf("%s %d", step.Action, step.VMID))
+		if err := applyPlanStep(ctx, c, journal, *step); err != nil {
+			step.Result, step.Detail = "failed", err.Error()
+			failed = fmt.Errorf("%s of guest %d failed: %w", step.Action, step.VMID, err)
+			continue
+		}
+		step.Result = "ok"
+		if step.Reboot {
+			rebootVMs[step.VMID] = step.Node
+		}
+	}
+	if failed != nil || !reboot {
+		return failed
+	}
+
+	for _, vmid := range sortedVMIDs(rebootVMs) {
+		progress(float64(len(plan.Steps)), float64(len(plan.Steps)), fmt.Sprintf("reboot %d", vmid))
+		result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/status/reboot", rebootVMs[vmid], vmid), nil)
+		if err == nil {
+			err = runTaskResult(ctx, c, result)
+		}
+		if err != nil {
+			return fmt.Errorf("reboot of guest %d failed: %w", vmid, err)
+		}
+	}
+	return nil
+}
+
+func sortedVMIDs(m map[int]string) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func planResult(plan *guestPlan, applyErr error) *mcp.CallToolResult {
+	out, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	if applyErr != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("%v\n%s", applyErr, out))
+	}
+	return mcp.NewToolResultText(string(out))
+}
+
+func RegisterPlanTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen
+	s.AddTool(
+		mcp.NewTool("plan_guests",
+			mcp.WithDescription(
+				"Compare a declarative YAML or JSON spec of VMs with the live configs and save a plan of create, "+
+					"update, resize and pool steps, marking the ones that need a reboot of a running VM. Only "+
+					"fields set in the spec are managed; nothing is removed. Nothing is changed until the plan is "+
+					"run with apply_guest_plan. Spec format:\n"+
+					"guests:\n"+
+					"  - vmid: 120\n"+
+					"    name: web-1\n"+
+					"    node: pve1\n"+
+					"    cores: 2\n"+
+					"    memory: 4096\n"+
+					"    disks: {scsi0: {storage: local-lvm, size: 32G, options: \"discard=on\"}}\n"+
+					"    nics: {net0: {bridge: vmbr0, tag: 10, firewall: true}}\n"+
+					"    cloudinit: {storage: local-lvm, user: ubuntu, sshkeys: \"ssh-ed25519 ...\", "+
+					"ipconfig: {ipconfig0: \"ip=dhcp\"}}\n"+
+					"    tags: [web]\n"+
+					"    pool: prod\n"+
+					"    options: {agent: \"1\", onboot: \"1\"}",
+			),
+			mcp.WithString("spec",
+				mcp.Description("Guest spec as YAML or JSON"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			spec, err := req.RequireString("spec")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			specs, err := parseGuestSpec(spec)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			plan, err := buildGuestPlan(ctx, c, opts, specs)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			// A plan without steps is not saved and gets no ID to apply.
+			if len(plan.Steps) == 0 {
+				plan.Status = "up to date"
+				return planResult(plan, nil), nil
+			}
+			if plan.ID, err = newStateID(); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := writeStateFile(opts.StateDir, planStatePrefix+plan.ID, plan); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return planResult(plan, nil), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("apply_guest_plan",
+			mcp.WithDescription(
+				"Run a plan saved by plan_guests: the steps run in order, each waiting for its task, and stop at "+
+					"the first failure. The first change of each guest is guarded by the config digest, so a "+
+					"guest edited since the plan is refused. A plan can be applied once",
+			),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("plan_id",
+				mcp.Description("Plan ID returned by plan_guests"),
+				mcp.Required(),
+			),
+			mcp.WithString("reboot",
+				mcp.Description("Reboot running VMs whose changes need a restart: 1 or 0 (default: 0)"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the whole plan (default: 1800)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("plan_id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultApplyTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var plan guestPlan
+			if err := readStateFile(opts.StateDir, planStatePrefix+id, &plan); err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return mcp.NewToolResultError(fmt.Sprintf("no plan %s", id)), nil
+				}
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if plan.Status != "planned" {
+				return mcp.NewToolResultError(fmt.Sprintf("plan %s is already %s; create a new plan", id,
+					plan.Status)), nil
+			}
+
+			applyCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+			applyErr := applyGuestPlan(applyCtx, c, opts.journal, &plan, req.GetString("reboot", "0") == "1",
+				progressReporter(ctx, req))
+			plan.Status = "applied"
+			if applyErr != nil {
+				plan.Status = "failed"
+			}
+			plan.Applied = time.Now().UTC()
+			if err := writeStateFile(opts.StateDir, planStatePrefix+id, &plan); err != nil && applyErr == nil {
+				applyErr = err
+			}
+			return planResult(&plan, applyErr), nil
+		},
+	)
+}
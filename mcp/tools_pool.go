@@ -0,0 +1,198 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type poolInfo struct {
+	PoolID  string            `json:"poolid"`
+	Comment string            `json:"comment,omitempty"`
+	Members []json.RawMessage `json:"members"`
+}
+
+// listPoolsWithMembers fetches every pool together with its member guests and storages.
+func listPoolsWithMembers(ctx context.Context, c *ProxmoxClient) ([]poolInfo, error) {
+	var pools []poolInfo
+	if err := c.GetJSON(ctx, "/pools", &pools); err != nil {
+		return nil, err
+	}
+
+	for i := range pools {
+		var detail poolInfo
+		if err := c.GetJSON(ctx, "/pools/"+url.PathEscape(pools[i].PoolID), &detail); err != nil {
+			return nil, err
+		}
+		pools[i].Members = detail.Members
+		if pools[i].Members == nil {
+			pools[i].Members = []json.RawMessage{}
+		}
+	}
+	return pools, nil
+}
+
+// poolMemberParams builds the vms/storage parameters for a pool membership update.
+func poolMemberParams(req mcp.CallToolRequest) (url.Values, error) {
+	data := url.Values{}
+	if v := req.GetString("vms", ""); v != "" {
+		data.Set("vms", v)
+	}
+	if v := req.GetString("storage", ""); v != "" {
+		data.Set("storage", v)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("at least one of vms or storage must be provided")
+	}
+	return data, nil
+}
+
+func RegisterPoolTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
+	s.AddTool(
+		mcp.NewTool("list_pools",
+			mcp.WithDescription("List resource pools with their member guests and storages"),
+		),
+		func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			pools, err := listPoolsWithMembers(ctx, c)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			out, err := json.MarshalIndent(pools, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("create_pool",
+			mcp.WithDescription("Create a resource pool"),
+			mcp.WithString("poolid",
+				mcp.Description("Pool ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("comment",
+				mcp.Description("Comment"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			poolid, err := req.RequireString("poolid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			data.Set("poolid", poolid)
+			if v := req.GetString("comment", ""); v != "" {
+				data.Set("comment", v)
+			}
+
+			result, err := c.Post(ctx, "/pools", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_pool",
+			mcp.WithDescription("Delete a resource pool (must have no members)"),
+			mcp.WithString("poolid",
+				mcp.Description("Pool ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			poolid, err := req.RequireString("poolid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/pools/"+url.PathEscape(poolid), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("add_pool_members",
+			mcp.WithDescription("Add guests and/or storages to a resource pool"),
+			mcp.WithString("poolid",
+				mcp.Description("Pool ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("vms",
+				mcp.Description("Comma-separated list of VM/container IDs"),
+			),
+			mcp.WithString("storage",
+				mcp.Description("Comma-separated list of storage IDs"),
+			),
+			mcp.WithString("allow_move",
+				mcp.Description("Move guests that already belong to another pool: 1 or 0 (default: 0)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			poolid, err := req.RequireString("poolid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := poolMemberParams(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if v := req.GetString("allow_move", ""); v != "" {
+				data.Set("allow-move", v)
+			}
+
+			result, err := c.Put(ctx, "/pools/"+url.PathEscape(poolid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("remove_pool_members",
+			mcp.WithDescription("Remove guests and/or storages from a resource pool"),
+			mcp.WithString("poolid",
+				mcp.Description("Pool ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("vms",
+				mcp.Description("Comma-separated list of VM/container IDs"),
+			),
+			mcp.WithString("storage",
+				mcp.Description("Comma-separated list of storage IDs"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			poolid, err := req.RequireString("poolid")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data, err := poolMemberParams(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data.Set("delete", "1")
+
+			result, err := c.Put(ctx, "/pools/"+url.PathEscape(poolid), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
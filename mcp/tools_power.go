@@ -0,0 +1,342 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// qemuKeyRe matches QEMU key names and combinations (e.g. ctrl-alt-delete, f2).
+var qemuKeyRe = regexp.MustCompile(`^[a-z0-9_]+(-[a-z0-9_]+)*$`)
+
+const (
+	defaultShutdownTimeout = 180
+	// powerTaskGrace is added to the shutdown timeout when waiting for the
+	// task, leaving time for the forced stop.
+	powerTaskGrace = 60 * time.Second
+	// defaultPowerWait bounds waiting for tasks without a timeout parameter.
+	defaultPowerWait = 5 * time.Minute
+)
+
+// powerTarget is the guest a power action applies to.
+type powerTarget struct {
+	node      string
+	vmid      string
+	guestType string
+}
+
+func powerTargetFromRequest(req mcp.CallToolRequest) (powerTarget, error) {
+	node, err := req.RequireString("node")
+	if err != nil {
+		return powerTarget{}, err
+	}
+	vmid, err := req.RequireString("vmid")
+	if err != nil {
+		return powerTarget{}, err
+	}
+	t := powerTarget{node: node, vmid: vmid, guestType: req.GetString("type", "qemu")}
+	if t.guestType != "qemu" && t.guestType != "lxc" {
+		return powerTarget{}, fmt.Errorf("unsupported guest type %q", t.guestType)
+	}
+	return t, nil
+}
+
+func (t powerTarget) path(endpoint string) string {
+	return fmt.Sprintf("/nodes/%s/%s/%s/%s", t.node, t.guestType, t.vmid, endpoint)
+}
+
+// powerState is the result of a power action: the task outcome and the
+// guest state after the task finished.
+type powerState struct {
+	VMID       string `json:"vmid"`
+	Action     string `json:"action"`
+	Task       string `json:"task,omitempty"`
+	ExitStatus string `json:"exitstatus,omitempty"`
+	Status     string `json:"status"`
+	QMPStatus  string `json:"qmpstatus,omitempty"`
+	Lock       string `json:"lock,omitempty"`
+}
+
+func guestPowerState(ctx context.Context, c *ProxmoxClient, t powerTarget, action string) (powerState, error) {
+	var current struct {
+		Status    string `json:"status"`
+		QMPStatus string `json:"qmpstatus"`
+		Lock      string `json:"lock"`
+	}
+	if err := c.GetJSON(ctx, t.path("status/current"), &current); err != nil {
+		return powerState{}, err
+	}
+	return powerState{
+		VMID:      t.vmid,
+		Action:    action,
+		Status:    current.Status,
+		QMPStatus: current.QMPStatus,
+		Lock:      current.Lock,
+	}, nil
+}
+
+// runPowerAction starts the status/{action} task, waits up to wait for it to
+// finish and returns the resulting power state.
+func runPowerAction(ctx context.Context, c *ProxmoxClient, t powerTarget, action string, data url.Values,
+	wait time.Duration,
+) *mcp.CallToolResult {
+	result, err := c.Post(ctx, t.path("status/"+action), data)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	upid, err := parseUPID(result)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	st, err := waitForTask(waitCtx, c, upid, nil)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	state, err := guestPowerState(ctx, c, t, action)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	state.Task = upid
+	state.ExitStatus = st.ExitStatus
+
+	out, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	if !st.OK() {
+		return mcp.NewToolResultError(fmt.Sprintf("%s failed: %s\n%s", action, st.ExitStatus, out))
+	}
+	return mcp.NewToolResultText(string(out))
+}
+
+func powerToolOptions(description string, extra ...mcp.ToolOption) []mcp.ToolOption {
+	return append([]mcp.ToolOption{
+		mcp.WithDescription(description),
+		mcp.WithString("node",
+			mcp.Description("Node name"),
+			mcp.Required(),
+		),
+		mcp.WithString("vmid",
+			mcp.Description("VM/container ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("type",
+			mcp.Description("Guest type: qemu or lxc (default: qemu)"),
+		),
+	}, extra...)
+}
+
+func positiveSeconds(req mcp.CallToolRequest, name string, def int) (int, error) {
+	v, err := strconv.Atoi(req.GetString(name, strconv.Itoa(def)))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of seconds", name)
+	}
+	return v, nil
+}
+
+func RegisterPowerTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("shutdown_guest",
+			powerToolOptions(
+				"Shut down a VM (ACPI or guest agent) or container cleanly, stopping it forcefully if it is still "+
+					"running after the timeout unless force_stop=0. Returns the power state after the task",
+				mcp.WithString("timeout",
+					mcp.Description("Seconds to wait for the clean shutdown (default: 180)"),
+				),
+				mcp.WithString("force_stop",
+					mcp.Description("Stop the guest if it did not shut down within the timeout: 1 or 0 (default: 1)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultShutdownTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			forceStop := req.GetString("force_stop", "1")
+			if forceStop != "0" && forceStop != "1" {
+				return mcp.NewToolResultError("force_stop must be 1 or 0"), nil
+			}
+
+			data := url.Values{"timeout": {strconv.Itoa(timeout)}, "forceStop": {forceStop}}
+			wait := time.Duration(timeout)*time.Second + powerTaskGrace
+			return runPowerAction(ctx, c, t, "shutdown", data, wait), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("reboot_guest",
+			powerToolOptions(
+				"Reboot a VM or container by shutting it down cleanly and starting it again. Returns the power "+
+					"state after the task",
+				mcp.WithString("timeout",
+					mcp.Description("Seconds to wait for the shutdown before giving up (default: 180)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", defaultShutdownTimeout)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := url.Values{"timeout": {strconv.Itoa(timeout)}}
+			wait := time.Duration(timeout)*time.Second + powerTaskGrace
+			return runPowerAction(ctx, c, t, "reboot", data, wait), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("reset_guest",
+			powerToolOptions(
+				"Hard-reset a VM like pressing its reset button; unsaved data in the guest is lost. Not available "+
+					"for containers. Returns the power state after the task",
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if t.guestType != "qemu" {
+				return mcp.NewToolResultError("reset is only supported for VMs"), nil
+			}
+			return runPowerAction(ctx, c, t, "reset", nil, defaultPowerWait), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("suspend_guest",
+			powerToolOptions(
+				"Pause a VM in memory, or freeze a container. Returns the power state after the task",
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return runPowerAction(ctx, c, t, "suspend", nil, defaultPowerWait), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("hibernate_guest",
+			powerToolOptions(
+				"Hibernate a VM: save its RAM to a state volume and stop it. start_guest resumes it from the saved "+
+					"state. Not available for containers. Returns the power state after the task",
+				mcp.WithString("statestorage",
+					mcp.Description("Storage for the VM state volume (default: the storage of the first disk)"),
+				),
+				mcp.WithString("timeout",
+					mcp.Description("Seconds to wait for the RAM to be saved (default: 600)"),
+				),
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if t.guestType != "qemu" {
+				return mcp.NewToolResultError("hibernate is only supported for VMs"), nil
+			}
+			timeout, err := positiveSeconds(req, "timeout", 600)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data := url.Values{"todisk": {"1"}}
+			if v := req.GetString("statestorage", ""); v != "" {
+				data.Set("statestorage", v)
+			}
+			return runPowerAction(ctx, c, t, "suspend", data, time.Duration(timeout)*time.Second), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("resume_guest",
+			powerToolOptions(
+				"Resume a VM paused with suspend_guest, or thaw a frozen container. Hibernated VMs are resumed "+
+					"with start_guest. Returns the power state after the task",
+			)...,
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return runPowerAction(ctx, c, t, "resume", nil, defaultPowerWait), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("send_guest_key",
+			mcp.WithDescription(
+				"Send a key or key combination to the console of a VM, e.g. ctrl-alt-delete for a hung login "+
+					"screen. Returns the power state",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("vmid",
+				mcp.Description("VM ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("key",
+				mcp.Description("QEMU key name or combination joined by '-', e.g. ctrl-alt-delete, ret, esc, f2"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			t, err := powerTargetFromRequest(req)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if t.guestType != "qemu" {
+				return mcp.NewToolResultError("send key is only supported for VMs"), nil
+			}
+			key, err := req.RequireString("key")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if !qemuKeyRe.MatchString(key) {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid key %q", key)), nil
+			}
+
+			if _, err := c.Put(ctx, t.path("sendkey"), url.Values{"key": {key}}); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			state, err := guestPowerState(ctx, c, t, "sendkey")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			out, err := json.MarshalIndent(state, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(out)), nil
+		},
+	)
+}
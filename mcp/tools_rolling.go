@@ -0,0 +1,708 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	rollingStatePrefix    = "rolling-"
+	defaultGateTimeout    = 1800
+	defaultRebootTimeout  = 1200
+	defaultUpgradeTimeout = 1800
+	// rollingPollInterval is how often health gates and rebooting nodes are
+	// checked.
+	rollingPollInterval = 10 * time.Second
+)
+
+// Steps of a rolling update, run for each node in this order. The check step
+// runs once more after the last node.
+const (
+	rollingStepCheck   = "check"
+	rollingStepDrain   = "drain"
+	rollingStepUpgrade = "upgrade"
+	rollingStepReboot  = "reboot"
+	rollingStepWait    = "wait"
+	rollingStepUndrain = "undrain"
+	rollingStepDone    = "done"
+)
+
+// Statuses of a rolling update.
+const (
+	rollingRunning   = "running"
+	rollingPaused    = "paused"
+	rollingCompleted = "completed"
+	rollingCancelled = "cancelled"
+)
+
+type rollingEvent struct {
+	Time    time.Time `json:"time"`
+	Node    string    `json:"node,omitempty"`
+	Step    string    `json:"step"`
+	Message string    `json:"message"`
+}
+
+// rollingUpdate is the persisted state of a rolling update. It is saved after
+// every step, so a paused or interrupted update resumes where it stopped.
+type rollingUpdate struct {
+	ID              string         `json:"id"`
+	Status          string         `json:"status"`
+	Error           string         `json:"error,omitempty"`
+	Created         time.Time      `json:"created"`
+	Updated         time.Time      `json:"updated"`
+	Nodes           []string       `json:"nodes"`
+	Upgrade         bool           `json:"upgrade"`
+	Reboot          bool           `json:"reboot"`
+	CephGate        bool           `json:"ceph_gate"`
+	Parallel        int            `json:"parallel"`
+	DrainTimeout    int            `json:"drain_timeout"`
+	UpgradeTimeout  int            `json:"upgrade_timeout"`
+	RebootTimeout   int            `json:"reboot_timeout"`
+	GateTimeout     int            `json:"gate_timeout"`
+	Current         int            `json:"current"`
+	Step            string         `json:"step"`
+	RebootRequested time.Time      `json:"reboot_requested,omitzero"`
+	Progress        string         `json:"progress,omitempty"`
+	Events          []rollingEvent `json:"events"`
+}
+
+func (u *rollingUpdate) currentNode() string {
+	if u.Current < len(u.Nodes) {
+		return u.Nodes[u.Current]
+	}
+	return ""
+}
+
+func (u *rollingUpdate) steps() []string {
+	steps := []string{rollingStepCheck, rollingStepDrain}
+	if u.Upgrade {
+		steps = append(steps, rollingStepUpgrade)
+	}
+	if u.Reboot {
+		steps = append(steps, rollingStepReboot, rollingStepWait)
+	}
+	return append(steps, rollingStepUndrain)
+}
+
+// advance moves to the next step, or to the next node after the last step.
+func (u *rollingUpdate) advance() {
+	steps := u.steps()
+	i := slices.Index(steps, u.Step)
+	if u.Current < len(u.Nodes) && i+1 < len(steps) {
+		u.Step = steps[i+1]
+		return
+	}
+	u.Current++
+	u.Step = rollingStepCheck
+	if u.Current > len(u.Nodes) {
+		u.Step = rollingStepDone
+	}
+}
+
+func (u *rollingUpdate) event(step, message string) {
+	u.Events = append(u.Events, rollingEvent{
+		Time: time.Now().UTC(), Node: u.currentNode(), Step: step, Message: message,
+	})
+}
+
+// haStatusEntry is an entry of /cluster/ha/status/current.
+type haStatusEntry struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+// checkClusterHealth returns the reasons the cluster is not healthy: quorum
+// lost or nodes offline, Ceph not HEALTH_OK (when cephGate is set), or an
+// inactive HA manager while HA resources are configured.
+func checkClusterHealth(ctx context.Context, c *ProxmoxClient, cephGate bool) ([]string, error) {
+	var members []struct {
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Quorate int    `json:"quorate"`
+		Online  int    `json:"online"`
+	}
+	if err := c.GetJSON(ctx, "/cluster/status", &members); err != nil {
+		return nil, err
+	}
+	var problems []string
+	for _, m := range members {
+		switch {
+		case m.Type == "cluster" && m.Quorate != 1:
+			problems = append(problems, "cluster is not quorate")
+		case m.Type == "node" && m.Online != 1:
+			problems = append(problems, "node "+m.Name+" is offline")
+		}
+	}
+
+	if cephGate {
+		var ceph cephStatus
+		if err := c.GetJSON(ctx, "/cluster/ceph/status", &ceph); err != nil {
+			return nil, err
+		}
+		if ceph.Health.Status != "HEALTH_OK" {
+			problems = append(problems, "Ceph health is "+ceph.Health.Status)
+		}
+	}
+
+	var ha []haStatusEntry
+	if err := c.GetJSON(ctx, "/cluster/ha/status/current", &ha); err != nil {
+		return nil, err
+	}
+	if slices.ContainsFunc(ha, func(e haStatusEntry) bool { return e.Type == "service" }) {
+		master := slices.IndexFunc(ha, func(e haStatusEntry) bool { return e.Type == "master" })
+		switch {
+		case master < 0:
+			problems = append(problems, "HA manager has no master")
+		case !strings.Contains(ha[master].Status, "active"):
+			problems = append(problems, "HA manager is not active: "+ha[master].Status)
+		}
+		for _, e := range ha {
+			if e.Type == "quorum" && e.Status != "OK" {
+				problems = append(problems, "HA quorum: "+e.Status)
+			}
+		}
+	}
+	return problems, nil
+}
+
+// waitForClusterHealth waits until checkClusterHealth finds no problems. API
+// errors count as problems, since the API may be unavailable while a node
+// reboots.
+func waitForClusterHealth(ctx context.Context, c *ProxmoxClient, cephGate bool, timeout time.Duration,
+	progress progressFunc,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		problems, err := checkClusterHealth(ctx, c, cephGate)
+		if err != nil {
+			problems = []string{err.Error()}
+		}
+		if len(problems) == 0 {
+			return nil
+		}
+		progress(0, 0, "waiting for cluster health: "+strings.Join(problems, "; "))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("cluster not healthy after %s: %s", timeout, strings.Join(problems, "; "))
+		case <-time.After(rollingPollInterval):
+		}
+	}
+}
+
+// waitForNodeBoot waits until node is back with an uptime shorter than the
+// time since the reboot was requested.
+func waitForNodeBoot(ctx context.Context, c *ProxmoxClient, node string, requested time.Time,
+	timeout time.Duration, progress progressFunc,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		var st struct {
+			Uptime int64 `json:"uptime"`
+		}
+		err := c.GetJSON(ctx, "/nodes/"+node+"/status", &st)
+		if err == nil && time.Duration(st.Uptime)*time.Second <= time.Since(requested) {
+			return nil
+		}
+		progress(0, 0, "waiting for "+node+" to boot")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("node %s did not come back within %s", node, timeout)
+		case <-time.After(rollingPollInterval):
+		}
+	}
+}
+
+// rollingManager runs rolling updates in the background, detached from the
+// tool call that started them, and keeps track of the ones running in this
+// process.
+type rollingManager struct {
+	c    *ProxmoxClient
+	opts Options
+
+	mu     sync.Mutex
+	active map[string]string // ID -> requested stop status, "" while running
+}
+
+func (m *rollingManager) load(id string) (*rollingUpdate, error) {
+	var u rollingUpdate
+	if err := readStateFile(m.opts.StateDir, rollingStatePrefix+id, &u); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no rolling update %s", id)
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (m *rollingManager) save(u *rollingUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u.Updated = time.Now().UTC()
+	return writeStateFile(m.opts.StateDir, rollingStatePrefix+u.ID, u)
+}
+
+func (m *rollingManager) list() ([]*rollingUpdate, error) {
+	names, err := listStateFiles(m.opts.StateDir, rollingStatePrefix)
+	if err != nil {
+		return nil, err
+	}
+	updates := make([]*rollingUpdate, 0, len(names))
+	for _, name := range names {
+		u, err := m.load(strings.TrimPrefix(name, rollingStatePrefix))
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, u)
+	}
+	return updates, nil
+}
+
+// start runs u in the background unless it is already running in this
+// process.
+func (m *rollingManager) start(ctx context.Context, u *rollingUpdate) error {
+	m.mu.Lock()
+	if _, ok := m.active[u.ID]; ok {
+		m.mu.Unlock()
+		return fmt.Errorf("rolling update %s is already running", u.ID)
+	}
+	m.active[u.ID] = ""
+	m.mu.Unlock()
+
+	u.Status = rollingRunning
+	u.Error = ""
+	if err := m.save(u); err != nil {
+		m.finish(u.ID)
+		return err
+	}
+	go m.run(context.WithoutCancel(ctx), u)
+	return nil
+}
+
+// requestStop asks a running update to stop with status after its current
+// step. It reports false when the update is not running in this process.
+func (m *rollingManager) requestStop(id, status string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.active[id]; !ok {
+		return false
+	}
+	m.active[id] = status
+	return true
+}
+
+func (m *rollingManager) stopRequested(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active[id]
+}
+
+func (m *rollingManager) finish(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.active, id)
+}
+
+func (m *rollingManager) run(ctx context.Context, u *rollingUpdate) {
+	defer m.finish(u.ID)
+	progress := func(_, _ float64, message string) {
+		u.Progress = message
+		_ = m.save(u)
+	}
+
+	for u.Step != rollingStepDone {
+		if stop := m.stopRequested(u.ID); stop != "" {
+			u.Status = stop
+			u.event(u.Step, "stopped on request before this step")
+			_ = m.save(u)
+			return
+		}
+		step := u.Step
+		message, err := m.runStep(ctx, u, progress)
+		u.Progress = ""
+		if err != nil {
+			u.Status = rollingPaused
+			u.Error = fmt.Sprintf("%s step failed: %v", step, err)
+			u.event(step, "failed: "+err.Error())
+			_ = m.save(u)
+			return
+		}
+		u.event(step, message)
+		u.advance()
+		_ = m.save(u)
+	}
+	u.Status = rollingCompleted
+	_ = m.save(u)
+}
+
+// runStep runs the current step of u and returns a short summary.
+func (m *rollingManager) runStep(ctx context.Context, u *rollingUpdate, //nolint:gocognit
+	progress progressFunc,
+) (string, error) {
+	node := u.currentNode()
+	switch u.Step {
+	case rollingStepCheck:
+		err := waitForClusterHealth(ctx, m.c, u.CephGate, time.Duration(u.GateTimeout)*time.Second, progress)
+		return "cluster healthy", err
+
+	case rollingStepDrain:
+		rec, err := drainNode(ctx, m.c, m.opts, drainParams{
+			node:          node,
+			parallel:      u.Parallel,
+			timeout:       time.Duration(u.DrainTimeout) * time.Second,
+			haMaintenance: true,
+			resume:        true,
+		}, progress)
+		if err != nil {
+			return "", err
+		}
+		var failed []string
+		for _, g := range rec.Guests {
+			if g.Result != "ok" {
+				failed = append(failed, fmt.Sprintf("%d (%s)", g.VMID, g.Detail))
+			}
+		}
+		if len(failed) > 0 {
+			return "", fmt.Errorf("guests still on %s: %s", node, strings.Join(failed, ", "))
+		}
+		return fmt.Sprintf("moved %d guests off the node", len(rec.Guests)), nil
+
+	case rollingStepUpgrade:
+		res, err := upgradeNode(ctx, m.c, node, time.Duration(u.UpgradeTimeout)*time.Second)
+		if err != nil {
+			return "", err
+		}
+		lines := strings.Split(strings.TrimSpace(res.Output), "\n")
+		last := lines[len(lines)-1]
+		if res.TimedOut || res.ExitCode != 0 {
+			return "", fmt.Errorf("upgrade did not complete (exit code %d, timed out: %t): %s",
+				res.ExitCode, res.TimedOut, last)
+		}
+		return last, nil
+
+	case rollingStepReboot:
+		u.RebootRequested = time.Now().UTC()
+		if _, err := m.c.Post(ctx, "/nodes/"+node+"/status", url.Values{"command": {"reboot"}}); err != nil {
+			return "", err
+		}
+		return "reboot requested", nil
+
+	case rollingStepWait:
+		if err := waitForNodeBoot(ctx, m.c, node, u.RebootRequested, time.Duration(u.RebootTimeout)*time.Second,
+			progress); err != nil {
+			return "", err
+		}
+		err := waitForClusterHealth(ctx, m.c, u.CephGate, time.Duration(u.GateTimeout)*time.Second, progress)
+		return "node back and cluster healthy", err
+
+	case rollingStepUndrain:
+		report, err := undrainNode(ctx, m.c, m.opts, node, u.Parallel, time.Duration(u.DrainTimeout)*time.Second,
+			progress)
+		if err != nil {
+			return "", err
+		}
+		if !report.RecordRemoved {
+			return "", fmt.Errorf("some guests could not be moved back to %s; see undrain_node", node)
+		}
+		return fmt.Sprintf("moved %d guests back", len(report.Results)), nil
+	}
+	return "", fmt.Errorf("unknown step %q", u.Step)
+}
+
+// usesCeph reports whether the cluster has Ceph storage, which enables the
+// Ceph health gate.
+func usesCeph(ctx context.Context, c *ProxmoxClient) (bool, error) {
+	var storages []struct {
+		Type string `json:"type"`
+	}
+	if err := c.GetJSON(ctx, "/storage", &storages); err != nil {
+		return false, err
+	}
+	for _, s := range storages {
+		if s.Type == "rbd" || s.Type == "cephfs" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func rollingResult(u *rollingUpdate) *mcp.CallToolResult {
+	out, err := json.MarshalIndent(u, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return mcp.NewToolResultText(string(out))
+}
+
+func RegisterRollingTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	// Every node is upgraded through the node shell, so the rolling update is
+	// an elevated tool like upgrade_node.
+	if !opts.AllowElevated {
+		return
+	}
+	m := &rollingManager{c: c, opts: opts, active: map[string]string{}}
+
+	s.AddTool(
+		mcp.NewTool("start_rolling_update",
+			mcp.WithDescription(
+				"[elevated] Upgrade and reboot cluster nodes one at a time in the background: check cluster "+
+					"health, drain the node (see drain_node), apt-get dist-upgrade, reboot, wait for it to rejoin "+
+					"the quorum, move the guests back. Health gates before and after each node require quorum, "+
+					"Ceph HEALTH_OK (when Ceph storage is configured) and an active HA manager. Any failure pauses "+
+					"the update; it is saved in state_dir and can be followed with get_rolling_update and continued "+
+					"with resume_rolling_update. Returns the update ID. Requires a root@pam API token",
+			),
+			mcp.WithArray("nodes",
+				mcp.Description("Nodes in the order to update (default: all nodes, sorted by name)"),
+				mcp.WithStringItems(),
+			),
+			mcp.WithString("upgrade",
+				mcp.Description("Install package updates: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("reboot",
+				mcp.Description("Reboot each node: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("parallel",
+				mcp.Description("Number of migrations run in parallel while draining (default: 2, max: 16)"),
+			),
+			mcp.WithString("drain_timeout",
+				mcp.Description("Seconds to wait for a node to be drained or filled again (default: 3600)"),
+			),
+			mcp.WithString("upgrade_timeout",
+				mcp.Description("Seconds to wait for the upgrade of a node (default: 1800)"),
+			),
+			mcp.WithString("reboot_timeout",
+				mcp.Description("Seconds to wait for a node to come back after the reboot (default: 1200)"),
+			),
+			mcp.WithString("gate_timeout",
+				mcp.Description("Seconds to wait for the cluster to become healthy at a gate (default: 1800)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			parallel, err := strconv.Atoi(req.GetString("parallel", strconv.Itoa(defaultDrainParallel)))
+			if err != nil || parallel < 1 || parallel > maxBulkConcurrency {
+				return mcp.NewToolResultError(fmt.Sprintf("parallel must be between 1 and %d", maxBulkConcurrency)), nil
+			}
+			timeouts := map[string]int{
+				"drain_timeout":   defaultDrainTimeout,
+				"upgrade_timeout": defaultUpgradeTimeout,
+				"reboot_timeout":  defaultRebootTimeout,
+				"gate_timeout":    defaultGateTimeout,
+			}
+			for name, def := range timeouts {
+				if timeouts[name], err = positiveSeconds(req, name, def); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+			}
+			if len(opts.AllowedPools) > 0 {
+				return mcp.NewToolResultError(errDrainPoolScoped.Error()), nil
+			}
+
+			existing, err := m.list()
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			for _, u := range existing {
+				if u.Status == rollingRunning || u.Status == rollingPaused {
+					return mcp.NewToolResultError(fmt.Sprintf("rolling update %s is %s; resume or cancel it first",
+						u.ID, u.Status)), nil
+				}
+			}
+
+			var all []nodeCapacity
+			if err := c.GetJSON(ctx, "/nodes", &all); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			known := make([]string, 0, len(all))
+			for _, n := range all {
+				known = append(known, n.Node)
+			}
+			slices.Sort(known)
+			nodes := req.GetStringSlice("nodes", known)
+			if len(nodes) == 0 {
+				return mcp.NewToolResultError("no nodes to update"), nil
+			}
+			for _, n := range nodes {
+				if !slices.Contains(known, n) {
+					return mcp.NewToolResultError(fmt.Sprintf("unknown node %q", n)), nil
+				}
+			}
+			ceph, err := usesCeph(ctx, c)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			id, err := newStateID()
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			u := &rollingUpdate{
+				ID:             id,
+				Created:        time.Now().UTC(),
+				Nodes:          nodes,
+				Upgrade:        req.GetString("upgrade", "1") == "1",
+				Reboot:         req.GetString("reboot", "1") == "1",
+				CephGate:       ceph,
+				Parallel:       parallel,
+				DrainTimeout:   timeouts["drain_timeout"],
+				UpgradeTimeout: timeouts["upgrade_timeout"],
+				RebootTimeout:  timeouts["reboot_timeout"],
+				GateTimeout:    timeouts["gate_timeout"],
+				Step:           rollingStepCheck,
+				Events:         []rollingEvent{},
+			}
+			if err := m.start(ctx, u); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Rolling update %s started for %s\n", id,
+				strings.Join(nodes, ", "))), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_rolling_update",
+			mcp.WithDescription(
+				"[elevated] Get the state of a rolling update: status (running, paused, completed or cancelled), "+
+					"current node and step, the error that paused it and the log of finished steps",
+			),
+			mcp.WithString("id",
+				mcp.Description("Rolling update ID"),
+				mcp.Required(),
+			),
+		),
+		func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			u, err := m.load(id)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return rollingResult(u), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("list_rolling_updates",
+			mcp.WithDescription("[elevated] List the rolling updates saved in state_dir with their status"),
+		),
+		func(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			updates, err := m.list()
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			type summary struct {
+				ID      string    `json:"id"`
+				Status  string    `json:"status"`
+				Node    string    `json:"node,omitempty"`
+				Step    string    `json:"step"`
+				Nodes   []string  `json:"nodes"`
+				Updated time.Time `json:"updated"`
+			}
+			out := make([]summary, 0, len(updates))
+			for _, u := range updates {
+				out = append(out, summary{u.ID, u.Status, u.currentNode(), u.Step, u.Nodes, u.Updated})
+			}
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(string(data)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("resume_rolling_update",
+			mcp.WithDescription(
+				"[elevated] Continue a paused rolling update, or one interrupted by a server restart, from the "+
+					"step that failed",
+			),
+			mcp.WithString("id",
+				mcp.Description("Rolling update ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := req.RequireString("id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			u, err := m.load(id)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if u.Status != rollingPaused && u.Status != rollingRunning {
+				return mcp.NewToolResultError(fmt.Sprintf("rolling update %s is %s", id, u.Status)), nil
+			}
+			u.event(u.Step, "resumed")
+			if err := m.start(ctx, u); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("Rolling update %s resumed at step %s of %s\n", id, u.Step,
+				u.currentNode())), nil
+		},
+	)
+
+	for _, stop := range []struct{ name, status, description string }{
+		{"pause_rolling_update", rollingPaused,
+			"[elevated] Pause a rolling update after its current step; resume it with resume_rolling_update"},
+		{"cancel_rolling_update", rollingCancelled,
+			"[elevated] Cancel a rolling update after its current step. A drained node stays drained; use " +
+				"undrain_node to move its guests back"},
+	} {
+		s.AddTool(
+			mcp.NewTool(stop.name,
+				mcp.WithDescription(stop.description),
+				mcp.WithString("id",
+					mcp.Description("Rolling update ID"),
+					mcp.Required(),
+				),
+			),
+			func(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				id, err := req.RequireString("id")
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				u, err := m.load(id)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if u.Status == rollingCompleted || u.Status == rollingCancelled {
+					return mcp.NewToolResultError(fmt.Sprintf("rolling update %s is %s", id, u.Status)), nil
+				}
+				if m.requestStop(id, stop.status) {
+					return mcp.NewToolResultText(fmt.Sprintf("Rolling update %s will be %s after the %s step\n",
+						id, stop.status, u.Step)), nil
+				}
+				if stop.status == rollingPaused && u.Status == rollingPaused {
+					return mcp.NewToolResultText(fmt.Sprintf("Rolling update %s is already paused\n", id)), nil
+				}
+				u.Status = stop.status
+				u.event(u.Step, stop.status+" on request")
+				if err := m.save(u); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				return rollingResult(u), nil
+			},
+		)
+	}
+}
@@ -7,12 +7,98 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func RegisterStorageTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen
+// splitVolumeID splits a volume ID ("local:iso/debian.iso") into its storage
+// and volume name.
+func splitVolumeID(volid string) (string, string, error) {
+	storage, name, found := strings.Cut(volid, ":")
+	if !found || storage == "" || name == "" {
+		return "", "", fmt.Errorf("invalid volume ID %q, expected <storage>:<volume>", volid)
+	}
+	return storage, name, nil
+}
+
+// configReferencesVolume reports whether a guest config value refers to the
+// volume. Linked clones reference their base volume as "base/child".
+func configReferencesVolume(value, storage, name string) bool {
+	spec, _, _ := strings.Cut(value, ",")
+	s, n, found := strings.Cut(spec, ":")
+	if !found || s != storage {
+		return false
+	}
+	return n == name || strings.HasPrefix(n, name+"/") || strings.HasSuffix(n, "/"+name)
+}
+
+// volumeReferences lists the guest config keys ("qemu/100 scsi0") that still
+// use the volume, in the current config, in pending changes ("qemu/100 scsi1
+// (pending)") or in a snapshot ("qemu/100 scsi0 (snapshot pre-upgrade)").
+func volumeReferences(ctx context.Context, c *ProxmoxClient, volid string) ([]string, error) { //nolint:gocognit
+	storage, name, err := splitVolumeID(volid)
+	if err != nil {
+		return nil, err
+	}
+
+	var guests []clusterResource
+	if err := c.GetJSON(ctx, "/cluster/resources?type=vm", &guests); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, g := range guests {
+		base := guestConfigPath(g)
+		addRefs := func(conf map[string]any, suffix string) {
+			for key, v := range conf {
+				if value, ok := v.(string); ok && configReferencesVolume(value, storage, name) {
+					refs = append(refs, fmt.Sprintf("%s/%d %s%s", g.Type, g.VMID, key, suffix))
+				}
+			}
+		}
+
+		var conf map[string]any
+		if err := c.GetJSON(ctx, base+"/config", &conf); err != nil {
+			return nil, fmt.Errorf("reading config of %s/%d: %w", g.Type, g.VMID, err)
+		}
+		addRefs(conf, "")
+
+		var pending []map[string]any
+		if err := c.GetJSON(ctx, base+"/pending", &pending); err != nil {
+			return nil, fmt.Errorf("reading pending changes of %s/%d: %w", g.Type, g.VMID, err)
+		}
+		for _, p := range pending {
+			if _, ok := p["pending"]; ok {
+				addRefs(map[string]any{configString(p, "key"): p["pending"]}, " (pending)")
+			}
+		}
+
+		var snapshots []struct {
+			Name string `json:"name"`
+		}
+		if err := c.GetJSON(ctx, base+"/snapshot", &snapshots); err != nil {
+			return nil, fmt.Errorf("reading snapshots of %s/%d: %w", g.Type, g.VMID, err)
+		}
+		for _, snap := range snapshots {
+			if snap.Name == "current" {
+				continue
+			}
+			var snapConf map[string]any
+			path := fmt.Sprintf("%s/snapshot/%s/config", base, url.PathEscape(snap.Name))
+			if err := c.GetJSON(ctx, path, &snapConf); err != nil {
+				return nil, fmt.Errorf("reading snapshot %s of %s/%d: %w", snap.Name, g.Type, g.VMID, err)
+			}
+			addRefs(snapConf, " (snapshot "+snap.Name+")")
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+func RegisterStorageTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
 	s.AddTool(
 		mcp.NewTool("list_storage",
 			mcp.WithDescription("List storage pools on a node"),
@@ -127,4 +213,142 @@ func RegisterStorageTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funl
 			return mcp.NewToolResultText(result), nil
 		},
 	)
+
+	s.AddTool(
+		mcp.NewTool("get_volume",
+			mcp.WithDescription("Get the details of a storage volume: path, size, usage, format, notes and protection"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("volume",
+				mcp.Description("Volume ID (e.g. local:backup/vzdump-qemu-100-2025_01_01-00_00_00.vma.zst)"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			volume, err := req.RequireString("volume")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, _, err := splitVolumeID(volume)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/storage/%s/content/%s", node, storage, url.PathEscape(volume))
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("update_volume",
+			mcp.WithDescription("Set the notes or the protection flag of a backup volume"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("volume",
+				mcp.Description("Volume ID"),
+				mcp.Required(),
+			),
+			mcp.WithString("notes",
+				mcp.Description("Notes shown for the backup"),
+			),
+			mcp.WithString("protected",
+				mcp.Description("Protect the backup from pruning and removal: 1 or 0"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			volume, err := req.RequireString("volume")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, _, err := splitVolumeID(volume)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{}
+			args := req.GetArguments()
+			if v, ok := args["notes"].(string); ok {
+				// Empty notes are sent as well, to clear them.
+				data.Set("notes", v)
+			}
+			if v := req.GetString("protected", ""); v != "" {
+				data.Set("protected", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("one of notes or protected is required"), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/storage/%s/content/%s", node, storage, url.PathEscape(volume))
+			result, err := c.Put(ctx, path, data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_volume",
+			mcp.WithDescription(
+				"Delete a storage volume (backup, ISO, template or disk image). Refused while any guest config, "+
+					"pending change or snapshot still references the volume",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("volume",
+				mcp.Description("Volume ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			volume, err := req.RequireString("volume")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, _, err := splitVolumeID(volume)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			refs, err := volumeReferences(ctx, c, volume)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("checking volume references: %v", err)), nil
+			}
+			if len(refs) > 0 {
+				return mcp.NewToolResultError(fmt.Sprintf(
+					"volume %s is still referenced by %s; detach it from the guest first",
+					volume, strings.Join(refs, ", "),
+				)), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/storage/%s/content/%s", node, storage, url.PathEscape(volume))
+			result, err := c.Delete(ctx, path, nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
 }
@@ -0,0 +1,423 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// storageTypeSpec lists the type-specific parameters of a storage type by
+// their API name. Fixed parameters can only be set when the storage is created.
+type storageTypeSpec struct {
+	required []string
+	optional []string
+	fixed    []string
+}
+
+// storageCommonParams are accepted by every supported storage type.
+func storageCommonParams() []string {
+	return []string{"content", "nodes", "disable", "prune-backups", "max-protected-backups"}
+}
+
+func storageTypeSpecFor(storageType string) (storageTypeSpec, bool) {
+	switch storageType {
+	case "dir":
+		return storageTypeSpec{
+			required: []string{"path"},
+			optional: []string{"shared", "is_mountpoint", "create-base-path", "preallocation"},
+			fixed:    []string{"path"},
+		}, true
+	case "nfs":
+		return storageTypeSpec{
+			required: []string{"server", "export"},
+			optional: []string{"path", "options", "preallocation"},
+			fixed:    []string{"server", "export", "path"},
+		}, true
+	case "cifs":
+		return storageTypeSpec{
+			required: []string{"server", "share"},
+			optional: []string{"path", "username", "password", "domain", "smbversion", "subdir", "preallocation"},
+			fixed:    []string{"server", "share", "path"},
+		}, true
+	case "lvmthin":
+		return storageTypeSpec{
+			required: []string{"vgname", "thinpool"},
+			fixed:    []string{"vgname", "thinpool"},
+		}, true
+	case "zfspool":
+		return storageTypeSpec{
+			required: []string{"pool"},
+			optional: []string{"sparse", "blocksize", "mountpoint"},
+			fixed:    []string{"pool"},
+		}, true
+	case "rbd":
+		return storageTypeSpec{
+			optional: []string{"pool", "monhost", "username", "keyring", "krbd", "namespace", "data-pool"},
+		}, true
+	case "pbs":
+		return storageTypeSpec{
+			required: []string{"server", "datastore", "username", "password"},
+			optional: []string{"fingerprint", "namespace", "encryption-key", "port"},
+			fixed:    []string{"datastore"},
+		}, true
+	}
+	return storageTypeSpec{}, false
+}
+
+// storageArgName is the tool argument name of an API parameter. The ZFS and
+// Ceph pool is passed as storage_pool, because pool names a resource pool in
+// every other tool and is checked against allowed_pools.
+func storageArgName(param string) string {
+	if param == "pool" {
+		return "storage_pool"
+	}
+	return strings.ReplaceAll(param, "-", "_")
+}
+
+// allStorageParams returns every type-specific and common parameter, sorted.
+func allStorageParams() []string {
+	seen := map[string]bool{}
+	for _, p := range storageCommonParams() {
+		seen[p] = true
+	}
+	for _, t := range []string{"dir", "nfs", "cifs", "lvmthin", "zfspool", "rbd", "pbs"} {
+		spec, _ := storageTypeSpecFor(t)
+		for _, p := range append(spec.required, spec.optional...) {
+			seen[p] = true
+		}
+	}
+	params := make([]string, 0, len(seen))
+	for p := range seen {
+		params = append(params, p)
+	}
+	sort.Strings(params)
+	return params
+}
+
+// storageParams validates the storage parameters in req against the spec of
+// storageType and returns them keyed by API name. On create the required
+// parameters must be present; on update the fixed ones are refused.
+func storageParams(req mcp.CallToolRequest, storageType string, create bool) (url.Values, error) {
+	spec, ok := storageTypeSpecFor(storageType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage type %q (supported: dir, nfs, cifs, lvmthin, zfspool, rbd, pbs)",
+			storageType)
+	}
+
+	allowed := map[string]bool{}
+	for _, p := range append(append(storageCommonParams(), spec.required...), spec.optional...) {
+		allowed[p] = true
+	}
+	if !create {
+		for _, p := range spec.fixed {
+			allowed[p] = false
+		}
+	}
+
+	data := url.Values{}
+	for _, p := range allStorageParams() {
+		v := req.GetString(storageArgName(p), "")
+		if v == "" {
+			continue
+		}
+		if !allowed[p] {
+			if !create && slices.Contains(spec.fixed, p) {
+				return nil, fmt.Errorf("%s cannot be changed after the storage was created", storageArgName(p))
+			}
+			return nil, fmt.Errorf("%s is not a valid parameter for %s storage", storageArgName(p), storageType)
+		}
+		data.Set(p, v)
+	}
+
+	if create {
+		var missing []string
+		for _, p := range spec.required {
+			if data.Get(p) == "" {
+				missing = append(missing, storageArgName(p))
+			}
+		}
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("%s storage requires %s", storageType, strings.Join(missing, ", "))
+		}
+	}
+	return data, nil
+}
+
+func storageParamOptions() []mcp.ToolOption {
+	descriptions := map[string]string{
+		"content":               "Comma-separated content types (e.g. images,rootdir,iso,vztmpl,backup,snippets)",
+		"nodes":                 "Comma-separated list of nodes the storage is available on (default: all)",
+		"disable":               "Disable the storage: 1 or 0",
+		"prune-backups":         "Backup retention (e.g. keep-last=3,keep-weekly=2)",
+		"max-protected-backups": "Maximum number of protected backups per guest",
+		"path":                  "dir: directory path; nfs/cifs: mount point (default: /mnt/pve/<storage>)",
+		"shared":                "dir: the directory is shared between nodes: 1 or 0",
+		"is_mountpoint":         "dir: only use the path if it is a mount point: yes, no or the mount point",
+		"create-base-path":      "dir: create the base directory if it does not exist: 1 or 0",
+		"preallocation":         "dir/nfs/cifs: qcow2/raw preallocation: off, metadata, falloc, full",
+		"server":                "nfs/cifs/pbs: server address",
+		"export":                "nfs: export path",
+		"options":               "nfs: mount options (e.g. vers=4.2)",
+		"share":                 "cifs: share name",
+		"username":              "cifs/rbd/pbs: user name (pbs: user@realm or user@realm!token)",
+		"password":              "cifs/pbs: password or API token secret (never logged)",
+		"domain":                "cifs: domain",
+		"smbversion":            "cifs: SMB protocol version: default, 2.0, 2.1, 3, 3.0, 3.11",
+		"subdir":                "cifs: subdirectory of the share to use",
+		"vgname":                "lvmthin: volume group name",
+		"thinpool":              "lvmthin: thin pool name",
+		"pool":                  "zfspool: ZFS pool/dataset; rbd: Ceph pool (default: rbd)",
+		"sparse":                "zfspool: use thin provisioned volumes: 1 or 0",
+		"blocksize":             "zfspool: volume block size (e.g. 16k)",
+		"mountpoint":            "zfspool: mount point of the pool",
+		"monhost":               "rbd: monitor addresses of an external Ceph cluster",
+		"keyring":               "rbd: client keyring of an external Ceph cluster (never logged)",
+		"krbd":                  "rbd: use the kernel RBD driver: 1 or 0",
+		"namespace":             "rbd/pbs: namespace",
+		"data-pool":             "rbd: data pool for erasure coded pools",
+		"datastore":             "pbs: datastore name",
+		"fingerprint":           "pbs: server certificate SHA-256 fingerprint",
+		"encryption-key":        "pbs: client encryption key as JSON, or 'autogen' (never logged)",
+		"port":                  "pbs: server port (default: 8007)",
+	}
+
+	var opts []mcp.ToolOption
+	for _, p := range allStorageParams() {
+		opts = append(opts, mcp.WithString(storageArgName(p), mcp.Description(descriptions[p])))
+	}
+	return opts
+}
+
+func RegisterStorageConfigTools(s *server.MCPServer, c *ProxmoxClient) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("list_storage_config",
+			mcp.WithDescription("List the cluster-wide storage definitions (/storage)"),
+			mcp.WithString("type",
+				mcp.Description("Only list storages of this type (e.g. nfs)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			path := "/storage"
+			if v := req.GetString("type", ""); v != "" {
+				path += "?type=" + url.QueryEscape(v)
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("get_storage_config",
+			mcp.WithDescription("Get the definition of a storage"),
+			mcp.WithString("storage",
+				mcp.Description("Storage ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Get(ctx, "/storage/"+url.PathEscape(storage))
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	createOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Add a storage definition. Supported types and their required parameters: dir (path), nfs (server, " +
+				"export), cifs (server, share), lvmthin (vgname, thinpool), zfspool (pool), rbd, pbs (server, " +
+				"datastore, username, password)",
+		),
+		mcp.WithString("storage",
+			mcp.Description("Storage ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("type",
+			mcp.Description("Storage type: dir, nfs, cifs, lvmthin, zfspool, rbd, or pbs"),
+			mcp.Required(),
+		),
+	}, storageParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("create_storage", createOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storageType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data, err := storageParams(req, storageType, true)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			data.Set("storage", storage)
+			data.Set("type", storageType)
+
+			result, err := c.Post(ctx, "/storage", data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	updateOpts := append([]mcp.ToolOption{
+		mcp.WithDescription(
+			"Update a storage definition. Parameters are validated against the storage type; parameters fixed at " +
+				"creation (e.g. path, server, export, pool) cannot be changed",
+		),
+		mcp.WithString("storage",
+			mcp.Description("Storage ID"),
+			mcp.Required(),
+		),
+		mcp.WithString("delete",
+			mcp.Description("Comma-separated list of settings to reset to their defaults"),
+		),
+	}, storageParamOptions()...)
+	s.AddTool(
+		mcp.NewTool("update_storage", updateOpts...),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var current struct {
+				Type string `json:"type"`
+			}
+			if err := c.GetJSON(ctx, "/storage/"+url.PathEscape(storage), &current); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data, err := storageParams(req, current.Type, false)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if v := req.GetString("delete", ""); v != "" {
+				data.Set("delete", v)
+			}
+			if len(data) == 0 {
+				return mcp.NewToolResultError("no settings to update"), nil
+			}
+
+			result, err := c.Put(ctx, "/storage/"+url.PathEscape(storage), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("delete_storage",
+			mcp.WithDescription("Remove a storage definition. The data on the storage itself is not deleted"),
+			mcp.WithString("storage",
+				mcp.Description("Storage ID"),
+				mcp.Required(),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := c.Delete(ctx, "/storage/"+url.PathEscape(storage), nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("scan_storage",
+			mcp.WithDescription("Scan from a node for NFS exports, CIFS shares, iSCSI targets or local ZFS pools"),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("type",
+				mcp.Description("What to scan: nfs, cifs, iscsi, or zfs"),
+				mcp.Required(),
+			),
+			mcp.WithString("server",
+				mcp.Description("nfs/cifs: server address"),
+			),
+			mcp.WithString("portal",
+				mcp.Description("iscsi: portal address (host[:port])"),
+			),
+			mcp.WithString("username",
+				mcp.Description("cifs: user name"),
+			),
+			mcp.WithString("password",
+				mcp.Description("cifs: password (never logged)"),
+			),
+			mcp.WithString("domain",
+				mcp.Description("cifs: domain"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			scanType, err := req.RequireString("type")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			var params []string
+			switch scanType {
+			case "nfs":
+				params = []string{"server"}
+			case "cifs":
+				params = []string{"server", "username", "password", "domain"}
+			case "iscsi":
+				params = []string{"portal"}
+			case "zfs":
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("unsupported scan type %q", scanType)), nil
+			}
+
+			q := url.Values{}
+			for _, p := range params {
+				if v := req.GetString(p, ""); v != "" {
+					q.Set(p, v)
+				}
+			}
+			if len(params) > 0 && q.Get(params[0]) == "" {
+				return mcp.NewToolResultError(fmt.Sprintf("%s scan requires %s", scanType, params[0])), nil
+			}
+
+			path := fmt.Sprintf("/nodes/%s/scan/%s", node, scanType)
+			if len(q) > 0 {
+				path += "?" + q.Encode()
+			}
+			result, err := c.Get(ctx, path)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(result), nil
+		},
+	)
+}
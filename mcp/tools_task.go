@@ -5,13 +5,137 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
+// taskPollInterval is how often waitForTask polls the task status.
+const taskPollInterval = time.Second
+
+// taskStatus is the status of a Proxmox task (/nodes/{node}/tasks/{upid}/status).
+type taskStatus struct {
+	UPID       string `json:"upid"`
+	Node       string `json:"node"`
+	Type       string `json:"type"`
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	ExitStatus string `json:"exitstatus"`
+}
+
+// OK reports whether the task finished successfully. Tasks that only logged
+// warnings ("WARNINGS: n") count as successful.
+func (t taskStatus) OK() bool {
+	return t.ExitStatus == "OK" || strings.HasPrefix(t.ExitStatus, "WARNINGS")
+}
+
+// taskLogLine is a line of a task log. N is the 1-based line number; an
+// empty log reads as the single line {"n":1,"t":"no content"}.
+type taskLogLine struct {
+	N int    `json:"n"`
+	T string `json:"t"`
+}
+
+// upidNode returns the node a task runs on ("UPID:node:...").
+func upidNode(upid string) (string, error) {
+	parts := strings.SplitN(upid, ":", 3)
+	if len(parts) < 3 || parts[0] != "UPID" || parts[1] == "" {
+		return "", fmt.Errorf("invalid task UPID %q", upid)
+	}
+	return parts[1], nil
+}
+
+// parseUPID extracts the UPID from the JSON string returned by task-starting endpoints.
+func parseUPID(result string) (string, error) {
+	var upid string
+	if err := json.Unmarshal([]byte(result), &upid); err != nil || !strings.HasPrefix(upid, "UPID:") {
+		return "", fmt.Errorf("expected a task UPID, got %s", result)
+	}
+	return upid, nil
+}
+
+// waitForTask polls the task until it stopped and returns its final status.
+// onLog, if not nil, receives the task log lines as they are written.
+func waitForTask(ctx context.Context, c *ProxmoxClient, upid string, onLog func([]string)) (taskStatus, error) {
+	node, err := upidNode(upid)
+	if err != nil {
+		return taskStatus{}, err
+	}
+	base := fmt.Sprintf("/nodes/%s/tasks/%s", node, url.PathEscape(upid))
+
+	logStart := 0
+	for {
+		var st taskStatus
+		if err := c.GetJSON(ctx, base+"/status", &st); err != nil {
+			return taskStatus{}, err
+		}
+
+		if onLog != nil {
+			var lines []taskLogLine
+			if err := c.GetJSON(ctx, fmt.Sprintf("%s/log?start=%d&limit=500", base, logStart), &lines); err == nil {
+				if len(lines) == 1 && lines[0].N == 1 && lines[0].T == "no content" {
+					lines = nil
+				}
+				text := make([]string, 0, len(lines))
+				for _, l := range lines {
+					text = append(text, l.T)
+					logStart = max(logStart, l.N)
+				}
+				if len(text) > 0 {
+					onLog(text)
+				}
+			}
+		}
+
+		if st.Status == "stopped" {
+			return st, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return st, fmt.Errorf("waiting for task %s: %w", upid, ctx.Err())
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+// waitForTaskLog waits up to timeout for the task started by result (a UPID)
+// and returns its exit status and log tail. Log lines are reported as progress.
+func waitForTaskLog(ctx context.Context, c *ProxmoxClient, result string, timeout time.Duration,
+	progress progressFunc,
+) *mcp.CallToolResult {
+	upid, err := parseUPID(result)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var logLines []string
+	st, err := waitForTask(ctx, c, upid, func(lines []string) {
+		logLines = append(logLines, lines...)
+		progress(float64(len(logLines)), 0, strings.TrimSpace(lines[len(lines)-1]))
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+
+	const tail = 20
+	if len(logLines) > tail {
+		logLines = logLines[len(logLines)-tail:]
+	}
+	text := fmt.Sprintf("Task %s finished: %s\n%s", upid, st.ExitStatus, strings.Join(logLines, "\n"))
+	if !st.OK() {
+		return mcp.NewToolResultError(text)
+	}
+	return mcp.NewToolResultText(text)
+}
+
 func RegisterTaskTools(s *server.MCPServer, c *ProxmoxClient) {
 	s.AddTool(
 		mcp.NewTool("list_tasks",
@@ -0,0 +1,362 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// taskPercentRe matches the progress percentage in download task log lines.
+var taskPercentRe = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+
+// maxInlineUploadSize bounds files passed base64-encoded in the tool call.
+const maxInlineUploadSize = 64 << 20
+
+// storageTaskTimeoutSeconds is the default time to wait for a download or upload task.
+const storageTaskTimeoutSeconds = 3600
+
+func validateUploadContent(content string) error {
+	switch content {
+	case "iso", "vztmpl", "import":
+		return nil
+	}
+	return fmt.Errorf("unsupported content %q (supported: iso, vztmpl, import)", content)
+}
+
+// checksumParams validates the optional checksum arguments and adds them to data.
+func checksumParams(req mcp.CallToolRequest, data url.Values) error {
+	checksum := req.GetString("checksum", "")
+	algorithm := req.GetString("checksum_algorithm", "")
+	if checksum == "" && algorithm == "" {
+		return nil
+	}
+	if checksum == "" || algorithm == "" {
+		return errors.New("checksum and checksum_algorithm must be set together")
+	}
+	switch algorithm {
+	case "md5", "sha1", "sha224", "sha256", "sha384", "sha512":
+	default:
+		return fmt.Errorf("unsupported checksum_algorithm %q", algorithm)
+	}
+	data.Set("checksum", checksum)
+	data.Set("checksum-algorithm", algorithm)
+	return nil
+}
+
+// resolveUploadPath returns the absolute path of name inside dir, refusing
+// paths that leave dir, including through symlinks.
+func resolveUploadPath(dir, name string) (string, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("upload directory: %w", err)
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("upload directory: %w", err)
+	}
+
+	p, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+name)))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, p); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("%s is outside the upload directory", name)
+	}
+	return p, nil
+}
+
+// progressReader reports the number of bytes read through it, at most once
+// per percent.
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	read     int64
+	reported int64
+	progress progressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if p.read != p.reported && (p.read == p.total || (p.read-p.reported)*100 >= p.total) {
+		p.reported = p.read
+		p.progress(float64(p.read), float64(p.total), fmt.Sprintf("uploaded %d of %d bytes", p.read, p.total))
+	}
+	return n, err
+}
+
+// waitForStorageTask waits for a download or upload task and reports the
+// percentage found in its log as progress. Only increasing values are
+// reported, as MCP requires.
+func waitForStorageTask(ctx context.Context, c *ProxmoxClient, upid string, timeout time.Duration,
+	progress progressFunc,
+) *mcp.CallToolResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	last := 0.0
+	st, err := waitForTask(ctx, c, upid, func(lines []string) {
+		for i := len(lines) - 1; i >= 0; i-- {
+			m := taskPercentRe.FindStringSubmatch(lines[i])
+			if m == nil {
+				continue
+			}
+			if pct, err := strconv.ParseFloat(m[1], 64); err == nil && pct > last {
+				last = pct
+				progress(pct, 100, strings.TrimSpace(lines[i]))
+			}
+			return
+		}
+	})
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	if !st.OK() {
+		return mcp.NewToolResultError(fmt.Sprintf("task %s failed: %s", upid, st.ExitStatus))
+	}
+	if last < 100 {
+		progress(100, 100, "done")
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Task %s finished: %s", upid, st.ExitStatus))
+}
+
+func RegisterUploadTools(s *server.MCPServer, c *ProxmoxClient, opts Options) { //nolint:funlen,gocognit
+	s.AddTool(
+		mcp.NewTool("download_url_to_storage",
+			mcp.WithDescription(
+				"Download an ISO image, container template or disk image from a URL into a storage, optionally "+
+					"verifying a checksum and decompressing it. Waits for the download and reports progress",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("storage",
+				mcp.Description("Storage name"),
+				mcp.Required(),
+			),
+			mcp.WithString("url",
+				mcp.Description("URL to download from"),
+				mcp.Required(),
+			),
+			mcp.WithString("filename",
+				mcp.Description("Target file name (e.g. debian-12.iso)"),
+				mcp.Required(),
+			),
+			mcp.WithString("content",
+				mcp.Description("Content type: iso, vztmpl, or import (default: iso)"),
+			),
+			mcp.WithString("checksum",
+				mcp.Description("Expected checksum of the downloaded file"),
+			),
+			mcp.WithString("checksum_algorithm",
+				mcp.Description("Checksum algorithm: md5, sha1, sha224, sha256, sha384, or sha512"),
+			),
+			mcp.WithString("compression",
+				mcp.Description("Decompress the download (iso only): gz, lzo, zst, or bz2"),
+			),
+			mcp.WithString("verify_certificates",
+				mcp.Description("Verify the TLS certificate of the URL: 1 or 0 (default: 1)"),
+			),
+			mcp.WithString("timeout",
+				mcp.Description("Seconds to wait for the download to finish (default: 3600)"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			srcURL, err := req.RequireString("url")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			filename, err := req.RequireString("filename")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			content := req.GetString("content", "iso")
+			if err := validateUploadContent(content); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			timeout, err := strconv.Atoi(req.GetString("timeout", strconv.Itoa(storageTaskTimeoutSeconds)))
+			if err != nil || timeout <= 0 {
+				return mcp.NewToolResultError("timeout must be a positive number of seconds"), nil
+			}
+
+			data := url.Values{
+				"url":      {srcURL},
+				"filename": {filename},
+				"content":  {content},
+			}
+			if err := checksumParams(req, data); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if v := req.GetString("compression", ""); v != "" {
+				switch v {
+				case "gz", "lzo", "zst", "bz2":
+				default:
+					return mcp.NewToolResultError(fmt.Sprintf("unsupported compression %q", v)), nil
+				}
+				if content != "iso" {
+					return mcp.NewToolResultError("compression is only supported for iso content"), nil
+				}
+				data.Set("compression", v)
+			}
+			if v := req.GetString("verify_certificates", ""); v != "" {
+				data.Set("verify-certificates", v)
+			}
+
+			result, err := c.Post(ctx, fmt.Sprintf("/nodes/%s/storage/%s/download-url", node, storage), data)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			upid, err := parseUPID(result)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return waitForStorageTask(ctx, c, upid, time.Duration(timeout)*time.Second, progressReporter(ctx, req)), nil
+		},
+	)
+
+	s.AddTool(
+		mcp.NewTool("upload_to_storage",
+			mcp.WithDescription(
+				"Upload an ISO image, container template or disk image to a storage, either from a file in the "+
+					"server's upload directory (path) or from base64 data sent by the client (content_base64, up "+
+					"to 64 MiB). Reports upload progress",
+			),
+			mcp.WithString("node",
+				mcp.Description("Node name"),
+				mcp.Required(),
+			),
+			mcp.WithString("storage",
+				mcp.Description("Storage name"),
+				mcp.Required(),
+			),
+			mcp.WithString("filename",
+				mcp.Description("Target file name (default: the base name of path)"),
+			),
+			mcp.WithString("path",
+				mcp.Description("File to upload, relative to the configured upload directory"),
+			),
+			mcp.WithString("content_base64",
+				mcp.Description("File contents, base64-encoded"),
+			),
+			mcp.WithString("content",
+				mcp.Description("Content type: iso, vztmpl, or import (default: iso)"),
+			),
+			mcp.WithString("checksum",
+				mcp.Description("Expected checksum, verified by Proxmox after the upload"),
+			),
+			mcp.WithString("checksum_algorithm",
+				mcp.Description("Checksum algorithm: md5, sha1, sha224, sha256, sha384, or sha512"),
+			),
+		),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			node, err := req.RequireString("node")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			storage, err := req.RequireString("storage")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			content := req.GetString("content", "iso")
+			if err := validateUploadContent(content); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			data := url.Values{"content": {content}}
+			if err := checksumParams(req, data); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			path := req.GetString("path", "")
+			inline := req.GetString("content_base64", "")
+			filename := req.GetString("filename", "")
+
+			var (
+				src  io.Reader
+				size int64
+			)
+			switch {
+			case path != "" && inline != "":
+				return mcp.NewToolResultError("set either path or content_base64, not both"), nil
+			case path != "":
+				if opts.UploadDir == "" {
+					return mcp.NewToolResultError("local file uploads are disabled: upload_dir is not configured"), nil
+				}
+				full, err := resolveUploadPath(opts.UploadDir, path)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				f, err := os.Open(full)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				defer f.Close()
+				fi, err := f.Stat()
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if !fi.Mode().IsRegular() {
+					return mcp.NewToolResultError(path + " is not a regular file"), nil
+				}
+				src, size = f, fi.Size()
+				if filename == "" {
+					filename = filepath.Base(full)
+				}
+			case inline != "":
+				if base64.StdEncoding.DecodedLen(len(inline)) > maxInlineUploadSize {
+					return mcp.NewToolResultError("content_base64 exceeds 64 MiB; use path instead"), nil
+				}
+				raw, err := base64.StdEncoding.DecodeString(inline)
+				if err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("decoding content_base64: %v", err)), nil
+				}
+				src, size = bytes.NewReader(raw), int64(len(raw))
+				if filename == "" {
+					return mcp.NewToolResultError("filename is required with content_base64"), nil
+				}
+			default:
+				return mcp.NewToolResultError("one of path or content_base64 is required"), nil
+			}
+
+			progress := progressReporter(ctx, req)
+			body := &progressReader{r: src, total: size, progress: progress}
+			result, err := c.PostFile(ctx, fmt.Sprintf("/nodes/%s/storage/%s/upload", node, storage),
+				data, filename, body, size)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			upid, err := parseUPID(result)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			// The upload task only moves and verifies the file on the node.
+			return waitForStorageTask(ctx, c, upid, storageTaskTimeoutSeconds*time.Second,
+				func(float64, float64, string) {}), nil
+		},
+	)
+}
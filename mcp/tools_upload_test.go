@@ -0,0 +1,217 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+
+	mcplib "github.com/anthoniech/proxmox-mcp-go/mcp"
+)
+
+// fakeSession is an initialized client session collecting notifications.
+type fakeSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (f *fakeSession) Initialize()       {}
+func (f *fakeSession) Initialized() bool { return true }
+func (f *fakeSession) SessionID() string { return "test-session" }
+func (f *fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return f.notifications
+}
+
+// callToolWithProgress calls a tool through the MCP server in a client
+// session with a progress token and returns the result text, whether it is an
+// error, and the progress values notified.
+func callToolWithProgress(t *testing.T, s *mcplib.Server, name string, args map[string]any,
+) (string, bool, []float64) {
+	t.Helper()
+
+	session := &fakeSession{notifications: make(chan mcp.JSONRPCNotification, 100)}
+	if err := s.MCPServer().RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("RegisterSession: %v", err)
+	}
+	ctx := s.MCPServer().WithContext(context.Background(), session)
+
+	msg, err := json.Marshal(map[string]any{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "tools/call",
+		"params": map[string]any{
+			"name":      name,
+			"arguments": args,
+			"_meta":     map[string]any{"progressToken": "tok-1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal request: %v", err)
+	}
+	resp, ok := s.MCPServer().HandleMessage(ctx, msg).(mcp.JSONRPCResponse)
+	if !ok {
+		t.Fatalf("unexpected response type for %s", name)
+	}
+	res, ok := resp.Result.(mcp.CallToolResult)
+	if !ok {
+		t.Fatalf("unexpected result type %T for %s", resp.Result, name)
+	}
+
+	var progress []float64
+	for len(session.notifications) > 0 {
+		n := <-session.notifications
+		if n.Method != "notifications/progress" {
+			continue
+		}
+		if n.Params.AdditionalFields["progressToken"] != "tok-1" {
+			t.Errorf("unexpected progress token %v", n.Params.AdditionalFields["progressToken"])
+		}
+		if v, ok := n.Params.AdditionalFields["progress"].(float64); ok {
+			progress = append(progress, v)
+		}
+	}
+	return resultText(&res), res.IsError, progress
+}
+
+func TestDownloadURLReportsProgress(t *testing.T) {
+	const upid = "UPID:pve1:00001234:00005678:65000000:download:debian.iso:root@pam:"
+
+	s := newFakePVEServer(t, map[string]string{
+		"POST /nodes/pve1/storage/local/download-url": `"` + upid + `"`,
+		"GET /nodes/pve1/tasks/" + upid + "/status":   `{"status":"stopped","exitstatus":"OK"}`,
+		"GET /nodes/pve1/tasks/" + upid + "/log": `[
+			{"n":1,"t":"downloading https://example.com/debian.iso"},
+			{"n":2,"t":"   50.00% (300.0 MiB of 600.0 MiB) in 3s"}
+		]`,
+	})
+
+	text, isErr, progress := callToolWithProgress(t, s, "download_url_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "url": "https://example.com/debian.iso.gz",
+		"filename": "debian.iso", "checksum": "abc", "checksum_algorithm": "sha256", "compression": "gz",
+	})
+	if isErr {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	if len(progress) != 2 || progress[0] != 50 || progress[1] != 100 {
+		t.Errorf("expected progress [50 100], got %v", progress)
+	}
+
+	res := callTool(t, s, "download_url_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "url": "https://example.com/x", "filename": "x",
+		"content": "vztmpl", "compression": "gz",
+	})
+	if !res.IsError {
+		t.Error("expected compression to be refused for vztmpl")
+	}
+
+	// A log that already reached 100% must not report 100 a second time.
+	s = newFakePVEServer(t, map[string]string{
+		"POST /nodes/pve1/storage/local/download-url": `"` + upid + `"`,
+		"GET /nodes/pve1/tasks/" + upid + "/status":   `{"status":"stopped","exitstatus":"OK"}`,
+		"GET /nodes/pve1/tasks/" + upid + "/log": `[
+			{"n":1,"t":"  100.00% (600.0 MiB of 600.0 MiB) in 6s"},
+			{"n":2,"t":"download of 'https://example.com/debian.iso' finished"}
+		]`,
+	})
+	_, _, progress = callToolWithProgress(t, s, "download_url_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "url": "https://example.com/debian.iso", "filename": "debian.iso",
+	})
+	if len(progress) != 1 || progress[0] != 100 {
+		t.Errorf("expected progress [100], got %v", progress)
+	}
+}
+
+func TestUploadToStorage(t *testing.T) {
+	const upid = "UPID:pve1:00001234:00005678:65000000:imgcopy::root@pam:"
+	payload := strings.Repeat("iso-data", 1000)
+
+	var got struct {
+		content, filename, data string
+		length                  int64
+	}
+	pve := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + strings.TrimPrefix(r.URL.Path, "/api2/json") {
+		case "POST /nodes/pve1/storage/local/upload":
+			got.length = r.ContentLength
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("parsing upload: %v", err)
+			}
+			got.content = r.FormValue("content")
+			f, hdr, err := r.FormFile("filename")
+			if err != nil {
+				t.Errorf("reading upload: %v", err)
+				return
+			}
+			b, _ := io.ReadAll(f)
+			got.filename, got.data = hdr.Filename, string(b)
+			_, _ = w.Write([]byte(`{"data":"` + upid + `"}`))
+		case "GET /nodes/pve1/tasks/" + upid + "/status":
+			_, _ = w.Write([]byte(`{"data":{"status":"stopped","exitstatus":"OK"}}`))
+		default:
+			http.Error(w, "no route", http.StatusNotImplemented)
+		}
+	}))
+	t.Cleanup(pve.Close)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tools.iso"), []byte(payload), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := mcplib.New(pve.URL, fakeToken, nil, mcplib.Options{UploadDir: dir})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+
+	text, isErr, progress := callToolWithProgress(t, s, "upload_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "path": "tools.iso",
+	})
+	if isErr {
+		t.Fatalf("unexpected error: %s", text)
+	}
+	if got.filename != "tools.iso" || got.content != "iso" || got.data != payload {
+		t.Errorf("unexpected upload: filename=%q content=%q %d bytes", got.filename, got.content, len(got.data))
+	}
+	if got.length <= int64(len(payload)) {
+		t.Errorf("expected a Content-Length above the file size, got %d", got.length)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != float64(len(payload)) {
+		t.Errorf("expected progress up to %d bytes, got %v", len(payload), progress)
+	}
+
+	res := callTool(t, s, "upload_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "filename": "inline.iso",
+		"content_base64": base64.StdEncoding.EncodeToString([]byte("inline")),
+	})
+	if res.IsError || got.filename != "inline.iso" || got.data != "inline" {
+		t.Errorf("inline upload failed: %s", resultText(res))
+	}
+
+	res = callTool(t, s, "upload_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "path": "../../etc/passwd",
+	})
+	if !res.IsError {
+		t.Error("expected a path outside the upload directory to be refused")
+	}
+}
+
+func TestUploadLocalFileDisabledByDefault(t *testing.T) {
+	s := newTestServer(t)
+
+	res := callTool(t, s, "upload_to_storage", map[string]any{
+		"node": "pve1", "storage": "local", "path": "tools.iso",
+	})
+	if !res.IsError || !strings.Contains(resultText(res), "upload_dir") {
+		t.Errorf("expected local uploads to be disabled, got %q", resultText(res))
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright (c) 2025 anthoniech
+// Licensed under the MIT License. See LICENSE file for details.
+
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // required by the WebSocket handshake (RFC 6455)
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455, section 5.2).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWSMessageSize bounds a single reassembled message.
+const maxWSMessageSize = 16 << 20
+
+var errWSClosed = errors.New("websocket closed by peer")
+
+// wsConn is a minimal client-side WebSocket connection, sufficient for the
+// Proxmox vncwebsocket terminal protocol.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket to the Proxmox API path using the client's
+// credentials. path may contain a query string.
+func (c *ProxmoxClient) dialWebSocket(ctx context.Context, path string) (*wsConn, error) {
+	start := time.Now()
+	u, err := url.Parse(c.BaseURL + "/api2/json" + path)
+	if err != nil {
+		return nil, fmt.Errorf("parsing websocket URL: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if u.Scheme == "https" {
+		tlsDialer := &tls.Dialer{
+			NetDialer: dialer,
+			Config: &tls.Config{
+				InsecureSkipVerify: true, //nolint:gosec // Proxmox commonly uses self-signed certificates
+				ServerName:         u.Hostname(),
+			},
+		}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", host)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		dialErr := fmt.Errorf("connecting websocket: %w", err)
+		c.logRequest(http.MethodGet, path, nil, 0, 0, time.Since(start), dialErr)
+		return nil, dialErr
+	}
+
+	ws, err := wsHandshake(ctx, conn, u, c.Token)
+	if err != nil {
+		_ = conn.Close()
+		c.logRequest(http.MethodGet, path, nil, 0, 0, time.Since(start), err)
+		return nil, err
+	}
+	c.logRequest(http.MethodGet, path, nil, http.StatusSwitchingProtocols, 0, time.Since(start), nil)
+	return ws, nil
+}
+
+func wsHandshake(ctx context.Context, conn net.Conn, u *url.URL, token string) (*wsConn, error) {
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, fmt.Errorf("generating websocket key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating websocket request: %w", err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", "binary")
+	req.Header.Set("Authorization", "PVEAPIToken="+token)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer func() { _ = conn.SetDeadline(time.Time{}) }()
+	}
+
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("sending websocket handshake: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("reading websocket handshake: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("websocket handshake failed: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		return nil, errors.New("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+
+	return &wsConn{conn: conn, br: br}, nil
+}
+
+func wsAcceptKey(key string) string {
+	h := sha1.New() //nolint:gosec // required by the WebSocket handshake (RFC 6455)
+	h.Write([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// WriteMessage sends data as a single masked frame.
+func (w *wsConn) WriteMessage(opcode byte, data []byte) error {
+	header := make([]byte, 0, 14)
+	header = append(header, 0x80|opcode)
+
+	switch n := len(data); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 0x80|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 0x80|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return fmt.Errorf("generating frame mask: %w", err)
+	}
+	header = append(header, mask...)
+
+	payload := make([]byte, len(data))
+	for i, b := range data {
+		payload[i] = b ^ mask[i%4]
+	}
+
+	if _, err := w.conn.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("writing websocket frame: %w", err)
+	}
+	return nil
+}
+
+// ReadMessage returns the next data message, answering pings and
+// reassembling fragmented messages on the way.
+func (w *wsConn) ReadMessage() (byte, []byte, error) {
+	var (
+		opcode  byte
+		message []byte
+	)
+	for {
+		fin, op, payload, err := w.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := w.WriteMessage(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			_ = w.WriteMessage(wsOpClose, nil)
+			return 0, nil, errWSClosed
+		case wsOpText, wsOpBinary:
+			opcode = op
+			message = payload
+		case wsOpContinuation:
+			message = append(message, payload...)
+		default:
+			return 0, nil, fmt.Errorf("unsupported websocket opcode %#x", op)
+		}
+
+		if len(message) > maxWSMessageSize {
+			return 0, nil, errors.New("websocket message too large")
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+func (w *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(w.br, head[:]); err != nil {
+		return false, 0, nil, fmt.Errorf("reading websocket frame: %w", err)
+	}
+
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(w.br, ext[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("reading websocket frame: %w", err)
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(w.br, ext[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("reading websocket frame: %w", err)
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxWSMessageSize {
+		return false, 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(w.br, mask[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("reading websocket frame: %w", err)
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(w.br, payload); err != nil {
+		return false, 0, nil, fmt.Errorf("reading websocket frame: %w", err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// SetDeadline sets the read and write deadline of the underlying connection.
+func (w *wsConn) SetDeadline(t time.Time) error {
+	return w.conn.SetDeadline(t)
+}
+
+// Close sends a close frame and closes the connection.
+func (w *wsConn) Close() error {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = w.WriteMessage(wsOpClose, nil)
+	return w.conn.Close()
+}